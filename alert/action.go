@@ -1,9 +1,47 @@
 package alert
 
-import "log/slog"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/timgluz/smcprober/clock"
+)
 
 type RuleAction func(metric Metric, rule AlertRule) error
 
+// AlertRecord describes a fired alert for actions that hand it to other tooling
+type AlertRecord struct {
+	FiredAt  time.Time `json:"firedAt"`
+	RuleID   string    `json:"ruleID"`
+	RuleName string    `json:"ruleName"`
+
+	MetricName string  `json:"metricName"`
+	Source     string  `json:"source,omitempty"`
+	Value      float64 `json:"value"`
+	Unit       string  `json:"unit,omitempty"`
+	// Timestamp is the Unix time of the metric value, 0 if unknown
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
+func NewAlertRecord(metric Metric, rule AlertRule, firedAt time.Time) AlertRecord {
+	return AlertRecord{
+		FiredAt:    firedAt,
+		RuleID:     rule.ID,
+		RuleName:   rule.Name,
+		MetricName: metric.Name,
+		Source:     metric.Source,
+		Value:      metric.Value,
+		Unit:       metric.Unit,
+		Timestamp:  metric.Timestamp,
+	}
+}
+
 // common action builders
 func LogAction(logger *slog.Logger) RuleAction {
 	return func(metric Metric, rule AlertRule) error {
@@ -12,6 +50,42 @@ func LogAction(logger *slog.Logger) RuleAction {
 	}
 }
 
+// fileActionMu serializes the writes of all file actions, rules may share the same file
+var fileActionMu sync.Mutex
+
+// FileAction appends the alert as a JSON line to the file, e.g. as an audit trail.
+// The file is opened for every alert, so a rotated file is picked up with the next one
+func FileAction(path string) RuleAction {
+	return FileActionWithClock(path, clock.Real())
+}
+
+// FileActionWithClock is FileAction with the clock telling the firedAt time of the alerts
+func FileActionWithClock(path string, c clock.Clock) RuleAction {
+	path = filepath.Clean(path)
+
+	return func(metric Metric, rule AlertRule) error {
+		line, err := json.Marshal(NewAlertRecord(metric, rule, c.Now()))
+		if err != nil {
+			return err
+		}
+
+		fileActionMu.Lock()
+		defer fileActionMu.Unlock()
+
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open alert file: %w", err)
+		}
+
+		_, writeErr := file.Write(append(line, '\n'))
+		if writeErr != nil {
+			writeErr = fmt.Errorf("failed to write alert file: %w", writeErr)
+		}
+
+		return errors.Join(writeErr, file.Close())
+	}
+}
+
 func NoOpAction() RuleAction {
 	return func(metric Metric, rule AlertRule) error {
 		return nil
@@ -0,0 +1,55 @@
+package alert
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/timgluz/smcprober/clock"
+)
+
+func TestFileActionWithClock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.jsonl")
+	firedAt := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFakeClock(firedAt)
+
+	action := FileActionWithClock(path, fakeClock)
+	rule := AlertRule{ID: "battery_low", Name: "Battery Level Low"}
+	for _, value := range []float64{12, 11} {
+		if err := action(Metric{Name: "battery", Source: "device-1", Value: value, Unit: "%"}, rule); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		fakeClock.Advance(time.Minute)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records := make([]AlertRecord, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AlertRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("expected a JSON line, got %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 appended records, got %d", len(records))
+	}
+
+	if !records[0].FiredAt.Equal(firedAt) || !records[1].FiredAt.Equal(firedAt.Add(time.Minute)) {
+		t.Errorf("expected the clock to set firedAt, got %v and %v", records[0].FiredAt, records[1].FiredAt)
+	}
+
+	if records[1].RuleID != "battery_low" || records[1].Source != "device-1" || records[1].Value != 11 {
+		t.Errorf("unexpected record %+v", records[1])
+	}
+}
@@ -1,8 +1,14 @@
 package alert
 
 import (
+	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/timgluz/smcprober/clock"
 )
 
 type AlertingEngine struct {
@@ -10,20 +16,43 @@ type AlertingEngine struct {
 
 	rules  map[string]AlertRule
 	logger *slog.Logger
+	clock  clock.Clock
+
+	// lastFired tracks when the action of a rule last ran per metric series, for the cooldown
+	firedMu   sync.Mutex
+	lastFired map[string]time.Time
 }
 
 func NewAlertingEngine(logger *slog.Logger) *AlertingEngine {
 	return &AlertingEngine{
-		rules:  make(map[string]AlertRule),
-		logger: logger,
+		rules:     make(map[string]AlertRule),
+		logger:    logger,
+		clock:     clock.Real(),
+		lastFired: make(map[string]time.Time),
 	}
 }
 
-func (e *AlertingEngine) AddRule(rule AlertRule) {
+// SetClock replaces the clock used for time-dependent rule evaluation
+func (e *AlertingEngine) SetClock(c clock.Clock) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.clock = c
+}
+
+// AddRule adds or replaces the rule with the same ID, a rule with an invalid schedule is rejected
+func (e *AlertingEngine) AddRule(rule AlertRule) error {
+	if rule.Schedule != nil {
+		if err := rule.Schedule.Validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+	}
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
 	e.rules[rule.ID] = rule
+	return nil
 }
 
 func (e *AlertingEngine) RemoveRule(ruleID string) {
@@ -33,10 +62,63 @@ func (e *AlertingEngine) RemoveRule(ruleID string) {
 	delete(e.rules, ruleID)
 }
 
+// coolingDown reports whether the rule fired for the metric series within its cooldown
+func (e *AlertingEngine) coolingDown(rule AlertRule, metric Metric, now time.Time) bool {
+	if rule.Cooldown <= 0 {
+		return false
+	}
+
+	e.firedMu.Lock()
+	defer e.firedMu.Unlock()
+
+	firedAt, ok := e.lastFired[firingKey(rule, metric)]
+	return ok && now.Sub(firedAt) < rule.Cooldown
+}
+
+func (e *AlertingEngine) recordFired(rule AlertRule, metric Metric, now time.Time) {
+	if rule.Cooldown <= 0 {
+		return
+	}
+
+	e.firedMu.Lock()
+	defer e.firedMu.Unlock()
+
+	e.lastFired[firingKey(rule, metric)] = now
+}
+
+// firingKey separates the cooldown of a rule per device, a firing device doesn't silence the others
+func firingKey(rule AlertRule, metric Metric) string {
+	return rule.ID + "\x00" + metric.Key()
+}
+
+// RuleResult records the outcome of a single rule evaluation
+type RuleResult struct {
+	RuleID      string  `json:"ruleID"`
+	MetricName  string  `json:"metricName"`
+	Source      string  `json:"source,omitempty"`
+	Value       float64 `json:"value"`
+	Matched     bool    `json:"matched"`
+	ActionError string  `json:"actionError,omitempty"`
+
+	// Suppressed is set when the rule matched but its action was skipped,
+	// within the cooldown or outside of the schedule
+	Suppressed bool `json:"suppressed,omitempty"`
+
+	EvaluatedAt time.Time `json:"evaluatedAt"`
+}
+
 func (e *AlertingEngine) Evaluate(metric Metric) {
+	e.EvaluateWithResult(metric)
+}
+
+// EvaluateWithResult evaluates the enabled rules of the metric like Evaluate,
+// and returns their outcomes ordered by rule ID
+func (e *AlertingEngine) EvaluateWithResult(metric Metric) []RuleResult {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
+	evaluatedAt := e.clock.Now()
+	results := make([]RuleResult, 0)
 	for _, rule := range e.rules {
 		if rule.MetricName != metric.Name {
 			e.logger.Debug("Skipping rule for different metric", "ruleID", rule.ID, "ruleName", rule.Name, "expectedMetric", rule.MetricName, "actualMetric", metric.Name)
@@ -48,13 +130,41 @@ func (e *AlertingEngine) Evaluate(metric Metric) {
 			continue
 		}
 
-		if rule.Condition(metric) {
+		result := RuleResult{
+			RuleID:      rule.ID,
+			MetricName:  metric.Name,
+			Source:      metric.Source,
+			Value:       metric.Value,
+			Matched:     rule.Condition(metric),
+			EvaluatedAt: evaluatedAt,
+		}
+
+		switch {
+		case result.Matched && !rule.Schedule.Allows(evaluatedAt):
+			e.logger.Info("Rule condition met outside of its schedule, skipping action", "ruleID", rule.ID, "ruleName", rule.Name)
+			result.Suppressed = true
+		case result.Matched && e.coolingDown(rule, metric, evaluatedAt):
+			e.logger.Info("Rule condition met within cooldown, skipping action", "ruleID", rule.ID, "ruleName", rule.Name, "cooldown", rule.Cooldown)
+			result.Suppressed = true
+		case result.Matched:
 			e.logger.Info("Rule condition met, executing action", "ruleID", rule.ID, "ruleName", rule.Name)
 			if err := rule.Action(metric, rule); err != nil {
 				e.logger.Error("Failed to execute rule action", "ruleID", rule.ID, "ruleName", rule.Name, "error", err)
+				result.ActionError = err.Error()
+			} else {
+				// failed actions are retried on the next evaluation
+				e.recordFired(rule, metric, evaluatedAt)
 			}
-		} else {
+		default:
 			e.logger.Info("Rule condition not met", "ruleID", rule.ID, "ruleName", rule.Name)
 		}
+
+		results = append(results, result)
 	}
+
+	slices.SortFunc(results, func(a, b RuleResult) int {
+		return strings.Compare(a.RuleID, b.RuleID)
+	})
+
+	return results
 }
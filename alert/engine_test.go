@@ -0,0 +1,143 @@
+package alert
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/timgluz/smcprober/clock"
+)
+
+// countingAction counts the action calls per metric source and fails while err is set
+type countingAction struct {
+	calls map[string]int
+	err   error
+}
+
+func (a *countingAction) run(metric Metric, rule AlertRule) error {
+	if a.calls == nil {
+		a.calls = make(map[string]int)
+	}
+
+	a.calls[metric.Source]++
+	return a.err
+}
+
+func newTestEngine(t *testing.T, fakeClock *clock.FakeClock, rules ...AlertRule) *AlertingEngine {
+	t.Helper()
+
+	engine := NewAlertingEngine(slog.New(slog.DiscardHandler))
+	engine.SetClock(fakeClock)
+	for _, rule := range rules {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	return engine
+}
+
+func TestAlertingEngineCooldown(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+	critical := &countingAction{}
+	informational := &countingAction{}
+
+	engine := newTestEngine(t, fakeClock,
+		AlertRule{ID: "critical", MetricName: "battery", Enabled: true, Cooldown: 5 * time.Minute,
+			Condition: ThresholdBelow(10), Action: critical.run},
+		AlertRule{ID: "informational", MetricName: "battery", Enabled: true, Cooldown: time.Hour,
+			Condition: ThresholdBelow(10), Action: informational.run},
+	)
+
+	metric := Metric{Name: "battery", Source: "device-1", Value: 5}
+	for range 7 {
+		engine.Evaluate(metric)
+		fakeClock.Advance(2 * time.Minute)
+	}
+
+	// evaluated at 0, 2, 4, 6, 8, 10 and 12 minutes
+	if got := critical.calls["device-1"]; got != 3 {
+		t.Errorf("expected the critical rule to fire at 0, 6 and 12 minutes, got %d", got)
+	}
+
+	if got := informational.calls["device-1"]; got != 1 {
+		t.Errorf("expected the informational rule to fire once within the hour, got %d", got)
+	}
+
+	fakeClock.Set(time.Date(2025, 1, 2, 13, 0, 0, 0, time.UTC))
+	engine.Evaluate(metric)
+	if got := informational.calls["device-1"]; got != 2 {
+		t.Errorf("expected the informational rule to fire again after the hour, got %d", got)
+	}
+}
+
+func TestAlertingEngineCooldownResults(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+	action := &countingAction{}
+	engine := newTestEngine(t, fakeClock,
+		AlertRule{ID: "battery_low", MetricName: "battery", Enabled: true, Cooldown: time.Hour,
+			Condition: ThresholdBelow(10), Action: action.run},
+	)
+
+	metric := Metric{Name: "battery", Source: "device-1", Value: 5}
+	if results := engine.EvaluateWithResult(metric); len(results) != 1 || !results[0].Matched || results[0].Suppressed {
+		t.Fatalf("expected the first evaluation to fire, got %+v", results)
+	}
+
+	fakeClock.Advance(time.Minute)
+	if results := engine.EvaluateWithResult(metric); len(results) != 1 || !results[0].Matched || !results[0].Suppressed {
+		t.Errorf("expected the evaluation within the cooldown to be suppressed, got %+v", results)
+	}
+}
+
+func TestAlertingEngineZeroCooldownFiresEveryEvaluation(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+	action := &countingAction{}
+	engine := newTestEngine(t, fakeClock,
+		AlertRule{ID: "battery_low", MetricName: "battery", Enabled: true,
+			Condition: ThresholdBelow(10), Action: action.run},
+	)
+
+	for range 3 {
+		engine.Evaluate(Metric{Name: "battery", Source: "device-1", Value: 5})
+	}
+
+	if got := action.calls["device-1"]; got != 3 {
+		t.Errorf("expected the rule to fire on every evaluation, got %d", got)
+	}
+}
+
+func TestAlertingEngineCooldownPerSeries(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+	action := &countingAction{}
+	engine := newTestEngine(t, fakeClock,
+		AlertRule{ID: "battery_low", MetricName: "battery", Enabled: true, Cooldown: time.Hour,
+			Condition: ThresholdBelow(10), Action: action.run},
+	)
+
+	engine.Evaluate(Metric{Name: "battery", Source: "device-1", Value: 5})
+	engine.Evaluate(Metric{Name: "battery", Source: "device-2", Value: 5})
+
+	if action.calls["device-1"] != 1 || action.calls["device-2"] != 1 {
+		t.Errorf("expected a firing device not to silence the others, got %v", action.calls)
+	}
+}
+
+func TestAlertingEngineFailedActionIsRetried(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+	action := &countingAction{err: errors.New("ntfy unreachable")}
+	engine := newTestEngine(t, fakeClock,
+		AlertRule{ID: "battery_low", MetricName: "battery", Enabled: true, Cooldown: time.Hour,
+			Condition: ThresholdBelow(10), Action: action.run},
+	)
+
+	metric := Metric{Name: "battery", Source: "device-1", Value: 5}
+	engine.Evaluate(metric)
+	fakeClock.Advance(time.Minute)
+	engine.Evaluate(metric)
+
+	if got := action.calls["device-1"]; got != 2 {
+		t.Errorf("expected the failed action not to start the cooldown, got %d calls", got)
+	}
+}
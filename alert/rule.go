@@ -1,9 +1,22 @@
 package alert
 
-import "math"
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/timgluz/smcprober/clock"
+)
 
 const DefaultFloatTolerance = 0.0001
 
+var (
+	ErrInvalidHysteresis = fmt.Errorf("invalid hysteresis thresholds")
+)
+
 type Metric struct {
 	Name        string
 	Description string
@@ -11,6 +24,14 @@ type Metric struct {
 	Value     float64
 	Unit      string
 	Timestamp int64
+
+	// Source identifies the entity the metric belongs to, e.g. the device UUID
+	Source string
+}
+
+// Key identifies the metric series across evaluations
+func (m Metric) Key() string {
+	return m.Source + "/" + m.Name
 }
 
 type RuleCondition func(metric Metric) bool
@@ -21,6 +42,14 @@ type AlertRule struct {
 	MetricName string
 	Enabled    bool
 
+	// Cooldown suppresses the action after it fired for the same metric series until it passed,
+	// e.g. 5m for critical and 1h for informational alerts; zero fires on every evaluation
+	Cooldown time.Duration
+
+	// Schedule suppresses the action outside of the allowed hours and days,
+	// nil fires at any time, which critical rules should keep
+	Schedule *Schedule
+
 	Condition RuleCondition
 	Action    RuleAction
 }
@@ -44,6 +73,71 @@ func ThresholdBetween(min, max float64) RuleCondition {
 	}
 }
 
+// ThresholdBelowWithHysteresis creates a condition that starts firing when the value
+// drops below enter and keeps firing until it rises above exit. The gap between
+// enter and exit stops values oscillating around a single threshold from flapping,
+// so exit must be greater than enter, e.g. enter=15 and exit=20 for a battery level.
+// The firing state is kept per metric series (see Metric.Key) in memory, so it only
+// works in long-running evaluators; one-shot evaluators like smcjob keep it between runs
+// with ThresholdBelowWithHysteresisState.
+func ThresholdBelowWithHysteresis(enter, exit float64) (RuleCondition, error) {
+	return ThresholdBelowWithHysteresisState(enter, exit, NewHysteresisState())
+}
+
+// ThresholdBelowWithHysteresisState is ThresholdBelowWithHysteresis keeping the firing state in state
+func ThresholdBelowWithHysteresisState(enter, exit float64, state *HysteresisState) (RuleCondition, error) {
+	if exit <= enter {
+		return nil, fmt.Errorf("%w: exit (%v) must be greater than enter (%v)", ErrInvalidHysteresis, exit, enter)
+	}
+
+	if state == nil {
+		return nil, fmt.Errorf("%w: state cannot be nil", ErrInvalidHysteresis)
+	}
+
+	return func(metric Metric) bool {
+		return state.update(metric.Key(), metric.Value, enter, exit)
+	}, nil
+}
+
+// HysteresisState holds the metric series a hysteresis condition fires for,
+// it could be saved with Firing and restored with NewHysteresisState between runs
+type HysteresisState struct {
+	mu     sync.Mutex
+	firing map[string]bool
+}
+
+// NewHysteresisState creates a state firing for the given metric series keys
+func NewHysteresisState(firing ...string) *HysteresisState {
+	state := &HysteresisState{firing: make(map[string]bool, len(firing))}
+	for _, key := range firing {
+		state.firing[key] = true
+	}
+
+	return state
+}
+
+// Firing returns the sorted keys of the metric series the condition fires for
+func (s *HysteresisState) Firing() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Sorted(maps.Keys(s.firing))
+}
+
+func (s *HysteresisState) update(key string, value, enter, exit float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case value < enter:
+		s.firing[key] = true
+	case value > exit:
+		delete(s.firing, key)
+	}
+
+	return s.firing[key]
+}
+
 // ThresholdEquals creates a condition that checks for equality with tolerance
 func ThresholdEquals(target float64) RuleCondition {
 	return func(metric Metric) bool {
@@ -51,6 +145,66 @@ func ThresholdEquals(target float64) RuleCondition {
 	}
 }
 
+// StateEquals creates a condition that matches a numeric device state value,
+// e.g. smartcitizen.DeviceStateSleeping or smartcitizen.DeviceStateUnknown
+func StateEquals(state float64) RuleCondition {
+	return ThresholdEquals(state)
+}
+
+// StaleFor matches metrics whose timestamp is older than maxAge, e.g. a sensor that stopped
+// updating while its last value was fine; metrics without a timestamp don't match
+func StaleFor(maxAge time.Duration) RuleCondition {
+	return StaleForWithClock(maxAge, clock.Real(), false)
+}
+
+// StaleForWithClock is StaleFor with the clock telling the current time; unknownIsStale decides
+// whether metrics without a timestamp, e.g. when it couldn't be parsed, match
+func StaleForWithClock(maxAge time.Duration, c clock.Clock, unknownIsStale bool) RuleCondition {
+	return func(metric Metric) bool {
+		if metric.Timestamp == 0 {
+			return unknownIsStale
+		}
+
+		return c.Now().Sub(time.Unix(metric.Timestamp, 0)) > maxAge
+	}
+}
+
+// And matches when all conditions match, it stops at the first condition that doesn't;
+// stateful conditions like ThresholdBelowWithHysteresis should come first, so they see every metric.
+// Without conditions it always matches
+func And(conditions ...RuleCondition) RuleCondition {
+	return func(metric Metric) bool {
+		for _, condition := range conditions {
+			if !condition(metric) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// Or matches when any condition matches, it stops at the first matching condition.
+// Without conditions it never matches
+func Or(conditions ...RuleCondition) RuleCondition {
+	return func(metric Metric) bool {
+		for _, condition := range conditions {
+			if condition(metric) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Not inverts the condition
+func Not(condition RuleCondition) RuleCondition {
+	return func(metric Metric) bool {
+		return !condition(metric)
+	}
+}
+
 func FloatEquals(a, b, tolerance float64) bool {
 	return math.Abs(a-b) <= tolerance
 }
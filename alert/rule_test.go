@@ -0,0 +1,197 @@
+package alert
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/timgluz/smcprober/clock"
+)
+
+func TestThresholdBelowWithHysteresis(t *testing.T) {
+	condition, err := ThresholdBelowWithHysteresis(15, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a battery discharging below enter, oscillating between the thresholds and charged above exit
+	values := []float64{25, 16, 14, 16, 14.5, 19, 20, 21, 18}
+	want := []bool{false, false, true, true, true, true, true, false, false}
+	for i, value := range values {
+		if got := condition(Metric{Name: "battery", Source: "device-1", Value: value}); got != want[i] {
+			t.Errorf("value %v (step %d): expected %v, got %v", value, i, want[i], got)
+		}
+	}
+}
+
+func TestThresholdBelowWithHysteresisPerSeries(t *testing.T) {
+	condition, err := ThresholdBelowWithHysteresis(15, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !condition(Metric{Name: "battery", Source: "device-1", Value: 10}) {
+		t.Fatal("expected device-1 to fire")
+	}
+
+	if condition(Metric{Name: "battery", Source: "device-2", Value: 17}) {
+		t.Error("device-2 must not fire because device-1 does")
+	}
+}
+
+func TestThresholdBelowWithHysteresisInvalidThresholds(t *testing.T) {
+	for _, thresholds := range [][2]float64{{20, 15}, {15, 15}} {
+		if _, err := ThresholdBelowWithHysteresis(thresholds[0], thresholds[1]); !errors.Is(err, ErrInvalidHysteresis) {
+			t.Errorf("enter=%v exit=%v: expected ErrInvalidHysteresis, got %v", thresholds[0], thresholds[1], err)
+		}
+	}
+
+	if _, err := ThresholdBelowWithHysteresisState(15, 20, nil); !errors.Is(err, ErrInvalidHysteresis) {
+		t.Errorf("nil state: expected ErrInvalidHysteresis, got %v", err)
+	}
+}
+
+func TestHysteresisStateRestore(t *testing.T) {
+	metric := Metric{Name: "battery", Source: "device-1", Value: 10}
+
+	state := NewHysteresisState()
+	firstRun, _ := ThresholdBelowWithHysteresisState(15, 20, state)
+	firstRun(metric)
+
+	firing := state.Firing()
+	if !slices.Equal(firing, []string{metric.Key()}) {
+		t.Fatalf("expected %q to fire, got %v", metric.Key(), firing)
+	}
+
+	// the next run starts with a new condition from the saved keys
+	nextRun, _ := ThresholdBelowWithHysteresisState(15, 20, NewHysteresisState(firing...))
+	metric.Value = 17
+	if !nextRun(metric) {
+		t.Error("expected the restored state to keep firing between the thresholds")
+	}
+
+	metric.Value = 21
+	if nextRun(metric) {
+		t.Error("expected the restored state to resolve above exit")
+	}
+}
+
+// recordCalls wraps the condition and counts how often it is evaluated
+func recordCalls(condition RuleCondition, calls *int) RuleCondition {
+	return func(metric Metric) bool {
+		*calls++
+		return condition(metric)
+	}
+}
+
+func always(metric Metric) bool { return true }
+
+func never(metric Metric) bool { return false }
+
+func TestAndOrNot(t *testing.T) {
+	metric := Metric{Name: "battery", Source: "device-1", Value: 8}
+
+	tests := []struct {
+		name      string
+		condition RuleCondition
+		want      bool
+	}{
+		{name: "And all match", condition: And(ThresholdBelow(10), ThresholdAbove(5)), want: true},
+		{name: "And one fails", condition: And(ThresholdBelow(10), ThresholdAbove(9)), want: false},
+		{name: "Or one matches", condition: Or(ThresholdBelow(5), ThresholdAbove(7)), want: true},
+		{name: "Or none match", condition: Or(ThresholdBelow(5), ThresholdAbove(9)), want: false},
+		{name: "Not", condition: Not(ThresholdBelow(10)), want: false},
+		{name: "nested", condition: And(ThresholdBelow(10), Not(Or(never, ThresholdAbove(9)))), want: true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.condition(metric); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestAndOrEmpty(t *testing.T) {
+	metric := Metric{Name: "battery", Value: 8}
+
+	if !And()(metric) {
+		t.Error("expected And without conditions to match")
+	}
+
+	if Or()(metric) {
+		t.Error("expected Or without conditions not to match")
+	}
+}
+
+func TestAndOrShortCircuit(t *testing.T) {
+	metric := Metric{Name: "battery", Value: 8}
+
+	var andCalls int
+	if And(never, recordCalls(always, &andCalls))(metric) {
+		t.Error("expected And to fail")
+	}
+
+	if andCalls != 0 {
+		t.Errorf("expected And to stop at the first failing condition, got %d calls", andCalls)
+	}
+
+	var orCalls int
+	if !Or(always, recordCalls(never, &orCalls))(metric) {
+		t.Error("expected Or to match")
+	}
+
+	if orCalls != 0 {
+		t.Errorf("expected Or to stop at the first matching condition, got %d calls", orCalls)
+	}
+
+	// conditions after a matching one in And, and after a failing one in Or, are evaluated
+	var allCalls int
+	And(always, recordCalls(always, &allCalls))(metric)
+	Or(never, recordCalls(never, &allCalls))(metric)
+	if allCalls != 2 {
+		t.Errorf("expected the remaining conditions to be evaluated, got %d calls", allCalls)
+	}
+}
+
+func TestStaleForWithClock(t *testing.T) {
+	now := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFakeClock(now)
+
+	tests := []struct {
+		name           string
+		timestamp      int64
+		unknownIsStale bool
+		want           bool
+	}{
+		{name: "fresh reading", timestamp: now.Add(-time.Minute).Unix(), want: false},
+		{name: "stale reading", timestamp: now.Add(-2 * time.Hour).Unix(), want: true},
+		{name: "exactly max age", timestamp: now.Add(-time.Hour).Unix(), want: false},
+		{name: "just over max age", timestamp: now.Add(-time.Hour - time.Second).Unix(), want: true},
+		{name: "unknown timestamp is stale", timestamp: 0, unknownIsStale: true, want: true},
+		{name: "unknown timestamp is not stale", timestamp: 0, unknownIsStale: false, want: false},
+	}
+
+	for _, tt := range tests {
+		condition := StaleForWithClock(time.Hour, fakeClock, tt.unknownIsStale)
+		if got := condition(Metric{Name: "state", Source: "device-1", Timestamp: tt.timestamp}); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestStaleForWithClockAdvances(t *testing.T) {
+	now := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFakeClock(now)
+	condition := StaleForWithClock(time.Hour, fakeClock, false)
+	metric := Metric{Name: "state", Source: "device-1", Timestamp: now.Unix()}
+
+	if condition(metric) {
+		t.Fatal("expected a reading of now not to be stale")
+	}
+
+	fakeClock.Advance(time.Hour + time.Second)
+	if !condition(metric) {
+		t.Error("expected the reading to become stale as the clock advances")
+	}
+}
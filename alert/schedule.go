@@ -0,0 +1,73 @@
+package alert
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+var (
+	ErrInvalidSchedule = fmt.Errorf("invalid alert schedule")
+)
+
+// Schedule limits when the action of a rule may run, e.g. to keep non-critical device alerts
+// quiet at night. Matches outside of the schedule are suppressed, not queued: as long as the
+// condition keeps matching, the action runs on the first evaluation within the schedule.
+type Schedule struct {
+	// Days the action may run on, empty allows every day
+	Days []time.Weekday
+
+	// StartHour and EndHour bound the allowed hours as [start, end), an end before the start
+	// spans midnight, e.g. 22 to 6; equal hours allow the whole day
+	StartHour int
+	EndHour   int
+
+	// Location the hours and days are in, nil uses the local time zone
+	Location *time.Location
+}
+
+// QuietHours allows the action outside of the hours from start to end, e.g. QuietHours(22, 7)
+func QuietHours(start, end int) *Schedule {
+	return &Schedule{StartHour: end, EndHour: start}
+}
+
+func (s *Schedule) Validate() error {
+	if s.StartHour < 0 || s.StartHour > 23 || s.EndHour < 0 || s.EndHour > 23 {
+		return fmt.Errorf("%w: hours must be between 0 and 23, got %d to %d", ErrInvalidSchedule, s.StartHour, s.EndHour)
+	}
+
+	for _, day := range s.Days {
+		if day < time.Sunday || day > time.Saturday {
+			return fmt.Errorf("%w: unknown weekday %d", ErrInvalidSchedule, day)
+		}
+	}
+
+	return nil
+}
+
+// Allows reports whether the action may run at the given time, a nil schedule allows any time
+func (s *Schedule) Allows(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+
+	if s.Location != nil {
+		t = t.In(s.Location)
+	} else {
+		t = t.Local()
+	}
+
+	if len(s.Days) > 0 && !slices.Contains(s.Days, t.Weekday()) {
+		return false
+	}
+
+	hour := t.Hour()
+	switch {
+	case s.StartHour == s.EndHour:
+		return true
+	case s.StartHour < s.EndHour:
+		return hour >= s.StartHour && hour < s.EndHour
+	default:
+		return hour >= s.StartHour || hour < s.EndHour
+	}
+}
@@ -0,0 +1,126 @@
+package alert
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestScheduleAllows(t *testing.T) {
+	// 2025-01-06 is a Monday
+	monday := func(hour int) time.Time {
+		return time.Date(2025, 1, 6, hour, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		at       time.Time
+		want     bool
+	}{
+		{name: "nil schedule", schedule: nil, at: monday(3), want: true},
+		{name: "within hours", schedule: &Schedule{StartHour: 8, EndHour: 18, Location: time.UTC}, at: monday(8), want: true},
+		{name: "end is exclusive", schedule: &Schedule{StartHour: 8, EndHour: 18, Location: time.UTC}, at: monday(18), want: false},
+		{name: "before hours", schedule: &Schedule{StartHour: 8, EndHour: 18, Location: time.UTC}, at: monday(7), want: false},
+		{name: "equal hours allow the day", schedule: &Schedule{StartHour: 5, EndHour: 5, Location: time.UTC}, at: monday(23), want: true},
+		{name: "midnight wrap late", schedule: &Schedule{StartHour: 22, EndHour: 6, Location: time.UTC}, at: monday(23), want: true},
+		{name: "midnight wrap early", schedule: &Schedule{StartHour: 22, EndHour: 6, Location: time.UTC}, at: monday(5), want: true},
+		{name: "midnight wrap outside", schedule: &Schedule{StartHour: 22, EndHour: 6, Location: time.UTC}, at: monday(12), want: false},
+		{name: "allowed day", schedule: &Schedule{Days: []time.Weekday{time.Monday}, Location: time.UTC}, at: monday(12), want: true},
+		{name: "other day", schedule: &Schedule{Days: []time.Weekday{time.Saturday, time.Sunday}, Location: time.UTC}, at: monday(12), want: false},
+		{
+			name:     "day and hours",
+			schedule: &Schedule{Days: []time.Weekday{time.Monday}, StartHour: 8, EndHour: 18, Location: time.UTC},
+			at:       monday(20),
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.schedule.Allows(tt.at); got != tt.want {
+			t.Errorf("%s: expected %v at %s, got %v", tt.name, tt.want, tt.at, got)
+		}
+	}
+}
+
+func TestScheduleAllowsInLocation(t *testing.T) {
+	tokyo := time.FixedZone("UTC+9", 9*60*60)
+	schedule := &Schedule{Days: []time.Weekday{time.Tuesday}, StartHour: 8, EndHour: 18, Location: tokyo}
+
+	// Monday 23:30 UTC is Tuesday 08:30 in the location
+	if !schedule.Allows(time.Date(2025, 1, 6, 23, 30, 0, 0, time.UTC)) {
+		t.Error("expected the hour and day to be taken in the location")
+	}
+
+	// Tuesday 12:00 UTC is Tuesday 21:00 in the location
+	if schedule.Allows(time.Date(2025, 1, 7, 12, 0, 0, 0, time.UTC)) {
+		t.Error("expected 21:00 in the location to be outside of the hours")
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	schedule := QuietHours(22, 7)
+	schedule.Location = time.UTC
+
+	if schedule.StartHour != 7 || schedule.EndHour != 22 {
+		t.Fatalf("expected the allowed hours to be 7 to 22, got %d to %d", schedule.StartHour, schedule.EndHour)
+	}
+
+	tests := []struct {
+		hour int
+		want bool
+	}{
+		{hour: 21, want: true},
+		{hour: 22, want: false},
+		{hour: 0, want: false},
+		{hour: 6, want: false},
+		{hour: 7, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := schedule.Allows(time.Date(2025, 1, 6, tt.hour, 0, 0, 0, time.UTC)); got != tt.want {
+			t.Errorf("hour %d: expected %v, got %v", tt.hour, tt.want, got)
+		}
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		valid    bool
+	}{
+		{name: "whole day", schedule: Schedule{}, valid: true},
+		{name: "midnight wrap", schedule: Schedule{StartHour: 22, EndHour: 6}, valid: true},
+		{name: "weekend", schedule: Schedule{Days: []time.Weekday{time.Saturday, time.Sunday}}, valid: true},
+		{name: "hour 24", schedule: Schedule{StartHour: 8, EndHour: 24}},
+		{name: "negative hour", schedule: Schedule{StartHour: -1, EndHour: 6}},
+		{name: "unknown weekday", schedule: Schedule{Days: []time.Weekday{7}}},
+	}
+
+	for _, tt := range tests {
+		err := tt.schedule.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+
+		if !tt.valid && !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("%s: expected ErrInvalidSchedule, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestAddRuleRejectsInvalidSchedule(t *testing.T) {
+	engine := NewAlertingEngine(slog.New(slog.DiscardHandler))
+
+	err := engine.AddRule(AlertRule{ID: "quiet", MetricName: "battery", Enabled: true,
+		Schedule: &Schedule{StartHour: 22, EndHour: 25}, Condition: ThresholdBelow(10)})
+	if !errors.Is(err, ErrInvalidSchedule) {
+		t.Fatalf("expected ErrInvalidSchedule, got %v", err)
+	}
+
+	if results := engine.EvaluateWithResult(Metric{Name: "battery", Value: 5}); len(results) != 0 {
+		t.Errorf("expected the rejected rule not to be added, got %v", results)
+	}
+}
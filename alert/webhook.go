@@ -0,0 +1,62 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/timgluz/smcprober/clock"
+)
+
+// DefaultWebhookTimeout bounds a webhook call, so a slow receiver doesn't hold up the evaluation
+const DefaultWebhookTimeout = 10 * time.Second
+
+// WebhookAction posts the alert as an AlertRecord JSON to the url, e.g. to trigger own automation;
+// responses other than 2xx are returned as error. A nil client uses a client without retries,
+// as a repeated POST could trigger the automation twice
+func WebhookAction(url string, client *http.Client) RuleAction {
+	return WebhookActionWithClock(url, client, clock.Real())
+}
+
+// WebhookActionWithClock is WebhookAction with the clock telling the firedAt time of the alerts
+func WebhookActionWithClock(url string, client *http.Client, c clock.Clock) RuleAction {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+
+	return func(metric Metric, rule AlertRule) error {
+		payload, err := json.Marshal(NewAlertRecord(metric, rule, c.Now()))
+		if err != nil {
+			return err
+		}
+
+		// every call gets its own deadline, the action outlives the context it was created in
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultWebhookTimeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to call webhook: %w", err)
+		}
+		defer func() {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("webhook failed with status code: %d", resp.StatusCode)
+		}
+
+		return nil
+	}
+}
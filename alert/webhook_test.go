@@ -0,0 +1,83 @@
+package alert
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/timgluz/smcprober/clock"
+)
+
+func TestWebhookActionPostsAlertRecord(t *testing.T) {
+	records := make([]AlertRecord, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected a JSON POST, got %s %q", r.Method, r.Header.Get("Content-Type"))
+		}
+
+		var record AlertRecord
+		content, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(content, &record); err != nil {
+			t.Errorf("expected an AlertRecord, got %q: %v", content, err)
+		}
+		records = append(records, record)
+	}))
+	t.Cleanup(server.Close)
+
+	firedAt := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	action := WebhookActionWithClock(server.URL, nil, clock.NewFakeClock(firedAt))
+
+	rule := AlertRule{ID: "battery_low", Name: "Battery Level Low"}
+	if err := action(Metric{Name: "battery", Source: "device-1", Value: 12}, rule); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(records))
+	}
+
+	if !records[0].FiredAt.Equal(firedAt) || records[0].RuleID != "battery_low" || records[0].Value != 12 {
+		t.Errorf("unexpected record %+v", records[0])
+	}
+}
+
+func TestWebhookActionDoesNotRetry(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	action := WebhookAction(server.URL, nil)
+	if err := action(Metric{Name: "battery"}, AlertRule{ID: "battery_low"}); err == nil {
+		t.Fatal("expected the 503 to be returned as error")
+	}
+
+	if calls != 1 {
+		t.Errorf("expected a single POST, got %d", calls)
+	}
+}
+
+func TestWebhookActionCalledRepeatedly(t *testing.T) {
+	// the action is created once and called on every evaluation, each call gets its own deadline
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	t.Cleanup(server.Close)
+
+	action := WebhookAction(server.URL, server.Client())
+	for range 3 {
+		if err := action(Metric{Name: "battery"}, AlertRule{ID: "battery_low"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
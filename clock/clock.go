@@ -0,0 +1,59 @@
+// Package clock abstracts the current time, so time-dependent behavior like
+// staleness, cooldowns and token expiry can be tested with a FakeClock.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time, time-dependent logic takes it instead of calling time.Now
+// so that tests can control the time
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock reports the wall-clock time
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// Real returns the wall-clock, it is the default everywhere
+func Real() Clock {
+	return RealClock{}
+}
+
+// FakeClock reports a fixed time that only moves when told to, it is safe for concurrent use
+type FakeClock struct {
+	mu  sync.RWMutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.now
+}
+
+// Set moves the clock to the given time
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+// Advance moves the clock forward by the duration
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"go.yaml.in/yaml/v2"
+)
+
+const (
+	AlertRuleGroupName   = "smartcitizen_device_sensor_alerts"
+	DefaultAlertFor      = "15m"
+	DefaultAlertSeverity = "warning"
+)
+
+// ChartAlertConfig raises an alert when the value of the chart query crosses Below or Above
+type ChartAlertConfig struct {
+	Below *float64 `json:"below,omitempty"`
+	Above *float64 `json:"above,omitempty"`
+
+	// For is how long the condition must hold before the alert fires, e.g. 15m
+	For      string            `json:"for,omitempty"`
+	Severity string            `json:"severity,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+func (c ChartAlertConfig) Validate() error {
+	var errs []error
+	if c.Below == nil && c.Above == nil {
+		errs = append(errs, fmt.Errorf("alert must set below or above"))
+	}
+
+	if c.Below != nil && c.Above != nil && *c.Below > *c.Above {
+		errs = append(errs, fmt.Errorf("alert below %v must not be greater than above %v", *c.Below, *c.Above))
+	}
+
+	if c.For != "" {
+		if _, err := model.ParseDuration(c.For); err != nil {
+			errs = append(errs, fmt.Errorf("invalid alert duration %q: %w", c.For, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RuleFile is a Prometheus rule file, also accepted as the spec of a PrometheusRule resource
+type RuleFile struct {
+	Groups []RuleGroup `yaml:"groups"`
+}
+
+type RuleGroup struct {
+	Name  string      `yaml:"name"`
+	Rules []AlertRule `yaml:"rules"`
+}
+
+type AlertRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// buildAlertRules creates the alert rules of the charts with an alert, in chart order
+func buildAlertRules(config *DashboardConfig) RuleFile {
+	group := RuleGroup{Name: AlertRuleGroupName, Rules: make([]AlertRule, 0)}
+	for _, chart := range config.Charts {
+		if chart.Alert == nil {
+			continue
+		}
+
+		if chart.Alert.Below != nil {
+			group.Rules = append(group.Rules, newAlertRule(chart, "<", *chart.Alert.Below, "Low", "below"))
+		}
+
+		if chart.Alert.Above != nil {
+			group.Rules = append(group.Rules, newAlertRule(chart, ">", *chart.Alert.Above, "High", "above"))
+		}
+	}
+
+	return RuleFile{Groups: []RuleGroup{group}}
+}
+
+func newAlertRule(chart SensorChartConfig, operator string, threshold float64, suffix, direction string) AlertRule {
+	alert := chart.Alert
+
+	labels := map[string]string{"severity": DefaultAlertSeverity}
+	if alert.Severity != "" {
+		labels["severity"] = alert.Severity
+	}
+	for name, value := range alert.Labels {
+		labels[name] = value
+	}
+
+	forDuration := alert.For
+	if forDuration == "" {
+		forDuration = DefaultAlertFor
+	}
+
+	return AlertRule{
+		Alert: "SmartCitizen" + alertName(chart.Metric) + suffix,
+		// rules evaluate all devices, the dashboard variable selects a single one
+		Expr:   fmt.Sprintf("%s %s %v", strings.ReplaceAll(chart.Query, "$device", ".+"), operator, threshold),
+		For:    forDuration,
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary":     fmt.Sprintf("%s of device {{ $labels.device }} is %s %v", chart.Title, direction, threshold),
+			"description": fmt.Sprintf("%s of device {{ $labels.device }} is at {{ $value }} for %s.", chart.Title, forDuration),
+		},
+	}
+}
+
+// alertName converts the snake case metric name to the camel case alert name, e.g. pm2_5 to Pm25
+func alertName(metric string) string {
+	var name strings.Builder
+	for part := range strings.SplitSeq(metric, "_") {
+		if part == "" {
+			continue
+		}
+
+		name.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+
+	return name.String()
+}
+
+func encodeAlertRules(rules RuleFile) ([]byte, error) {
+	content, err := yaml.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	// writeOutput adds the trailing newline
+	content = bytes.TrimSuffix(content, []byte("\n"))
+	return append([]byte("# Generated by gen-device-dashboard, do not edit\n"), content...), nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-foundation-sdk/go/cog"
+	"go.yaml.in/yaml/v2"
+)
+
+func TestBuildAlertRules(t *testing.T) {
+	config := &DashboardConfig{Charts: []SensorChartConfig{
+		{Title: "Temperature", Metric: "temperature", Query: `smartcitizen_sensor_state{device="$device"}`},
+		{
+			Title: "Battery", Metric: "battery", Query: `smartcitizen_battery{device="$device"}`,
+			Alert: &ChartAlertConfig{Below: cog.ToPtr(10.0)},
+		},
+		{
+			Title: "PM2.5", Metric: "pm2_5", Query: `smartcitizen_pm2_5{device="$device"}`,
+			Alert: &ChartAlertConfig{Below: cog.ToPtr(0.0), Above: cog.ToPtr(35.5), For: "1h", Severity: "critical", Labels: map[string]string{"team": "air"}},
+		},
+	}}
+
+	rules := buildAlertRules(config)
+	if len(rules.Groups) != 1 || rules.Groups[0].Name != AlertRuleGroupName {
+		t.Fatalf("expected a single %s group, got %+v", AlertRuleGroupName, rules.Groups)
+	}
+
+	want := []AlertRule{
+		{
+			Alert:  "SmartCitizenBatteryLow",
+			Expr:   `smartcitizen_battery{device=".+"} < 10`,
+			For:    DefaultAlertFor,
+			Labels: map[string]string{"severity": DefaultAlertSeverity},
+		},
+		{
+			Alert:  "SmartCitizenPm25Low",
+			Expr:   `smartcitizen_pm2_5{device=".+"} < 0`,
+			For:    "1h",
+			Labels: map[string]string{"severity": "critical", "team": "air"},
+		},
+		{
+			Alert:  "SmartCitizenPm25High",
+			Expr:   `smartcitizen_pm2_5{device=".+"} > 35.5`,
+			For:    "1h",
+			Labels: map[string]string{"severity": "critical", "team": "air"},
+		},
+	}
+
+	got := rules.Groups[0].Rules
+	if len(got) != len(want) {
+		t.Fatalf("expected %d rules, got %+v", len(want), got)
+	}
+
+	for i, rule := range got {
+		if rule.Alert != want[i].Alert || rule.Expr != want[i].Expr || rule.For != want[i].For || !reflect.DeepEqual(rule.Labels, want[i].Labels) {
+			t.Errorf("rule %d: expected %+v, got %+v", i, want[i], rule)
+		}
+	}
+
+	if summary := got[2].Annotations["summary"]; summary != "PM2.5 of device {{ $labels.device }} is above 35.5" {
+		t.Errorf("unexpected summary %q", summary)
+	}
+}
+
+func TestBuildAlertRulesWithoutAlerts(t *testing.T) {
+	content, err := encodeAlertRules(buildAlertRules(&DashboardConfig{Charts: []SensorChartConfig{{Title: "Temperature", Query: "up"}}}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// an empty group is still a valid rule file, not a null rules list
+	if !strings.Contains(string(content), "rules: []") {
+		t.Errorf("expected an empty rules list, got:\n%s", content)
+	}
+}
+
+func TestEncodeAlertRules(t *testing.T) {
+	rules := buildAlertRules(&DashboardConfig{Charts: []SensorChartConfig{
+		{Title: "Battery", Metric: "battery", Query: "smartcitizen_battery", Alert: &ChartAlertConfig{Below: cog.ToPtr(10.0)}},
+	}})
+
+	content, err := encodeAlertRules(rules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(string(content), "# Generated by gen-device-dashboard") || strings.HasSuffix(string(content), "\n") {
+		t.Errorf("expected the header and no trailing newline, got:\n%s", content)
+	}
+
+	var decoded RuleFile
+	if err := yaml.Unmarshal(content, &decoded); err != nil {
+		t.Fatalf("expected valid YAML: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, rules) {
+		t.Errorf("expected the rules to round trip, got %+v", decoded)
+	}
+}
+
+func TestAlertName(t *testing.T) {
+	tests := map[string]string{
+		"battery":     "Battery",
+		"pm2_5":       "Pm25",
+		"noise_dba_":  "NoiseDba",
+		"_co2":        "Co2",
+		"temperature": "Temperature",
+	}
+
+	for metric, want := range tests {
+		if got := alertName(metric); got != want {
+			t.Errorf("%s: expected %q, got %q", metric, want, got)
+		}
+	}
+}
+
+func TestChartAlertConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ChartAlertConfig
+		valid  bool
+	}{
+		{name: "below", config: ChartAlertConfig{Below: cog.ToPtr(10.0)}, valid: true},
+		{name: "range", config: ChartAlertConfig{Below: cog.ToPtr(10.0), Above: cog.ToPtr(30.0), For: "30m"}, valid: true},
+		{name: "no threshold", config: ChartAlertConfig{For: "15m"}},
+		{name: "inverted range", config: ChartAlertConfig{Below: cog.ToPtr(30.0), Above: cog.ToPtr(10.0)}},
+		{name: "invalid duration", config: ChartAlertConfig{Above: cog.ToPtr(30.0), For: "15 minutes"}},
+	}
+
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if tt.valid != (err == nil) {
+			t.Errorf("%s: expected valid %v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
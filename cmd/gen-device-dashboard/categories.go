@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/grafana/grafana-foundation-sdk/go/cog"
+	"github.com/grafana/grafana-foundation-sdk/go/dashboard"
+	"github.com/timgluz/smcprober/metric"
+)
+
+const (
+	CategoryVariableName = "category"
+
+	// UncategorizedPanel groups the charts without a panel whose metric has no category
+	UncategorizedPanel = "Sensors"
+)
+
+// groupChartsByCategory puts charts without an explicit panel in the row of the category
+// their metric has in the sensor mapping
+func groupChartsByCategory(charts []SensorChartConfig, mapping map[string]metric.MetricMappingItem) {
+	categories := make(map[string]string, len(mapping))
+	for _, item := range mapping {
+		if item.Metric != "" && item.Category != "" {
+			categories[item.Metric] = item.Category
+		}
+	}
+
+	for i := range charts {
+		if charts[i].Panel != "" {
+			continue
+		}
+
+		charts[i].Panel = UncategorizedPanel
+		if category, ok := categories[charts[i].Metric]; ok {
+			charts[i].Panel = category
+		}
+	}
+}
+
+// mappingCategories returns the sorted, unique categories of the sensor mapping
+func mappingCategories(mapping map[string]metric.MetricMappingItem) []string {
+	categories := make(map[string]struct{})
+	for _, item := range mapping {
+		if item.Category != "" {
+			categories[item.Category] = struct{}{}
+		}
+	}
+
+	return slices.Sorted(maps.Keys(categories))
+}
+
+// newCategoryVariable lists the categories that have sensor metrics; the sensor metrics
+// are named <namespace>_sensor_<category>_<metric>, the regex extracts the category
+func newCategoryVariable(categories []string, datasource string) *dashboard.QueryVariableBuilder {
+	pattern := fmt.Sprintf("^%s_sensor_(%s)_", DefaultNamespace, strings.Join(categories, "|"))
+
+	variable := dashboard.NewQueryVariableBuilder(CategoryVariableName).
+		Label("sensor category").
+		Description("categories of the sensor mapping").
+		Query(dashboard.StringOrMap{
+			String: cog.ToPtr(fmt.Sprintf("metrics(%s.+)", pattern)),
+		}).
+		Regex("/" + pattern + "/").
+		Refresh(dashboard.VariableRefreshOnTimeRangeChanged).
+		Sort(dashboard.VariableSortAlphabeticalCaseInsensitiveAsc).
+		Multi(true).
+		IncludeAll(true)
+	if datasource != "" {
+		variable.Datasource(prometheusDatasource(datasource))
+	}
+
+	return variable
+}
+
+// newCategoryRow is repeated for every selected category, showing all sensors of the category
+func newCategoryRow(datasource string) *dashboard.RowBuilder {
+	return dashboard.NewRowBuilder("Category: $" + CategoryVariableName).
+		Repeat(CategoryVariableName).
+		WithPanel(newChartPanel(SensorChartConfig{
+			Title:      "$" + CategoryVariableName + " sensors",
+			Type:       ChartTypeTimeSeries,
+			Query:      fmt.Sprintf("{__name__=~\"%s_sensor_${%s}_.+\", device=~\"$device\"}", DefaultNamespace, CategoryVariableName),
+			Legend:     "{{__name__}}",
+			Datasource: datasource,
+			Span:       MaxPanelSpan,
+			Height:     8,
+		}))
+}
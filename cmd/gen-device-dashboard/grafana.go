@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/grafana/grafana-foundation-sdk/go/dashboard"
+	"github.com/timgluz/smcprober/httpclient"
+)
+
+const (
+	EnvGrafanaURL          = "GRAFANA_URL"
+	DefaultGrafanaTokenEnv = "GRAFANA_TOKEN" // #nosec G101 -- This is an environment variable name, not a credential
+)
+
+var (
+	ErrDashboardExists = fmt.Errorf("dashboard already exists or was changed in Grafana, use -overwrite to replace it")
+)
+
+// GrafanaPushConfig selects the Grafana instance and how the dashboard is saved
+type GrafanaPushConfig struct {
+	URL       string
+	TokenEnv  string
+	FolderUID string
+	// Overwrite replaces an existing dashboard with the same uid, otherwise saving fails
+	Overwrite bool
+}
+
+func (c GrafanaPushConfig) Validate() error {
+	var errs []error
+	if _, err := url.ParseRequestURI(c.URL); err != nil {
+		errs = append(errs, fmt.Errorf("invalid Grafana URL %q, set -grafana-url or %s: %w", c.URL, EnvGrafanaURL, err))
+	}
+
+	if os.Getenv(c.TokenEnv) == "" {
+		errs = append(errs, fmt.Errorf("environment variable %s must be set", c.TokenEnv))
+	}
+
+	return errors.Join(errs...)
+}
+
+type grafanaSaveRequest struct {
+	Dashboard dashboard.Dashboard `json:"dashboard"`
+	FolderUID string              `json:"folderUid,omitempty"`
+	Overwrite bool                `json:"overwrite"`
+	Message   string              `json:"message,omitempty"`
+}
+
+// GrafanaSaveResult is the response of the Grafana dashboard API
+type GrafanaSaveResult struct {
+	ID      int    `json:"id"`
+	UID     string `json:"uid"`
+	URL     string `json:"url"`
+	Status  string `json:"status"`
+	Version int    `json:"version"`
+}
+
+// pushDashboard creates or updates the dashboard via the Grafana HTTP API and returns
+// the absolute URL of the saved dashboard
+func pushDashboard(ctx context.Context, config GrafanaPushConfig, dashboardObj dashboard.Dashboard) (string, error) {
+	endpoint, err := url.JoinPath(config.URL, "/api/dashboards/db")
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(grafanaSaveRequest{
+		Dashboard: dashboardObj,
+		FolderUID: config.FolderUID,
+		Overwrite: config.Overwrite,
+		Message:   "Generated by gen-device-dashboard",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+os.Getenv(config.TokenEnv))
+
+	resp, err := httpclient.NewDefaultHTTPClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close response body: %v\n", closeErr)
+		}
+	}()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusPreconditionFailed:
+		return "", fmt.Errorf("%w: %s", ErrDashboardExists, strings.TrimSpace(string(content)))
+	default:
+		return "", fmt.Errorf("failed to save dashboard with status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	var result GrafanaSaveResult
+	if err := json.Unmarshal(content, &result); err != nil {
+		return "", fmt.Errorf("failed to decode Grafana response: %w", err)
+	}
+
+	return url.JoinPath(config.URL, result.URL)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-foundation-sdk/go/dashboard"
+)
+
+const testGrafanaTokenEnv = "TEST_GRAFANA_TOKEN"
+
+// savedDashboard is the request body as received by the Grafana API
+type savedDashboard struct {
+	Dashboard struct {
+		UID   string `json:"uid"`
+		Title string `json:"title"`
+	} `json:"dashboard"`
+	FolderUID string `json:"folderUid"`
+	Overwrite bool   `json:"overwrite"`
+}
+
+func newTestDashboard(t *testing.T) dashboard.Dashboard {
+	t.Helper()
+
+	dashboardObj, err := dashboard.NewDashboardBuilder("Device").Uid("smartcitizen-device-details").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dashboardObj
+}
+
+func TestPushDashboard(t *testing.T) {
+	t.Setenv(testGrafanaTokenEnv, "glsa_token")
+
+	var saved savedDashboard
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/grafana/api/dashboards/db" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		if got := r.Header.Get("Authorization"); got != "Bearer glsa_token" {
+			t.Errorf("expected the token of the environment variable, got %q", got)
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&saved); err != nil {
+			t.Errorf("unexpected body: %v", err)
+		}
+
+		_, _ = w.Write([]byte(`{"id": 1, "uid": "smartcitizen-device-details", "url": "/d/smartcitizen-device-details/device", "status": "success", "version": 2}`))
+	}))
+	t.Cleanup(server.Close)
+
+	config := GrafanaPushConfig{URL: server.URL + "/grafana", TokenEnv: testGrafanaTokenEnv, FolderUID: "sensors", Overwrite: true}
+	dashboardURL, err := pushDashboard(context.Background(), config, newTestDashboard(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := server.URL + "/grafana/d/smartcitizen-device-details/device"; dashboardURL != want {
+		t.Errorf("expected the absolute dashboard URL %q, got %q", want, dashboardURL)
+	}
+
+	if saved.Dashboard.UID != "smartcitizen-device-details" || saved.Dashboard.Title != "Device" {
+		t.Errorf("expected the dashboard in the request, got %+v", saved.Dashboard)
+	}
+
+	if saved.FolderUID != "sensors" || !saved.Overwrite {
+		t.Errorf("expected the folder and overwrite in the request, got %+v", saved)
+	}
+}
+
+func TestPushDashboardFailures(t *testing.T) {
+	t.Setenv(testGrafanaTokenEnv, "glsa_token")
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+		message string
+	}{
+		{
+			name:    "exists without overwrite",
+			status:  http.StatusPreconditionFailed,
+			body:    `{"message": "A dashboard with the same uid already exists", "status": "name-exists"}`,
+			wantErr: ErrDashboardExists,
+			message: "name-exists",
+		},
+		{name: "invalid token", status: http.StatusUnauthorized, body: `{"message": "invalid API key"}`, message: "status code: 401"},
+		{name: "invalid response", status: http.StatusOK, body: `<html>`, message: "failed to decode Grafana response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			t.Cleanup(server.Close)
+
+			config := GrafanaPushConfig{URL: server.URL, TokenEnv: testGrafanaTokenEnv}
+			_, err := pushDashboard(context.Background(), config, newTestDashboard(t))
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("expected an error with %q, got %v", tt.message, err)
+			}
+
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGrafanaPushConfigValidate(t *testing.T) {
+	t.Setenv(testGrafanaTokenEnv, "glsa_token")
+	t.Setenv("TEST_GRAFANA_EMPTY_TOKEN", "")
+
+	tests := []struct {
+		name   string
+		config GrafanaPushConfig
+		valid  bool
+	}{
+		{name: "valid", config: GrafanaPushConfig{URL: "https://grafana.example.com", TokenEnv: testGrafanaTokenEnv}, valid: true},
+		{name: "missing URL", config: GrafanaPushConfig{TokenEnv: testGrafanaTokenEnv}},
+		{name: "relative URL", config: GrafanaPushConfig{URL: "grafana.example.com", TokenEnv: testGrafanaTokenEnv}},
+		{name: "empty token", config: GrafanaPushConfig{URL: "https://grafana.example.com", TokenEnv: "TEST_GRAFANA_EMPTY_TOKEN"}},
+	}
+
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if tt.valid != (err == nil) {
+			t.Errorf("%s: expected valid %v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-foundation-sdk/go/cog"
+	"github.com/joho/godotenv"
+	"github.com/timgluz/smcprober/metric"
+	"github.com/timgluz/smcprober/smartcitizen"
+)
+
+const (
+	DefaultExporterConfigPath = "configs/config.json"
+	DefaultNamespace          = "smartcitizen"
+)
+
+// grafanaUnits maps the units reported by the SmartCitizen API to Grafana unit ids
+var grafanaUnits = map[string]string{
+	"%":     "percent",
+	"ºC":    "celsius",
+	"°C":    "celsius",
+	"kPa":   "pressurekpa",
+	"dBA":   "dB",
+	"dBm":   "dBm",
+	"Lux":   "lux",
+	"lux":   "lux",
+	"ppm":   "ppm",
+	"ppb":   "ppb",
+	"ug/m3": "conμgm3",
+	"µg/m3": "conμgm3",
+}
+
+// grafanaUnit returns the Grafana unit of the sensor unit, unknown units are shown as a suffix
+func grafanaUnit(unit string) string {
+	if unit == "" {
+		return ""
+	}
+
+	if grafanaUnit, ok := grafanaUnits[unit]; ok {
+		return grafanaUnit
+	}
+
+	return "suffix:" + unit
+}
+
+// ExporterConfig is the subset of the exporter configuration needed to reach the API
+// and to derive the metric names the exporter emits
+type ExporterConfig struct {
+	Namespace  string `json:"namespace"`
+	DotEnvPath string `json:"dotenv_path"`
+
+	Smc           smartcitizen.Config                 `json:"smartcitizen"`
+	SensorMapping map[string]metric.MetricMappingItem `json:"sensor_mapping"`
+}
+
+func (c *ExporterConfig) ApplyDefaults() {
+	if c.Namespace == "" {
+		c.Namespace = DefaultNamespace
+	}
+
+	c.Smc.ApplyDefaults()
+}
+
+func loadExporterConfig(path string) (*ExporterConfig, error) {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var config ExporterConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode exporter config %s: %w", path, err)
+	}
+
+	// the .env file may hold the environment overrides, load it before applying them
+	if config.DotEnvPath != "" {
+		if err := godotenv.Load(config.DotEnvPath); err != nil {
+			return nil, fmt.Errorf("failed to load .env file: %w", err)
+		}
+	}
+
+	if err := config.Smc.ApplyEnv(); err != nil {
+		return nil, err
+	}
+	config.ApplyDefaults()
+
+	return &config, nil
+}
+
+// fetchLiveDevice fetches the device detail with the exporter credentials,
+// or anonymously when the exporter runs in public mode
+func fetchLiveDevice(ctx context.Context, config *ExporterConfig, deviceID int, logger *slog.Logger) (*smartcitizen.DeviceDetail, error) {
+	// the metrics of the provider are not exposed, keep them out of the default registry
+	registry := metric.NewNamespacedRegistryWithRegisterer(config.Namespace, nil, logger)
+	provider, err := smartcitizen.NewAuthenticatedProvider(ctx, config.Smc,
+		smartcitizen.NewCredentialProvider(config.Smc), registry, logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Smc.PublicMode {
+		return provider.GetPublicDevice(ctx, deviceID)
+	}
+
+	return provider.GetDevice(ctx, deviceID)
+}
+
+// generateDashboardConfig creates a gauge per sensor of the device, grouped in rows by the
+// category of the sensor mapping; the metric names follow the exporter naming
+func generateDashboardConfig(device *smartcitizen.DeviceDetail, mapping map[string]metric.MetricMappingItem, namespace string) *DashboardConfig {
+	config := &DashboardConfig{
+		Title: "SmartCitizen Device details",
+		Charts: []SensorChartConfig{
+			{
+				Title:   "Device Details",
+				Metric:  "device_info",
+				Panel:   DevicePanel,
+				Type:    ChartTypeTable,
+				Query:   fmt.Sprintf("group by (name, uuid, description) (%s_device_info{uuid=~\"$device\"})", namespace),
+				Instant: true,
+				Span:    12,
+			},
+		},
+	}
+
+	sensors := slices.Clone(device.Data.Sensors)
+	slices.SortFunc(sensors, func(a, b smartcitizen.DeviceSensor) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	for _, sensor := range sensors {
+		config.Charts = append(config.Charts, newSensorChartConfig(sensor, mapping, namespace))
+	}
+
+	return config
+}
+
+func newSensorChartConfig(sensor smartcitizen.DeviceSensor, mapping map[string]metric.MetricMappingItem, namespace string) SensorChartConfig {
+	chart := SensorChartConfig{
+		Title: sensor.Name,
+		Type:  ChartTypeGauge,
+		Unit:  grafanaUnit(sensor.Unit),
+	}
+
+	if chart.Unit == "percent" {
+		chart.Min, chart.Max = cog.ToPtr(0.0), cog.ToPtr(100.0)
+	}
+
+	item, ok := mapping[sensor.Name]
+	if !ok || item.Metric == "" {
+		// unmapped sensors share the generic state metric, select them by name
+		chart.Metric = "state"
+		chart.Panel = UncategorizedPanel
+		chart.Query = fmt.Sprintf("%s_sensor_state{device=~\"$device\", name=%s}", namespace, strconv.Quote(sensor.Name))
+		return chart
+	}
+
+	chart.Metric = item.Metric
+	chart.Panel = item.Category
+	chart.Query = fmt.Sprintf("%s_sensor_%s{device=~\"$device\"}", namespace, item.MetricName())
+	return chart
+}
@@ -1,16 +1,27 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 
 	"github.com/grafana/grafana-foundation-sdk/go/cog"
 	"github.com/grafana/grafana-foundation-sdk/go/dashboard"
+	"github.com/grafana/grafana-foundation-sdk/go/gauge"
 	"github.com/grafana/grafana-foundation-sdk/go/prometheus"
+	"github.com/grafana/grafana-foundation-sdk/go/stat"
+	"github.com/grafana/grafana-foundation-sdk/go/timeseries"
+	"github.com/timgluz/smcprober/logging"
+	"github.com/timgluz/smcprober/metric"
 )
 
 const (
@@ -20,13 +31,31 @@ const (
 	MaxPanelSpan      = 24
 	DefaultSpan       = 8 // 24 / 3 columns
 	DefaultChartType  = "gauge"
+	DefaultRefresh    = "5m"
+	DefaultTimeFrom   = "now-1h"
+	DefaultTimeTo     = "now"
 
 	ChartTypeGauge      = "gauge"
+	ChartTypeStat       = "stat"
 	ChartTypeTimeSeries = "timeseries"
 	ChartTypeTable      = "table"
 	ChartTypeAlertList  = "alertlist"
+
+	// DevicePanel is the row of device information, it always comes first
+	DevicePanel = "device"
+
+	// EmitDashboard prints the dashboard JSON, EmitCharts the chart config it was built from
+	EmitDashboard = "dashboard"
+	EmitCharts    = "charts"
+
+	// ModeDetail generates the dashboard of a selected device, ModeOverview the fleet overview
+	ModeDetail   = "detail"
+	ModeOverview = "overview"
 )
 
+// refreshPattern matches the refresh intervals Grafana accepts
+var refreshPattern = regexp.MustCompile(`^[1-9][0-9]*[smhd]$`)
+
 type SensorChartConfig struct {
 	Title   string `json:"title"`
 	Metric  string `json:"metric"`
@@ -36,102 +65,469 @@ type SensorChartConfig struct {
 	Instant bool   `json:"instant,omitempty"`
 	Span    uint32 `json:"span,omitempty"`
 	Height  uint32 `json:"height,omitempty"`
+
+	// Legend is the legend format of the query, e.g. {{name}}
+	Legend string `json:"legend,omitempty"`
+	// Datasource is the uid of the Prometheus datasource, Grafana uses its default datasource if empty
+	Datasource string `json:"datasource,omitempty"`
+
+	// Order sorts the charts within the row, charts with the same order keep the config order
+	Order int `json:"order,omitempty"`
+	// GridPos places the chart at a fixed grid position instead of after the previous chart
+	GridPos *ChartGridPos `json:"grid_pos,omitempty"`
+
+	// Unit is a Grafana unit id, e.g. percent, celsius or suffix:ppm
+	Unit     string   `json:"unit,omitempty"`
+	Decimals *float64 `json:"decimals,omitempty"`
+	// Min and Max fix the range of gauges and axes, Grafana derives it from the data when unset
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+
+	// Thresholds color gauge and stat panels by value, in ascending order;
+	// the first step may omit the value to color everything below the next step
+	Thresholds []ThresholdStep `json:"thresholds,omitempty"`
+
+	// Alert generates an alerting rule for the chart query, see -rules-output
+	Alert *ChartAlertConfig `json:"alert,omitempty"`
+}
+
+// ThresholdStep colors values from Value up to the next step, Color is a Grafana color name or hex code
+type ThresholdStep struct {
+	Value *float64 `json:"value,omitempty"`
+	Color string   `json:"color"`
+}
+
+// Warnings reports settings that are adjusted instead of honored, the chart is still usable
+func (c SensorChartConfig) Warnings() []string {
+	var warnings []string
+	if c.Span > MaxPanelSpan {
+		warnings = append(warnings, fmt.Sprintf("chart %q: span %d exceeds the grid width, clamped to %d", c.Title, c.Span, MaxPanelSpan))
+	}
+
+	if c.Height > MaxPanelHeight {
+		warnings = append(warnings, fmt.Sprintf("chart %q: height %d exceeds the maximum, clamped to %d", c.Title, c.Height, MaxPanelHeight))
+	}
+
+	if c.GridPos != nil && c.GridPos.X+panelSize(c.Span, DefaultSpan, MaxPanelSpan) > MaxPanelSpan {
+		warnings = append(warnings, fmt.Sprintf("chart %q: grid position x %d puts the chart beyond the grid width", c.Title, c.GridPos.X))
+	}
+
+	return warnings
+}
+
+// Validate reports all problems of the chart at once
+func (c SensorChartConfig) Validate() error {
+	var errs []error
+	if c.Query == "" {
+		errs = append(errs, fmt.Errorf("chart %q: query must not be empty", c.Title))
+	}
+
+	if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+		errs = append(errs, fmt.Errorf("chart %q: min %v must not be greater than max %v", c.Title, *c.Min, *c.Max))
+	}
+
+	for _, err := range validateThresholds(c.Thresholds) {
+		errs = append(errs, fmt.Errorf("chart %q: %w", c.Title, err))
+	}
+
+	if c.Alert != nil {
+		if err := c.Alert.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("chart %q: %w", c.Title, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateThresholds checks that the steps have colors and strictly ascending values
+func validateThresholds(steps []ThresholdStep) []error {
+	var errs []error
+	var previous *float64
+	for i, step := range steps {
+		if step.Color == "" {
+			errs = append(errs, fmt.Errorf("threshold %d: color must not be empty", i))
+		}
+
+		if step.Value == nil {
+			if i > 0 {
+				errs = append(errs, fmt.Errorf("threshold %d: only the first threshold may omit the value", i))
+			}
+			continue
+		}
+
+		if previous != nil && *step.Value <= *previous {
+			errs = append(errs, fmt.Errorf("threshold %d: value %v must be greater than the previous %v", i, *step.Value, *previous))
+		}
+		previous = step.Value
+	}
+
+	return errs
+}
+
+// ChartGridPos is the top left corner of the chart in the 24 columns wide grid;
+// Grafana treats the origin as unset, so (0, 0) falls back to the automatic layout
+type ChartGridPos struct {
+	X uint32 `json:"x"`
+	Y uint32 `json:"y"`
 }
 
 type DashboardConfig struct {
 	Title  string              `json:"title"`
 	Charts []SensorChartConfig `json:"charts"`
+
+	// Rows orders the rows after the device row, unlisted rows follow alphabetically
+	Rows []string `json:"rows,omitempty"`
+
+	// Datasource is the uid of the Prometheus datasource of charts without their own datasource
+	Datasource string `json:"datasource,omitempty"`
+
+	// Refresh is the auto refresh interval, e.g. 30s or 5m; TimeFrom and TimeTo the default
+	// time range in Grafana syntax, e.g. now-7d
+	Refresh  string `json:"refresh,omitempty"`
+	TimeFrom string `json:"time_from,omitempty"`
+	TimeTo   string `json:"time_to,omitempty"`
+
+	// CategoryVariable adds a sensor category variable and a row for each selected category
+	CategoryVariable bool `json:"category_variable,omitempty"`
+	// Categories of the category variable, taken from the sensor mapping of -exporter-config if empty
+	Categories []string `json:"categories,omitempty"`
+}
+
+func (c *DashboardConfig) ApplyDefaults() {
+	if c.Refresh == "" {
+		c.Refresh = DefaultRefresh
+	}
+
+	if c.TimeFrom == "" {
+		c.TimeFrom = DefaultTimeFrom
+	}
+
+	if c.TimeTo == "" {
+		c.TimeTo = DefaultTimeTo
+	}
+}
+
+func (c *DashboardConfig) Validate() error {
+	var errs []error
+	if !refreshPattern.MatchString(c.Refresh) {
+		errs = append(errs, fmt.Errorf("invalid refresh %q, expected a number with a unit of s, m, h or d, e.g. 5m", c.Refresh))
+	}
+
+	if c.CategoryVariable && len(c.Categories) == 0 {
+		errs = append(errs, fmt.Errorf("category variable requires categories or a sensor mapping with categories"))
+	}
+
+	for _, chart := range c.Charts {
+		if err := chart.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 func main() {
 	var configPath string
+	var exporterConfigPath string
+	var deviceID int
+	var emit string
+	var outputPath string
+	var rulesOutputPath string
+	var pretty bool
+	var push bool
+	var pushConfig GrafanaPushConfig
+	var mode string
 	flag.StringVar(&configPath, "config", "configs/device-dashboard.json", "Path to configuration file")
+	flag.StringVar(&outputPath, "output", "", "Path to output JSON file, parent directories are created; prints to stdout if empty")
+	flag.StringVar(&rulesOutputPath, "rules-output", "", "Path to write the Prometheus alerting rules YAML of the chart alerts to")
+	flag.BoolVar(&pretty, "pretty", true, "Indent the JSON output, -pretty=false emits compact JSON for API uploads")
+	flag.BoolVar(&push, "push", false, "Save the dashboard in Grafana via its HTTP API")
+	flag.StringVar(&pushConfig.URL, "grafana-url", os.Getenv(EnvGrafanaURL), "Grafana base URL, used with -push")
+	flag.StringVar(&pushConfig.TokenEnv, "grafana-token-env", DefaultGrafanaTokenEnv, "Environment variable with the Grafana API token, used with -push")
+	flag.StringVar(&pushConfig.FolderUID, "grafana-folder", "", "UID of the Grafana folder to save the dashboard in, used with -push")
+	flag.BoolVar(&pushConfig.Overwrite, "overwrite", true, "Replace the dashboard if it already exists in Grafana, used with -push")
+	flag.IntVar(&deviceID, "device", 0, "Generate the charts from the sensors of the live device with this ID instead of the config file")
+	flag.StringVar(&exporterConfigPath, "exporter-config", DefaultExporterConfigPath, "Path to the exporter configuration, used with -device")
+	flag.StringVar(&emit, "emit", EmitDashboard, "Output the generated dashboard or its chart config: dashboard, charts")
+	flag.StringVar(&mode, "mode", ModeDetail, "Dashboard to generate: detail of a selected device from the chart config, or overview of all devices")
 	flag.Parse()
 
-	dashboardConfig, err := loadDashboardConfig(configPath)
-	if err != nil {
-		fmt.Println("Error loading dashboard config:", err)
+	if mode != ModeDetail && mode != ModeOverview {
+		fmt.Println("Invalid -mode value, expected detail or overview:", mode)
 		os.Exit(1)
 	}
 
-	if len(dashboardConfig.Charts) == 0 {
-		fmt.Println("No charts defined in the dashboard config")
+	if emit != EmitDashboard && emit != EmitCharts {
+		fmt.Println("Invalid -emit value, expected dashboard or charts:", emit)
+		os.Exit(1)
+	}
+
+	if push {
+		if emit != EmitDashboard {
+			fmt.Println("-push requires -emit dashboard")
+			os.Exit(1)
+		}
+
+		if err := pushConfig.Validate(); err != nil {
+			fmt.Println("Invalid Grafana configuration:")
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if mode == ModeOverview && (emit != EmitDashboard || rulesOutputPath != "") {
+		fmt.Println("-mode overview has no chart config, it supports neither -emit charts nor -rules-output")
 		os.Exit(1)
 	}
 
-	dashboardJSON, err := buildDashboard(dashboardConfig)
+	var result any
+	if mode == ModeOverview {
+		dashboardObj, err := buildOverviewDashboard()
+		if err != nil {
+			fmt.Println("Error building dashboard:", err)
+			os.Exit(1)
+		}
+		result = dashboardObj
+	} else {
+		dashboardConfig, err := prepareDashboardConfig(configPath, exporterConfigPath, deviceID)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if rulesOutputPath != "" {
+			rules, err := encodeAlertRules(buildAlertRules(dashboardConfig))
+			if err != nil {
+				fmt.Println("Error encoding alerting rules:", err)
+				os.Exit(1)
+			}
+
+			if err := writeOutput(rulesOutputPath, rules); err != nil {
+				fmt.Println("Error writing alerting rules:", err)
+				os.Exit(1)
+			}
+		}
+
+		result = dashboardConfig
+		if emit == EmitDashboard {
+			dashboardObj, err := buildDashboard(dashboardConfig)
+			if err != nil {
+				fmt.Println("Error building dashboard:", err)
+				os.Exit(1)
+			}
+			result = dashboardObj
+		}
+	}
+
+	if dashboardObj, ok := result.(dashboard.Dashboard); ok && push {
+		dashboardURL, err := pushDashboard(context.Background(), pushConfig, dashboardObj)
+		if err != nil {
+			fmt.Println("Error pushing dashboard to Grafana:", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(os.Stderr, "Dashboard saved in Grafana:", dashboardURL)
+		// the dashboard is only written out when requested explicitly
+		if outputPath == "" {
+			return
+		}
+	}
+
+	content, err := encodeJSON(result, pretty)
 	if err != nil {
-		fmt.Println("Error building dashboard:", err)
+		fmt.Println("Error encoding output:", err)
 		os.Exit(1)
 	}
 
-	if dashboardJSON == nil {
-		fmt.Println("Generated dashboard JSON is nil")
+	if err := writeOutput(outputPath, content); err != nil {
+		fmt.Println("Error writing output:", err)
 		os.Exit(1)
 	}
+}
+
+// prepareDashboardConfig loads the chart config of the detail dashboard, from the config file
+// or from the live device, and validates it
+func prepareDashboardConfig(configPath, exporterConfigPath string, deviceID int) (*DashboardConfig, error) {
+	var dashboardConfig *DashboardConfig
+	var err error
+	if deviceID > 0 {
+		dashboardConfig, err = loadLiveDashboardConfig(exporterConfigPath, deviceID)
+	} else {
+		dashboardConfig, err = loadDashboardConfig(configPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading dashboard config: %w", err)
+	}
+
+	if len(dashboardConfig.Charts) == 0 {
+		return nil, fmt.Errorf("no charts defined in the dashboard config")
+	}
+
+	dashboardConfig.ApplyDefaults()
+
+	if dashboardConfig.CategoryVariable && len(dashboardConfig.Categories) == 0 {
+		exporterConfig, err := loadExporterConfig(exporterConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("error loading sensor mapping for the category variable: %w", err)
+		}
+
+		dashboardConfig.Categories = mappingCategories(exporterConfig.SensorMapping)
+	}
+
+	if slices.ContainsFunc(dashboardConfig.Charts, func(chart SensorChartConfig) bool { return chart.Panel == "" }) {
+		var mapping map[string]metric.MetricMappingItem
+		exporterConfig, err := loadExporterConfig(exporterConfigPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: no sensor mapping to group charts without a panel by category:", err)
+		} else {
+			mapping = exporterConfig.SensorMapping
+		}
+
+		groupChartsByCategory(dashboardConfig.Charts, mapping)
+	}
+
+	if err := dashboardConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid dashboard config:\n%w", err)
+	}
+
+	// stdout is reserved for the generated JSON
+	for _, chart := range dashboardConfig.Charts {
+		for _, warning := range chart.Warnings() {
+			fmt.Fprintln(os.Stderr, "Warning:", warning)
+		}
+	}
+
+	return dashboardConfig, nil
+}
+
+func encodeJSON(v any, pretty bool) ([]byte, error) {
+	if pretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
 
-	fmt.Println(string(dashboardJSON))
+	return json.Marshal(v)
 }
 
-func buildDashboard(config *DashboardConfig) ([]byte, error) {
+// writeOutput writes the content with a trailing newline to the file, or to stdout if the path is empty
+func writeOutput(path string, content []byte) error {
+	content = append(content, '\n')
+	if path == "" {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+
+	// Clean the path to prevent path traversal attacks
+	cleanPath := filepath.Clean(path)
+	if err := os.MkdirAll(filepath.Dir(cleanPath), 0o750); err != nil {
+		return err
+	}
+
+	return os.WriteFile(cleanPath, content, 0o600)
+}
+
+func buildDashboard(config *DashboardConfig) (dashboard.Dashboard, error) {
 	if config == nil {
-		return nil, fmt.Errorf("dashboard config is nil")
+		return dashboard.Dashboard{}, fmt.Errorf("dashboard config is nil")
 	}
 
 	builder := dashboard.NewDashboardBuilder(config.Title).
 		Uid("smartcitizen-device-details").
 		Tags([]string{"smartcitizen", "device", "sensors"}).
-		Refresh("5m").
-		Time("now-1h", "now").
-		Editable().
-		WithVariable(
-			dashboard.NewQueryVariableBuilder("device").
-				Label("name of selected device").
-				Description("name of selected device").
-				Query(dashboard.StringOrMap{
-					String: cog.ToPtr("label_values(smartcitizen_device_info,uuid)"),
-				}).
-				Refresh(dashboard.VariableRefreshOnTimeRangeChanged).       // refresh=1 in JSON
-				Sort(dashboard.VariableSortAlphabeticalCaseInsensitiveAsc). // sort=2 in JSON
-				Multi(false).
-				IncludeAll(false),
-		)
+		Refresh(config.Refresh).
+		Time(config.TimeFrom, config.TimeTo).
+		Editable()
+
+	deviceVariable := dashboard.NewQueryVariableBuilder("device").
+		Label("name of selected device").
+		Description("name of selected device").
+		Query(dashboard.StringOrMap{
+			String: cog.ToPtr("label_values(smartcitizen_device_info,uuid)"),
+		}).
+		Refresh(dashboard.VariableRefreshOnTimeRangeChanged).       // refresh=1 in JSON
+		Sort(dashboard.VariableSortAlphabeticalCaseInsensitiveAsc). // sort=2 in JSON
+		Multi(false).
+		IncludeAll(false)
+	if config.Datasource != "" {
+		deviceVariable.Datasource(prometheusDatasource(config.Datasource))
+	}
+	builder.WithVariable(deviceVariable)
 
 	var groupedCharts = make(map[string][]SensorChartConfig)
 	for _, sensor := range config.Charts {
+		sensor.Datasource = cmp.Or(sensor.Datasource, config.Datasource)
 		groupedCharts[sensor.Panel] = append(groupedCharts[sensor.Panel], sensor)
 	}
 
 	// add device state panel first
 	rowBuilder := dashboard.NewRowBuilder("Device Information").Collapsed(false)
-	for _, chart := range groupedCharts["device"] {
+	for _, chart := range sortCharts(groupedCharts[DevicePanel]) {
 		rowBuilder.WithPanel(newChartPanel(chart))
 	}
 	builder.WithRow(rowBuilder)
-	delete(groupedCharts, "device")
+	delete(groupedCharts, DevicePanel)
 
-	// add device sensor panels
-	for panelName, charts := range groupedCharts {
+	// add device sensor panels, in a stable order so the generated dashboard is diffable
+	for _, panelName := range orderPanelNames(groupedCharts, config.Rows) {
 		rowBuilder := dashboard.NewRowBuilder(panelName)
 
-		for _, chart := range charts {
+		for _, chart := range sortCharts(groupedCharts[panelName]) {
 			rowBuilder.WithPanel(newChartPanel(chart))
 		}
 
 		builder.WithRow(rowBuilder)
 	}
 
-	dashboardObj, err := builder.Build()
-	if err != nil {
-		return nil, err
+	if config.CategoryVariable {
+		builder.WithVariable(newCategoryVariable(config.Categories, config.Datasource))
+		builder.WithRow(newCategoryRow(config.Datasource))
 	}
 
-	dashboardJSON, err := json.MarshalIndent(dashboardObj, "", "  ")
-	if err != nil {
-		return nil, err
+	return builder.Build()
+}
+
+// prometheusDatasource references the Prometheus datasource with the uid
+func prometheusDatasource(uid string) dashboard.DataSourceRef {
+	return dashboard.DataSourceRef{
+		Type: cog.ToPtr("prometheus"),
+		Uid:  cog.ToPtr(uid),
+	}
+}
+
+// orderPanelNames returns the configured rows that have charts, followed by the remaining rows sorted by name
+func orderPanelNames(groupedCharts map[string][]SensorChartConfig, rows []string) []string {
+	names := make([]string, 0, len(groupedCharts))
+	for _, name := range rows {
+		if _, ok := groupedCharts[name]; ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(groupedCharts)) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
 	}
 
-	return dashboardJSON, nil
+	return names
+}
+
+// sortCharts orders the charts of a row by their Order, keeping the config order for ties
+func sortCharts(charts []SensorChartConfig) []SensorChartConfig {
+	sorted := slices.Clone(charts)
+	slices.SortStableFunc(sorted, func(a, b SensorChartConfig) int {
+		return cmp.Compare(a.Order, b.Order)
+	})
+
+	return sorted
+}
+
+// panelSize returns the default for unset sizes and clamps sizes above the limit to it
+func panelSize(size, defaultSize, maxSize uint32) uint32 {
+	if size == 0 {
+		return defaultSize
+	}
+
+	return min(size, maxSize)
 }
 
 func newChartPanel(config SensorChartConfig) *dashboard.PanelBuilder {
@@ -150,22 +546,110 @@ func newChartPanel(config SensorChartConfig) *dashboard.PanelBuilder {
 		queryBuilder.Instant()
 	}
 
-	var width = uint32(DefaultSpan)
-	if config.Span > 0 && config.Span <= MaxPanelSpan {
-		width = config.Span
+	if config.Legend != "" {
+		queryBuilder.LegendFormat(config.Legend)
 	}
 
-	var height = uint32(DefaultHeight)
-	if config.Height > 0 && config.Height < MaxPanelHeight {
-		height = config.Height
+	if config.Datasource != "" {
+		queryBuilder.Datasource(prometheusDatasource(config.Datasource))
 	}
 
-	return dashboard.NewPanelBuilder().
+	width := panelSize(config.Span, DefaultSpan, MaxPanelSpan)
+	height := panelSize(config.Height, DefaultHeight, MaxPanelHeight)
+
+	panel := dashboard.NewPanelBuilder().
 		Title(config.Title).
 		Type(config.Type).
 		Height(height).
 		Span(width).
 		WithTarget(queryBuilder)
+
+	if config.Datasource != "" {
+		panel.Datasource(prometheusDatasource(config.Datasource))
+	}
+
+	if config.GridPos != nil {
+		panel.GridPos(dashboard.GridPos{
+			X: config.GridPos.X,
+			Y: config.GridPos.Y,
+			W: width,
+			H: height,
+		})
+	}
+
+	if options := chartOptions(config.Type); options != nil {
+		panel.Options(options)
+	}
+
+	if config.Unit != "" {
+		panel.Unit(config.Unit)
+	}
+
+	if config.Decimals != nil {
+		panel.Decimals(*config.Decimals)
+	}
+
+	if config.Min != nil {
+		panel.Min(*config.Min)
+	}
+
+	if config.Max != nil {
+		panel.Max(*config.Max)
+	}
+
+	if len(config.Thresholds) > 0 && (config.Type == ChartTypeGauge || config.Type == ChartTypeStat) {
+		panel.Thresholds(newThresholds(config.Thresholds))
+	}
+
+	return panel
+}
+
+func newThresholds(steps []ThresholdStep) *dashboard.ThresholdsConfigBuilder {
+	thresholds := make([]dashboard.Threshold, 0, len(steps))
+	for _, step := range steps {
+		// a nil value is serialized as null, which Grafana reads as -Infinity
+		thresholds = append(thresholds, dashboard.Threshold{Value: step.Value, Color: step.Color})
+	}
+
+	return dashboard.NewThresholdsConfigBuilder().
+		Mode(dashboard.ThresholdsModeAbsolute).
+		Steps(thresholds)
+}
+
+// chartOptions returns the panel options of the chart type, or nil to leave them to Grafana;
+// gauges and stats show the latest value, Grafana otherwise picks the mean of the range
+func chartOptions(chartType string) any {
+	switch chartType {
+	case ChartTypeGauge:
+		options := gauge.NewOptions()
+		options.ReduceOptions.Calcs = []string{"lastNotNull"}
+		return options
+	case ChartTypeStat:
+		options := stat.NewOptions()
+		options.ReduceOptions.Calcs = []string{"lastNotNull"}
+		return options
+	case ChartTypeTimeSeries:
+		return timeseries.NewOptions()
+	default:
+		return nil
+	}
+}
+
+// loadLiveDashboardConfig generates the chart config from the sensors the device reports
+func loadLiveDashboardConfig(exporterConfigPath string, deviceID int) (*DashboardConfig, error) {
+	exporterConfig, err := loadExporterConfig(exporterConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// stdout is reserved for the generated JSON
+	logger := logging.NewLogger(os.Stderr, "warn", "text")
+	device, err := fetchLiveDevice(context.Background(), exporterConfig, deviceID, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch device %d: %w", deviceID, err)
+	}
+
+	return generateDashboardConfig(device, exporterConfig.SensorMapping, exporterConfig.Namespace), nil
 }
 
 func loadDashboardConfig(path string) (*DashboardConfig, error) {
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-foundation-sdk/go/cog"
+)
+
+func TestValidateThresholds(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []ThresholdStep
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "base step without value", steps: []ThresholdStep{{Color: "red"}, {Value: cog.ToPtr(20.0), Color: "orange"}, {Value: cog.ToPtr(50.0), Color: "green"}}},
+		{name: "all with values", steps: []ThresholdStep{{Value: cog.ToPtr(-10.0), Color: "blue"}, {Value: cog.ToPtr(0.0), Color: "#73BF69"}}},
+		{
+			name:    "descending",
+			steps:   []ThresholdStep{{Color: "green"}, {Value: cog.ToPtr(50.0), Color: "orange"}, {Value: cog.ToPtr(20.0), Color: "red"}},
+			wantErr: "threshold 2: value 20 must be greater than the previous 50",
+		},
+		{
+			name:    "equal values",
+			steps:   []ThresholdStep{{Value: cog.ToPtr(20.0), Color: "green"}, {Value: cog.ToPtr(20.0), Color: "red"}},
+			wantErr: "threshold 1: value 20 must be greater than the previous 20",
+		},
+		{
+			name:    "later step without value",
+			steps:   []ThresholdStep{{Color: "green"}, {Color: "red"}},
+			wantErr: "threshold 1: only the first threshold may omit the value",
+		},
+		{
+			name:    "missing color",
+			steps:   []ThresholdStep{{Color: "green"}, {Value: cog.ToPtr(20.0)}},
+			wantErr: "threshold 1: color must not be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		err := errors.Join(validateThresholds(tt.steps)...)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestSensorChartConfigValidateNamesChart(t *testing.T) {
+	chart := SensorChartConfig{Title: "Battery", Query: "smartcitizen_sensor_state", Thresholds: []ThresholdStep{
+		{Value: cog.ToPtr(50.0), Color: "green"}, {Value: cog.ToPtr(10.0), Color: "red"},
+	}}
+
+	err := chart.Validate()
+	if err == nil || !strings.Contains(err.Error(), `chart "Battery": threshold 1`) {
+		t.Errorf("expected the threshold error to name the chart, got %v", err)
+	}
+}
+
+func TestNewChartPanelThresholds(t *testing.T) {
+	steps := []ThresholdStep{{Color: "red"}, {Value: cog.ToPtr(20.0), Color: "green"}}
+
+	tests := []struct {
+		chartType string
+		want      bool
+	}{
+		{chartType: ChartTypeGauge, want: true},
+		{chartType: ChartTypeStat, want: true},
+		{chartType: ChartTypeTimeSeries, want: false},
+		{chartType: ChartTypeTable, want: false},
+	}
+
+	for _, tt := range tests {
+		panel, err := newChartPanel(SensorChartConfig{Title: "Battery", Type: tt.chartType, Query: "up", Thresholds: steps}).Build()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.chartType, err)
+		}
+
+		var thresholdsSet bool
+		if panel.FieldConfig != nil && panel.FieldConfig.Defaults.Thresholds != nil {
+			thresholds := panel.FieldConfig.Defaults.Thresholds
+			thresholdsSet = true
+
+			if len(thresholds.Steps) != 2 || thresholds.Steps[0].Value != nil || *thresholds.Steps[1].Value != 20 || thresholds.Steps[1].Color != "green" {
+				t.Errorf("%s: expected the configured steps, got %+v", tt.chartType, thresholds.Steps)
+			}
+		}
+
+		if thresholdsSet != tt.want {
+			t.Errorf("%s: expected thresholds %v, got %v", tt.chartType, tt.want, thresholdsSet)
+		}
+	}
+
+	// without thresholds Grafana keeps its defaults
+	panel, err := newChartPanel(SensorChartConfig{Title: "Battery", Type: ChartTypeGauge, Query: "up"}).Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if panel.FieldConfig != nil && panel.FieldConfig.Defaults.Thresholds != nil {
+		t.Errorf("expected no thresholds when unset, got %+v", panel.FieldConfig.Defaults.Thresholds)
+	}
+}
+
+func TestDashboardConfigValidateRefresh(t *testing.T) {
+	tests := []struct {
+		refresh string
+		valid   bool
+	}{
+		{refresh: "30s", valid: true},
+		{refresh: "5m", valid: true},
+		{refresh: "1h", valid: true},
+		{refresh: "1d", valid: true},
+		{refresh: "", valid: false},
+		{refresh: "5", valid: false},
+		{refresh: "0s", valid: false},
+		{refresh: "05m", valid: false},
+		{refresh: "1w", valid: false},
+		{refresh: "5 m", valid: false},
+		{refresh: "-5m", valid: false},
+	}
+
+	for _, tt := range tests {
+		config := DashboardConfig{Refresh: tt.refresh}
+		err := config.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("refresh %q: unexpected error: %v", tt.refresh, err)
+		}
+
+		if !tt.valid && (err == nil || !strings.Contains(err.Error(), "invalid refresh")) {
+			t.Errorf("refresh %q: expected an invalid refresh error, got %v", tt.refresh, err)
+		}
+	}
+}
+
+func TestBuildDashboardRefreshAndTimeRange(t *testing.T) {
+	charts := []SensorChartConfig{{Title: "Battery", Panel: DevicePanel, Type: ChartTypeGauge, Query: "up"}}
+
+	tests := []struct {
+		name    string
+		config  DashboardConfig
+		refresh string
+		from    string
+		to      string
+	}{
+		{name: "defaults", config: DashboardConfig{}, refresh: DefaultRefresh, from: DefaultTimeFrom, to: DefaultTimeTo},
+		{name: "configured", config: DashboardConfig{Refresh: "30s", TimeFrom: "now-7d", TimeTo: "now-1d"}, refresh: "30s", from: "now-7d", to: "now-1d"},
+		{name: "only refresh", config: DashboardConfig{Refresh: "1h"}, refresh: "1h", from: DefaultTimeFrom, to: DefaultTimeTo},
+	}
+
+	for _, tt := range tests {
+		config := tt.config
+		config.Title = "Device"
+		config.Charts = charts
+		config.ApplyDefaults()
+
+		dashboardObj, err := buildDashboard(&config)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+
+		if dashboardObj.Refresh == nil || *dashboardObj.Refresh != tt.refresh {
+			t.Errorf("%s: expected refresh %q, got %v", tt.name, tt.refresh, dashboardObj.Refresh)
+		}
+
+		if dashboardObj.Time == nil || dashboardObj.Time.From != tt.from || dashboardObj.Time.To != tt.to {
+			t.Errorf("%s: expected time range %s to %s, got %+v", tt.name, tt.from, tt.to, dashboardObj.Time)
+		}
+	}
+}
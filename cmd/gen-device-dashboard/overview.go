@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana-foundation-sdk/go/cog"
+	"github.com/grafana/grafana-foundation-sdk/go/dashboard"
+)
+
+const (
+	OverviewTitle = "SmartCitizen Fleet overview"
+	OverviewUID   = "smartcitizen-fleet-overview"
+
+	// LowBatteryLevel matches the low battery alert
+	LowBatteryLevel = 20
+)
+
+// deviceNameJoin adds the device name to the sensor series of the selected devices, the series
+// are labeled with the device uuid and the sensor name, which is replaced by the device name
+func deviceNameJoin(query string) string {
+	return fmt.Sprintf("%s * on (device) group_left (name) max by (device, name) (label_replace(%s_device_info{name=~\"$name\"}, \"device\", \"$1\", \"uuid\", \"(.*)\"))",
+		query, DefaultNamespace)
+}
+
+// buildOverviewDashboard shows the fleet totals and a grid with the state and battery of every device
+func buildOverviewDashboard() (dashboard.Dashboard, error) {
+	battery := deviceNameJoin(DefaultNamespace + "_sensor_device_battery")
+	hasPublished := DefaultNamespace + "_device_state_has_published"
+	batteryThresholds := []ThresholdStep{
+		{Color: "red"},
+		{Value: cog.ToPtr(float64(LowBatteryLevel)), Color: "orange"},
+		{Value: cog.ToPtr(50.0), Color: "green"},
+	}
+
+	builder := dashboard.NewDashboardBuilder(OverviewTitle).
+		Uid(OverviewUID).
+		Tags([]string{"smartcitizen", "device", "overview"}).
+		Refresh(DefaultRefresh).
+		Time(DefaultTimeFrom, DefaultTimeTo).
+		Editable().
+		WithVariable(
+			dashboard.NewQueryVariableBuilder("name").
+				Label("device names").
+				Description("names of the shown devices").
+				Query(dashboard.StringOrMap{
+					String: cog.ToPtr(fmt.Sprintf("label_values(%s_device_info,name)", DefaultNamespace)),
+				}).
+				Refresh(dashboard.VariableRefreshOnTimeRangeChanged).
+				Sort(dashboard.VariableSortAlphabeticalCaseInsensitiveAsc).
+				Multi(true).
+				IncludeAll(true),
+		)
+
+	fleetRow := dashboard.NewRowBuilder("Fleet").
+		WithPanel(newChartPanel(SensorChartConfig{
+			Title:   "Devices",
+			Type:    ChartTypeStat,
+			Query:   fmt.Sprintf("count(%s_device_info{name=~\"$name\"})", DefaultNamespace),
+			Instant: true,
+		})).
+		WithPanel(newChartPanel(SensorChartConfig{
+			Title:   "Publishing",
+			Type:    ChartTypeStat,
+			Query:   fmt.Sprintf("count(%s{name=~\"$name\"} == 1) or vector(0)", hasPublished),
+			Instant: true,
+		})).
+		WithPanel(newChartPanel(SensorChartConfig{
+			Title:   "Low battery",
+			Type:    ChartTypeStat,
+			Query:   fmt.Sprintf("count((%s) < %d) or vector(0)", battery, LowBatteryLevel),
+			Instant: true,
+		}))
+	builder.WithRow(fleetRow)
+
+	// one stat per device, labeled by the device name
+	devicesRow := dashboard.NewRowBuilder("Devices").
+		WithPanel(newChartPanel(SensorChartConfig{
+			Title:  "Published",
+			Type:   ChartTypeStat,
+			Query:  fmt.Sprintf("max by (name) (%s{name=~\"$name\"})", hasPublished),
+			Legend: "{{name}}",
+			Span:   MaxPanelSpan,
+			Min:    cog.ToPtr(0.0),
+			Max:    cog.ToPtr(1.0),
+			Thresholds: []ThresholdStep{
+				{Color: "red"},
+				{Value: cog.ToPtr(1.0), Color: "green"},
+			},
+		})).
+		WithPanel(newChartPanel(SensorChartConfig{
+			Title:      "Battery",
+			Type:       ChartTypeStat,
+			Query:      fmt.Sprintf("max by (name) (%s)", battery),
+			Legend:     "{{name}}",
+			Span:       MaxPanelSpan,
+			Unit:       "percent",
+			Min:        cog.ToPtr(0.0),
+			Max:        cog.ToPtr(100.0),
+			Thresholds: batteryThresholds,
+		}))
+	builder.WithRow(devicesRow)
+
+	return builder.Build()
+}
@@ -1,67 +1,112 @@
 package main
 
 import (
-	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/timgluz/smcprober/configfile"
+	"github.com/timgluz/smcprober/envconfig"
 	"github.com/timgluz/smcprober/httpclient"
+	"github.com/timgluz/smcprober/logging"
 	"github.com/timgluz/smcprober/metric"
 	"github.com/timgluz/smcprober/smartcitizen"
 )
 
 const DefaultConfigPath = "configs/config.json"
 
+// Environment variables overriding the config file values
+const (
+	EnvLogLevel   = "SMC_LOG_LEVEL"
+	EnvLogFormat  = "SMC_LOG_FORMAT"
+	EnvDotEnvPath = configfile.EnvDotEnvPath
+)
+
 type AppConfig struct {
 	LogLevel   string `json:"log_level"`
+	LogFormat  string `json:"log_format"`
 	DotEnvPath string `json:"dotenv_path"`
 
 	Smc smartcitizen.Config `json:"smartcitizen"`
 }
 
-type Result struct {
-	User    smartcitizen.User
-	Devices []smartcitizen.DeviceDetail
+func (c *AppConfig) ApplyDefaults() {
+	c.Smc.ApplyDefaults()
+}
+
+// ApplyEnv overrides config values with the environment variables that are set
+func (c *AppConfig) ApplyEnv() error {
+	envconfig.String(EnvLogLevel, &c.LogLevel)
+	envconfig.String(EnvLogFormat, &c.LogFormat)
+
+	return c.Smc.ApplyEnv()
+}
+
+// DotEnvFile points to the .env file path, loaded before the environment by configfile.Load
+func (c *AppConfig) DotEnvFile() *string {
+	return &c.DotEnvPath
+}
+
+// Validate checks the configuration and referenced environment variables
+func (c *AppConfig) Validate() error {
+	return c.Smc.Validate()
 }
 
 func main() {
 	var configPath string
 	var dotEnvPath string
+	var validateOnly bool
+	var strict bool
 	var outputPath string
+	var gzipOutput bool
+	var sinceValue string
+	var listSensors bool
 
-	flag.StringVar(&configPath, "config", DefaultConfigPath, "Path to configuration file")
+	flag.StringVar(&configPath, "config", DefaultConfigPath, "Path to configuration file, - reads it from stdin")
 	flag.StringVar(&dotEnvPath, "dotenv", "", "Path to .env file (overrides config file setting)")
 	flag.StringVar(&outputPath, "output", "", "Path to output JSON file")
+	flag.BoolVar(&gzipOutput, "gzip", false, "Compress the output with gzip, implied by an -output path ending in .gz")
+	flag.StringVar(&sinceValue, "since", "", "Only download devices with readings since the given RFC3339 time")
+	flag.BoolVar(&validateOnly, "validate", false, "Validate the configuration and exit without running")
+	flag.BoolVar(&strict, "strict", false, "Reject unknown keys in the configuration file")
+	flag.BoolVar(&listSensors, "list-sensors", false, "Write the distinct sensors of all devices as a sensor_mapping skeleton instead of the device details")
 	flag.Parse()
 
-	appConfig, err := loadConfigFromJSONFile(configPath)
+	appConfig, err := loadConfig(configPath, dotEnvPath, strict)
 	if err != nil {
 		fmt.Println("Error loading config:", err)
 		os.Exit(1)
 	}
 
-	if dotEnvPath != "" {
-		appConfig.DotEnvPath = dotEnvPath
+	var since time.Time
+	if sinceValue != "" {
+		if since, err = time.Parse(time.RFC3339, sinceValue); err != nil {
+			fmt.Println("Invalid -since value, expected RFC3339 time:", err)
+			os.Exit(1)
+		}
 	}
 
-	if appConfig.DotEnvPath != "" {
-		fmt.Println("Loading .env file from:", appConfig.DotEnvPath)
-		if err := godotenv.Load(appConfig.DotEnvPath); err != nil {
-			fmt.Println("Error loading .env file:", err)
+	if validateOnly {
+		if err := appConfig.Validate(); err != nil {
+			fmt.Println("Invalid configuration:")
+			fmt.Println(err)
 			os.Exit(1)
 		}
+
+		fmt.Println("Configuration is valid")
+		os.Exit(0)
 	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	logger := logging.NewLogger(os.Stdout, appConfig.LogLevel, appConfig.LogFormat)
 
 	smcProvider, err := initSmartCitizenProvider(appConfig, logger)
 	if err != nil {
@@ -80,16 +125,34 @@ func main() {
 		os.Exit(1)
 	}
 
-	result := Result{
-		User:    user,
-		Devices: make([]smartcitizen.DeviceDetail, 0),
+	compress := gzipOutput || strings.HasSuffix(outputPath, ".gz")
+	output, err := openOutput(outputPath, compress)
+	if err != nil {
+		logger.Error("Failed to open output", "error", err, "path", outputPath)
+		os.Exit(1)
+	}
+
+	// Devices are written as soon as they are fetched, so memory doesn't grow with the fleet size
+	var stream deviceWriter
+	if listSensors {
+		stream = newSensorCatalog(output, logger)
+	} else if stream, err = newResultStream(output, user); err != nil {
+		logger.Error("Failed to write result", "error", err)
+		os.Exit(1)
 	}
 
 	for _, device := range user.Devices {
+		if !hasReadingsSince(device, since) {
+			logger.Info("Skipping device without new readings", "deviceID", device.ID,
+				"lastReadingAt", device.LastReadingAt, "since", since)
+			continue
+		}
+
 		logger.Info("User device", "deviceID", device.ID, "name", device.Name, "state", device.State)
 		deviceDetail, err := smcProvider.GetDevice(context.Background(), device.ID)
 		if err != nil {
 			logger.Error("Failed to get device detail", "deviceID", device.ID, "error", err)
+			_ = output.Close()
 			os.Exit(1)
 		}
 
@@ -99,27 +162,97 @@ func main() {
 		}
 
 		logger.Info("Fetched device detail", "deviceID", deviceDetail.ID, "name", deviceDetail.Name, "state", deviceDetail.State, "sensorsCount", len(deviceDetail.Data.Sensors))
-		result.Devices = append(result.Devices, *deviceDetail)
+		if err := stream.WriteDevice(*deviceDetail); err != nil {
+			logger.Error("Failed to write device detail", "deviceID", device.ID, "error", err)
+			_ = output.Close()
+			os.Exit(1)
+		}
 	}
 
-	jsonResult, err := json.MarshalIndent(result, "", "  ")
-	if err != nil {
-		logger.Error("Failed to marshal result to JSON", "error", err)
+	if err := stream.Finish(); err != nil {
+		logger.Error("Failed to write result", "error", err)
+		_ = output.Close()
+		os.Exit(1)
+	}
+
+	if err := output.Close(); err != nil {
+		logger.Error("Failed to save result", "error", err, "path", outputPath)
 		os.Exit(1)
 	}
 
-	buf := bytes.NewReader(jsonResult)
 	if outputPath != "" {
-		if err := saveFile(outputPath, buf); err != nil {
-			logger.Error("Failed to save result to file", "error", err, "path", outputPath)
-			os.Exit(1)
-		}
-		logger.Info("Result saved to JSON file", "path", outputPath)
-	} else {
-		fmt.Println(string(jsonResult))
+		logger.Info("Result saved to JSON file", "path", outputPath, "gzip", compress)
 	}
 }
 
+// hasReadingsSince keeps devices that published at or after since; a zero since
+// keeps all devices, and so do unparseable timestamps to not lose data silently
+func hasReadingsSince(device smartcitizen.UserDevice, since time.Time) bool {
+	if since.IsZero() {
+		return true
+	}
+
+	lastReadingAt, err := smartcitizen.ParseTime(device.LastReadingAt)
+	if err != nil {
+		return true
+	}
+
+	return !lastReadingAt.Before(since)
+}
+
+// deviceWriter receives the fetched devices, Finish is called after the last one
+type deviceWriter interface {
+	WriteDevice(device smartcitizen.DeviceDetail) error
+	Finish() error
+}
+
+// resultStream writes the result as {"User": ..., "Devices": [...]} one device at a time,
+// the framing is written manually as the devices aren't known upfront
+type resultStream struct {
+	w       io.Writer
+	devices int
+}
+
+func newResultStream(w io.Writer, user smartcitizen.User) (*resultStream, error) {
+	content, err := json.MarshalIndent(user, "  ", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := fmt.Fprintf(w, "{\n  \"User\": %s,\n  \"Devices\": [", content); err != nil {
+		return nil, err
+	}
+
+	return &resultStream{w: w}, nil
+}
+
+func (s *resultStream) WriteDevice(device smartcitizen.DeviceDetail) error {
+	content, err := json.MarshalIndent(device, "    ", "  ")
+	if err != nil {
+		return err
+	}
+
+	separator := ","
+	if s.devices == 0 {
+		separator = ""
+	}
+	s.devices++
+
+	_, err = fmt.Fprintf(s.w, "%s\n    %s", separator, content)
+	return err
+}
+
+// Finish closes the devices array and the result object
+func (s *resultStream) Finish() error {
+	closing := "]\n}\n"
+	if s.devices > 0 {
+		closing = "\n  ]\n}\n"
+	}
+
+	_, err := io.WriteString(s.w, closing)
+	return err
+}
+
 func initSmartCitizenProvider(appConfig AppConfig, logger *slog.Logger) (*smartcitizen.HTTPProvider, error) {
 	smcCredProvider := smartcitizen.NewUserCredentialEnvProvider(appConfig.Smc.UsernameEnv, appConfig.Smc.PasswordEnv, appConfig.Smc.TokenEnv)
 	credentials, err := smcCredProvider.Retrieve(context.Background())
@@ -146,47 +279,53 @@ func initSmartCitizenProvider(appConfig AppConfig, logger *slog.Logger) (*smartc
 	return smcProvider, nil
 }
 
-func loadConfigFromJSONFile(path string) (AppConfig, error) {
-	var config AppConfig
-	// Clean the path to prevent path traversal attacks
-	cleanPath := filepath.Clean(path)
-	file, err := os.Open(cleanPath)
-	if err != nil {
-		return config, err
-	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			fmt.Fprintf(os.Stderr, "Failed to close config file: %v\n", closeErr)
+// loadConfig layers the configuration as defaults < config file < environment, see configfile.Load
+func loadConfig(path, dotEnvPath string, strict bool) (AppConfig, error) {
+	return configfile.Load[AppConfig](path, DefaultConfigPath, dotEnvPath, strict)
+}
+
+// StdinConfigPath as the config path reads the configuration from stdin, e.g. generated by a template
+const StdinConfigPath = configfile.StdinPath
+
+// decodeConfig decodes the JSON configuration, source names the input in errors
+func decodeConfig(r io.Reader, source string, strict bool) (AppConfig, error) {
+	return configfile.Decode[AppConfig](r, source, strict)
+}
+
+// openOutput opens the output file, or stdout if the path is empty, optionally gzip compressed
+func openOutput(path string, compress bool) (io.WriteCloser, error) {
+	var output io.WriteCloser = nopWriteCloser{os.Stdout}
+	if path != "" {
+		// Clean the path to prevent path traversal attacks
+		file, err := os.Create(filepath.Clean(path))
+		if err != nil {
+			return nil, err
 		}
-	}()
+		output = file
+	}
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return config, err
+	if !compress {
+		return output, nil
 	}
 
-	config.Smc.ApplyDefaults()
+	return &gzipWriteCloser{Writer: gzip.NewWriter(output), output: output}, nil
+}
 
-	return config, nil
+// gzipWriteCloser closes the gzip writer before the underlying output, closing it flushes
+// the remaining data and the footer, without it the output would be truncated
+type gzipWriteCloser struct {
+	*gzip.Writer
+	output io.Closer
 }
 
-func saveFile(path string, reader io.Reader) error {
-	// Clean the path to prevent path traversal attacks
-	cleanPath := filepath.Clean(path)
-	file, err := os.Create(cleanPath)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			fmt.Fprintf(os.Stderr, "Failed to close file: %v\n", closeErr)
-		}
-	}()
+func (w *gzipWriteCloser) Close() error {
+	return errors.Join(w.Writer.Close(), w.output.Close())
+}
 
-	_, err = io.Copy(file, reader)
-	if err != nil {
-		return err
-	}
+type nopWriteCloser struct {
+	io.Writer
+}
 
+func (nopWriteCloser) Close() error {
 	return nil
 }
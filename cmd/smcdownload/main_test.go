@@ -0,0 +1,154 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/timgluz/smcprober/smartcitizen"
+)
+
+// result is the document written by resultStream
+type result struct {
+	User    smartcitizen.User
+	Devices []smartcitizen.DeviceDetail
+}
+
+func writeResult(t *testing.T, path string, compress bool, devices ...smartcitizen.DeviceDetail) {
+	t.Helper()
+
+	output, err := openOutput(path, compress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stream, err := newResultStream(output, smartcitizen.User{ID: 7, Username: "citizen"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, device := range devices {
+		if err := stream.WriteDevice(device); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := stream.Finish(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := output.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGzipOutputRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json.gz")
+	writeResult(t, path, true,
+		smartcitizen.DeviceDetail{ID: 1, Name: "Balcony"},
+		smartcitizen.DeviceDetail{ID: 2, Name: "Garden"},
+	)
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("expected gzip output: %v", err)
+	}
+	defer reader.Close()
+
+	// reading to EOF verifies the checksum in the footer, a truncated file fails here
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to decompress the output: %v", err)
+	}
+
+	var decoded result
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatalf("failed to decode the compressed output: %v", err)
+	}
+
+	if decoded.User.Username != "citizen" || len(decoded.Devices) != 2 || decoded.Devices[1].Name != "Garden" {
+		t.Errorf("unexpected result %+v", decoded)
+	}
+}
+
+func TestPlainOutputByDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	writeResult(t, path, false)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded result
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatalf("expected plain JSON output: %v", err)
+	}
+
+	if decoded.User.ID != 7 || len(decoded.Devices) != 0 {
+		t.Errorf("unexpected result %+v", decoded)
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	appConfig, err := decodeConfig(strings.NewReader(`{"log_level": "debug"}`), "from stdin", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if appConfig.LogLevel != "debug" {
+		t.Errorf("expected log level debug, got %q", appConfig.LogLevel)
+	}
+
+	_, err = decodeConfig(strings.NewReader(`{"log_levl": "debug"}`), "from stdin", true)
+	if err == nil || !strings.Contains(err.Error(), "from stdin") {
+		t.Errorf("expected strict decoding to reject the unknown field and name the source, got %v", err)
+	}
+}
+
+func TestLoadConfigFromStdin(t *testing.T) {
+	for _, name := range []string{EnvDotEnvPath, smartcitizen.EnvEndpoint} {
+		t.Setenv(name, "")
+		if err := os.Unsetenv(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(path, []byte(`{"smartcitizen": {"public_mode": true}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	original := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = original }()
+
+	appConfig, err := loadConfig(StdinConfigPath, "", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !appConfig.Smc.PublicMode {
+		t.Error("expected public mode from stdin")
+	}
+
+	if appConfig.Smc.Endpoint != smartcitizen.DefaultEndpoint {
+		t.Errorf("expected the default endpoint, got %q", appConfig.Smc.Endpoint)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"unicode"
+
+	"github.com/timgluz/smcprober/metric"
+	"github.com/timgluz/smcprober/smartcitizen"
+)
+
+// deviceSensorKeywords mark sensors about the device itself rather than its environment
+var deviceSensorKeywords = []string{"battery", "rssi", "sd card", "wi-fi", "wifi"}
+
+// sensorCatalog collects the distinct sensors reported by the devices, keyed by sensor name,
+// and writes them as a sensor mapping skeleton once all devices are fetched
+type sensorCatalog struct {
+	w       io.Writer
+	sensors map[string]smartcitizen.DeviceSensor
+	logger  *slog.Logger
+}
+
+func newSensorCatalog(w io.Writer, logger *slog.Logger) *sensorCatalog {
+	return &sensorCatalog{
+		w:       w,
+		sensors: make(map[string]smartcitizen.DeviceSensor),
+		logger:  logger,
+	}
+}
+
+// WriteDevice keeps the first sensor of every name, the units of sensors sharing a name should match
+func (c *sensorCatalog) WriteDevice(device smartcitizen.DeviceDetail) error {
+	for _, sensor := range device.Data.Sensors {
+		known, ok := c.sensors[sensor.Name]
+		if !ok {
+			c.sensors[sensor.Name] = sensor
+			continue
+		}
+
+		if known.Unit != sensor.Unit {
+			c.logger.Warn("Sensor is reported with different units", "sensor", sensor.Name,
+				"unit", known.Unit, "otherUnit", sensor.Unit, "deviceID", device.ID)
+		}
+	}
+
+	return nil
+}
+
+// mappingSkeleton is the sensor_mapping section of the exporter config, the metric and category
+// of every sensor are guesses to be reviewed; the help shows what the API reports about it
+type mappingSkeleton struct {
+	SensorMapping map[string]metric.MetricMappingItem `json:"sensor_mapping"`
+}
+
+func (c *sensorCatalog) Skeleton() mappingSkeleton {
+	skeleton := mappingSkeleton{SensorMapping: make(map[string]metric.MetricMappingItem, len(c.sensors))}
+	for name, sensor := range c.sensors {
+		skeleton.SensorMapping[name] = metric.MetricMappingItem{
+			Metric:   guessMetricName(name),
+			Category: guessCategory(name),
+			Help:     sensorHelp(sensor),
+		}
+	}
+
+	return skeleton
+}
+
+// Finish writes the skeleton as indented JSON, encoding/json sorts the sensor names
+func (c *sensorCatalog) Finish() error {
+	c.logger.Info("Collected sensors", "sensors", len(c.sensors))
+
+	encoder := json.NewEncoder(c.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c.Skeleton())
+}
+
+// guessMetricName converts the measurement part of the sensor name to snake case,
+// e.g. "Sensirion SEN5X - PM2.5" to pm2_5
+func guessMetricName(sensorName string) string {
+	name := sensorName
+	if _, measurement, ok := strings.Cut(sensorName, " - "); ok {
+		name = measurement
+	}
+
+	var metricName strings.Builder
+	separate := false
+	for _, r := range strings.ToLower(name) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) || r > unicode.MaxASCII {
+			separate = metricName.Len() > 0
+			continue
+		}
+
+		if separate {
+			metricName.WriteRune('_')
+			separate = false
+		}
+		metricName.WriteRune(r)
+	}
+
+	return metricName.String()
+}
+
+func guessCategory(sensorName string) string {
+	name := strings.ToLower(sensorName)
+	for _, keyword := range deviceSensorKeywords {
+		if strings.Contains(name, keyword) {
+			return "device"
+		}
+	}
+
+	return "environment"
+}
+
+func sensorHelp(sensor smartcitizen.DeviceSensor) string {
+	help := sensor.Description
+	if help == "" {
+		help = sensor.Name
+	}
+
+	if sensor.Unit != "" {
+		help += " (" + sensor.Unit + ")"
+	}
+
+	return help
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// MetricsAuthConfig names the environment variables with the credentials protecting /metrics,
+// either basic auth or a bearer token is accepted; without any the endpoint stays open
+type MetricsAuthConfig struct {
+	UsernameEnv string `json:"username_env,omitempty"`
+	PasswordEnv string `json:"password_env,omitempty"`
+	TokenEnv    string `json:"token_env,omitempty"`
+}
+
+func (c *MetricsAuthConfig) Enabled() bool {
+	return c.UsernameEnv != "" || c.TokenEnv != ""
+}
+
+func (c *MetricsAuthConfig) Validate() error {
+	var errs []error
+	if (c.UsernameEnv == "") != (c.PasswordEnv == "") {
+		errs = append(errs, fmt.Errorf("metrics_auth username_env and password_env must be set together"))
+	}
+
+	for _, envVar := range []string{c.UsernameEnv, c.PasswordEnv, c.TokenEnv} {
+		if envVar != "" && os.Getenv(envVar) == "" {
+			errs = append(errs, fmt.Errorf("environment variable %s must be set", envVar))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// requireAuth rejects requests without the configured basic auth credentials or bearer token;
+// the credentials are read once, so they must be set when the exporter starts
+func requireAuth(config MetricsAuthConfig, next http.Handler) http.Handler {
+	if !config.Enabled() {
+		return next
+	}
+
+	username, password := os.Getenv(config.UsernameEnv), os.Getenv(config.PasswordEnv)
+	token := os.Getenv(config.TokenEnv)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); ok && config.UsernameEnv != "" &&
+			secretEqual(user, username) && secretEqual(pass, password) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok &&
+			config.TokenEnv != "" && secretEqual(bearer, token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if config.UsernameEnv != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="smcexporter", charset="UTF-8"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// secretEqual compares in constant time, hashing first so the length of the secret doesn't leak either
+func secretEqual(given, expected string) bool {
+	givenHash := sha256.Sum256([]byte(given))
+	expectedHash := sha256.Sum256([]byte(expected))
+
+	return subtle.ConstantTimeCompare(givenHash[:], expectedHash[:]) == 1
+}
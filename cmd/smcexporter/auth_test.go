@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/timgluz/smcprober/metric"
+	"github.com/timgluz/smcprober/smartcitizen"
+)
+
+const (
+	testAuthUsernameEnv = "TEST_METRICS_USERNAME"
+	testAuthPasswordEnv = "TEST_METRICS_PASSWORD"
+	testAuthTokenEnv    = "TEST_METRICS_TOKEN"
+)
+
+// newTestAPIExporter creates an exporter of a public device, its API answers every request with 404
+func newTestAPIExporter(t *testing.T) *smartcitizen.APIExporter {
+	t.Helper()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	config := smartcitizen.Config{Endpoint: server.URL, PublicMode: true, PublicDeviceIDs: []int{1}}
+	config.ApplyDefaults()
+
+	logger := slog.New(slog.DiscardHandler)
+	registry := metric.NewNamespacedRegistryWithRegisterer("test", nil, logger)
+	provider := smartcitizen.NewHTTPProvider(config, server.Client(), registry, logger)
+	return smartcitizen.NewAPIExporterWithRegistry(config, provider, registry, metric.NewSensorMetricMapping(), logger)
+}
+
+func setTestAuthEnv(t *testing.T) MetricsAuthConfig {
+	t.Helper()
+
+	t.Setenv(testAuthUsernameEnv, "prometheus")
+	t.Setenv(testAuthPasswordEnv, "s3cret")
+	t.Setenv(testAuthTokenEnv, "t0ken")
+
+	return MetricsAuthConfig{UsernameEnv: testAuthUsernameEnv, PasswordEnv: testAuthPasswordEnv, TokenEnv: testAuthTokenEnv}
+}
+
+func TestRequireAuth(t *testing.T) {
+	handler := requireAuth(setTestAuthEnv(t), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name      string
+		authorize func(r *http.Request)
+		want      int
+	}{
+		{name: "valid basic auth", authorize: func(r *http.Request) { r.SetBasicAuth("prometheus", "s3cret") }, want: http.StatusOK},
+		{name: "wrong password", authorize: func(r *http.Request) { r.SetBasicAuth("prometheus", "wrong") }, want: http.StatusUnauthorized},
+		{name: "wrong username", authorize: func(r *http.Request) { r.SetBasicAuth("admin", "s3cret") }, want: http.StatusUnauthorized},
+		{name: "valid bearer token", authorize: func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }, want: http.StatusOK},
+		{name: "wrong bearer token", authorize: func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, want: http.StatusUnauthorized},
+		{name: "token as password", authorize: func(r *http.Request) { r.SetBasicAuth("prometheus", "t0ken") }, want: http.StatusUnauthorized},
+		{name: "missing header", authorize: func(r *http.Request) {}, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		tt.authorize(req)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, rec.Code)
+		}
+
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate challenge", tt.name)
+		}
+	}
+}
+
+func TestRequireAuthTokenOnly(t *testing.T) {
+	t.Setenv(testAuthTokenEnv, "t0ken")
+	handler := requireAuth(MetricsAuthConfig{TokenEnv: testAuthTokenEnv}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// without basic auth configured an empty username and password must not pass
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.SetBasicAuth("", "")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", rec.Code)
+	}
+
+	if got := rec.Header().Get("WWW-Authenticate"); got != "" {
+		t.Errorf("expected no basic auth challenge with only a token, got %q", got)
+	}
+}
+
+func TestRequireAuthDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rec := httptest.NewRecorder()
+
+	requireAuth(MetricsAuthConfig{}, next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the endpoint to stay open without credentials, got %d", rec.Code)
+	}
+}
+
+func TestServeMuxProtectsEndpoints(t *testing.T) {
+	appConfig := AppConfig{}
+	appConfig.ApplyDefaults()
+	appConfig.Server.MetricsAuth = setTestAuthEnv(t)
+
+	mux := newServeMux(context.Background(), appConfig, newPromRegistry(), newTestAPIExporter(t), slog.New(slog.DiscardHandler))
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{method: http.MethodGet, path: "/metrics", want: http.StatusUnauthorized},
+		{method: http.MethodPost, path: "/reload", want: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/healthz", want: http.StatusOK},
+		{method: http.MethodGet, path: "/readyz", want: http.StatusOK},
+		{method: http.MethodGet, path: "/", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if rec.Code != tt.want {
+			t.Errorf("%s %s without credentials: expected status %d, got %d", tt.method, tt.path, tt.want, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.SetBasicAuth("prometheus", "s3cret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected /metrics with credentials to be served, got %d", rec.Code)
+	}
+}
@@ -2,64 +2,126 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/timgluz/smcprober/httpclient"
+	"github.com/prometheus/common/expfmt"
+	"github.com/timgluz/smcprober/clock"
+	"github.com/timgluz/smcprober/configfile"
+	"github.com/timgluz/smcprober/envconfig"
+	"github.com/timgluz/smcprober/logging"
 	"github.com/timgluz/smcprober/metric"
 	"github.com/timgluz/smcprober/smartcitizen"
 )
 
-const DefaultConfigPath = "configs/config.json"
+const (
+	DefaultConfigPath = "configs/config.json"
+
+	// MinReloadInterval protects the API from being hammered with manual reloads
+	MinReloadInterval = 10 * time.Second
+)
+
+// Update modes of the exporter
+const (
+	// ModePush polls the API on every scrape interval, regardless of scrapes
+	ModePush = "push"
+	// ModePull fetches data when /metrics is scraped, at most once per scrape interval
+	ModePull = "pull"
+)
+
+// Environment variables overriding the config file values
+const (
+	EnvNamespace      = "SMC_NAMESPACE"
+	EnvScrapeInterval = "SMC_SCRAPE_INTERVAL"
+	EnvLogLevel       = "SMC_LOG_LEVEL"
+	EnvLogFormat      = "SMC_LOG_FORMAT"
+	EnvDotEnvPath     = configfile.EnvDotEnvPath
+	EnvMode           = "SMC_MODE"
+)
 
 type AppConfig struct {
 	Namespace      string `json:"namespace"`
 	ScrapeInterval int    `json:"scrape_interval"`
+	Mode           string `json:"mode"`
 	LogLevel       string `json:"log_level"`
+	LogFormat      string `json:"log_format"`
 	DotEnvPath     string `json:"dotenv_path"`
 
+	Server        ServerConfig                        `json:"server"`
 	Smc           smartcitizen.Config                 `json:"smartcitizen"`
 	SensorMapping map[string]metric.MetricMappingItem `json:"sensor_mapping"`
 }
 
 func (c *AppConfig) ApplyDefaults() {
 	if c.Namespace == "" {
-		c.Namespace = "smartcitizen"
+		c.Namespace = smartcitizen.DefaultNamespace
 	}
 
 	if c.ScrapeInterval <= 0 {
 		c.ScrapeInterval = 30 // Default to 30 seconds
 	}
+
+	if c.Mode == "" {
+		c.Mode = ModePush
+	}
+	c.Server.ApplyDefaults()
 	c.Smc.ApplyDefaults()
 }
 
-func (c *AppConfig) GetScrapeIntervalDuration() time.Duration {
-	return time.Duration(c.ScrapeInterval) * time.Second
+// ApplyEnv overrides config values with the environment variables that are set
+func (c *AppConfig) ApplyEnv() error {
+	envconfig.String(EnvNamespace, &c.Namespace)
+	envconfig.String(EnvLogLevel, &c.LogLevel)
+	envconfig.String(EnvLogFormat, &c.LogFormat)
+	envconfig.String(EnvMode, &c.Mode)
+
+	return errors.Join(
+		envconfig.Int(EnvScrapeInterval, &c.ScrapeInterval),
+		c.Smc.ApplyEnv(),
+	)
+}
+
+// DotEnvFile points to the .env file path, loaded before the environment by configfile.Load
+func (c *AppConfig) DotEnvFile() *string {
+	return &c.DotEnvPath
 }
 
-func (c *AppConfig) LogLevelValue() slog.Level {
-	switch c.LogLevel {
-	case "debug":
-		return slog.LevelDebug
-	case "info":
-		return slog.LevelInfo
-	case "warn":
-		return slog.LevelWarn
-	case "error":
-		return slog.LevelError
-	default:
-		return slog.LevelInfo
+// Validate checks the configuration and referenced environment variables
+func (c *AppConfig) Validate() error {
+	return errors.Join(c.ValidateSettings(), c.Smc.ValidateCredentials())
+}
+
+// ValidateSettings checks the configuration without the credentials of the API, it runs on every start
+func (c *AppConfig) ValidateSettings() error {
+	errs := []error{c.Server.Validate(), c.Smc.ValidateSettings()}
+	if c.Mode != ModePush && c.Mode != ModePull {
+		errs = append(errs, fmt.Errorf("invalid mode %q, expected push or pull", c.Mode))
 	}
+
+	for sensorName, item := range c.SensorMapping {
+		if err := item.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sensor %q: %w", sensorName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *AppConfig) GetScrapeIntervalDuration() time.Duration {
+	return time.Duration(c.ScrapeInterval) * time.Second
 }
 
 type Result struct {
@@ -70,37 +132,60 @@ type Result struct {
 func main() {
 	var configPath string
 	var dotEnvPath string
+	var validateOnly bool
+	var strict bool
+	var selfTest bool
 	var port string
 
-	flag.StringVar(&configPath, "config", DefaultConfigPath, "Path to configuration file")
+	flag.StringVar(&configPath, "config", DefaultConfigPath, "Path to configuration file, - reads it from stdin")
 	flag.StringVar(&dotEnvPath, "dotenv", "", "Path to .env file (overrides config file setting)")
 	flag.StringVar(&port, "port", "8080", "port to run the HTTP server on")
+	flag.BoolVar(&validateOnly, "validate", false, "Validate the configuration and exit without running")
+	flag.BoolVar(&strict, "strict", false, "Reject unknown keys in the configuration file")
+	flag.BoolVar(&selfTest, "selftest", false, "Fetch one device, print the resulting metrics and exit without starting the server")
 	flag.Parse()
 
-	appConfig, err := loadConfigFromJSONFile(configPath)
+	appConfig, err := loadConfig(configPath, dotEnvPath, strict)
 	if err != nil {
 		fmt.Println("Error loading config:", err)
 		os.Exit(1)
 	}
 
-	if dotEnvPath != "" {
-		appConfig.DotEnvPath = dotEnvPath
+	if validateOnly {
+		if err := appConfig.Validate(); err != nil {
+			fmt.Println("Invalid configuration:")
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Configuration is valid")
+		os.Exit(0)
 	}
 
-	if appConfig.DotEnvPath != "" {
-		fmt.Println("Loading .env file from:", appConfig.DotEnvPath)
-		if err := godotenv.Load(appConfig.DotEnvPath); err != nil {
-			fmt.Println("Error loading .env file:", err)
+	logger := logging.NewLogger(os.Stdout, appConfig.LogLevel, appConfig.LogFormat)
+
+	if err := appConfig.ValidateSettings(); err != nil {
+		logger.Error("Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
+	if selfTest {
+		if err := runSelfTest(context.Background(), appConfig, os.Stdout, logger); err != nil {
+			logger.Error("Self-test failed", "error", err)
 			os.Exit(1)
 		}
-	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: appConfig.LogLevelValue(),
-	}))
+		logger.Info("Self-test passed")
+		os.Exit(0)
+	}
 
-	// Create shared metric registry
-	registry := metric.NewNamespacedRegistry(appConfig.Namespace, logger)
+	// /metrics serves only this registry, stray metrics of the default registry don't leak in;
+	// in pull mode the metrics of the shared registry are exposed by the API collector
+	promRegistry := newPromRegistry()
+	registry := metric.NewNamespacedRegistryWithRegisterer(appConfig.Namespace, promRegistry, logger)
+	if appConfig.Mode == ModePull {
+		registry = metric.NewNamespacedRegistryWithRegisterer(appConfig.Namespace, nil, logger)
+	}
 
 	smcProvider, err := initSmartCitizenProvider(appConfig, registry, logger)
 	if err != nil {
@@ -123,61 +208,40 @@ func main() {
 		smcProvider, registry, sensorMapping, logger,
 	)
 
+	// Sessions of username/password logins expire, sign in again instead of failing every update
+	if !appConfig.Smc.PublicMode {
+		exporter.SetCredentialProvider(smartcitizen.NewCredentialProvider(appConfig.Smc))
+	}
+
 	// Create context that can be cancelled
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start background updater with cancellable context
-	go exporter.Start(ctx, appConfig.GetScrapeIntervalDuration())
-
-	// HTTP handlers
-	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
-
-	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte("OK")); err != nil {
-			logger.Error("Failed to write /health response", "error", err)
-			return
+	if appConfig.Mode == ModePull {
+		collector, err := smartcitizen.NewAPICollector(ctx, exporter, appConfig.GetScrapeIntervalDuration())
+		if err != nil {
+			logger.Error("Failed to initialize API collector", "error", err)
+			os.Exit(1)
 		}
-	})
 
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte("OK")); err != nil {
-			logger.Error("Failed to write /healthz response", "error", err)
-			return
-		}
-	})
+		promRegistry.MustRegister(collector)
+		logger.Info("Metrics are fetched on scrape", "minInterval", appConfig.GetScrapeIntervalDuration())
+	} else {
+		// Start background updater with cancellable context
+		go exporter.Start(ctx, appConfig.GetScrapeIntervalDuration())
+	}
 
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if _, err := w.Write([]byte(`<html>
-			<head><title>SmartCitizen Exporter</title></head>
-			<body>
-			<h1>Prometheus Exporter for SmartCitizen devices</h1>
-			<p><a href="/metrics">Metrics</a></p>
-			<p>Metrics are dynamically registered and updated</p>
-			</body>
-			</html>`)); err != nil {
-			logger.Error("Failed to write root (/) response", "error", err)
-			return
-		}
-	})
+	mux := newServeMux(ctx, appConfig, promRegistry, exporter, logger)
 
 	// Create HTTP server
-	server := &http.Server{
-		Addr:              ":" + port,
-		Handler:           mux,
-		ReadHeaderTimeout: 10 * time.Second,
-	}
+	server := newServer(appConfig.Server, port, mux)
 
 	// Channel to listen for errors from the server
 	serverErrors := make(chan error, 1)
 
 	// Start HTTP server in a goroutine
 	go func() {
-		logger.Info("Starting HTTP server", "port", port)
-		serverErrors <- server.ListenAndServe()
+		serverErrors <- listenAndServe(ctx, server, appConfig.Server, logger)
 	}()
 
 	// Channel to listen for interrupt signals
@@ -192,13 +256,22 @@ func main() {
 	case sig := <-shutdown:
 		logger.Info("Received shutdown signal", "signal", sig)
 
-		// Cancel the context to stop background updater
-		cancel()
-
 		// Give outstanding operations 30 seconds to complete
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer shutdownCancel()
 
+		// Let the background updater finish its current cycle before cancelling requests
+		if appConfig.Mode == ModePush {
+			exporter.Stop()
+			select {
+			case <-exporter.Done():
+				logger.Info("Metrics updater stopped")
+			case <-shutdownCtx.Done():
+				logger.Warn("Metrics updater did not stop in time, cancelling outstanding requests")
+			}
+		}
+		cancel()
+
 		// Gracefully shutdown the HTTP server
 		if err := server.Shutdown(shutdownCtx); err != nil {
 			logger.Error("Error during server shutdown", "error", err)
@@ -212,26 +285,186 @@ func main() {
 	}
 }
 
-func initSmartCitizenProvider(appConfig AppConfig, registry *metric.NamespacedRegistry, logger *slog.Logger) (*smartcitizen.HTTPProvider, error) {
-	smcCredProvider := smartcitizen.NewUserCredentialEnvProvider(appConfig.Smc.UsernameEnv, appConfig.Smc.PasswordEnv, appConfig.Smc.TokenEnv)
-	credentials, err := smcCredProvider.Retrieve(context.Background())
+// newServeMux routes the exporter endpoints, /metrics and /reload require the metrics_auth credentials
+// while the probes and the landing page stay open
+func newServeMux(ctx context.Context, appConfig AppConfig, promRegistry *prometheus.Registry,
+	exporter *smartcitizen.APIExporter, logger *slog.Logger,
+) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", requireAuth(appConfig.Server.MetricsAuth, promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	})))
+
+	mux.Handle("/reload", requireAuth(appConfig.Server.MetricsAuth, newReloadHandler(ctx, exporter, MinReloadInterval, clock.Real(), logger)))
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		// with smartcitizen.require_devices an account without devices isn't ready
+		if err := exporter.Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte("OK")); err != nil {
+			logger.Error("Failed to write /readyz response", "error", err)
+			return
+		}
+	})
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte("OK")); err != nil {
+			logger.Error("Failed to write /healthz response", "error", err)
+			return
+		}
+	})
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte(`<html>
+			<head><title>SmartCitizen Exporter</title></head>
+			<body>
+			<h1>Prometheus Exporter for SmartCitizen devices</h1>
+			<p><a href="/metrics">Metrics</a></p>
+			<p>Metrics are dynamically registered and updated</p>
+			</body>
+			</html>`)); err != nil {
+			logger.Error("Failed to write root (/) response", "error", err)
+			return
+		}
+	})
+
+	return mux
+}
+
+// updateTrigger runs a metrics update outside of the update interval, implemented by smartcitizen.APIExporter
+type updateTrigger interface {
+	TriggerUpdate(ctx context.Context) error
+}
+
+// newReloadHandler triggers an immediate metrics update on POST /reload,
+// manual reloads are allowed at most once per minInterval
+func newReloadHandler(ctx context.Context, exporter updateTrigger, minInterval time.Duration, clk clock.Clock, logger *slog.Logger) http.HandlerFunc {
+	var mu sync.Mutex
+	var lastReload time.Time
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		mu.Lock()
+		now := clk.Now()
+		if since := now.Sub(lastReload); since < minInterval {
+			mu.Unlock()
+			retryAfter := (minInterval - since).Round(time.Second)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			http.Error(w, "reload requested too soon, retry after "+retryAfter.String(), http.StatusTooManyRequests)
+			return
+		}
+		lastReload = now
+		mu.Unlock()
+
+		logger.Info("Manual metrics reload requested", "remoteAddr", r.RemoteAddr)
+		err := exporter.TriggerUpdate(ctx)
+		switch {
+		case errors.Is(err, smartcitizen.ErrUpdateInProgress):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "reload failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		if _, err := w.Write([]byte("OK")); err != nil {
+			logger.Error("Failed to write /reload response", "error", err)
+		}
+	}
+}
+
+// newPromRegistry creates the registry served on /metrics with the Go runtime and process
+// metrics the default registry would expose, the exporter metrics are registered by the caller
+func newPromRegistry() *prometheus.Registry {
+	promRegistry := prometheus.NewRegistry()
+	promRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return promRegistry
+}
+
+// runSelfTest exercises the whole pipeline with a single device: it authenticates,
+// fetches the device, converts it into a throwaway registry and prints the metrics
+func runSelfTest(ctx context.Context, appConfig AppConfig, w io.Writer, logger *slog.Logger) error {
+	promRegistry := prometheus.NewRegistry()
+	registry := metric.NewNamespacedRegistryWithRegisterer(appConfig.Namespace, promRegistry, logger)
+
+	smcProvider, err := initSmartCitizenProvider(appConfig, registry, logger)
 	if err != nil {
-		logger.Error("Failed to retrieve SmartCitizen credentials", "error", err)
-		return nil, fmt.Errorf("failed to retrieve SmartCitizen credentials: %w", err)
+		return err
 	}
 
-	smcProvider := smartcitizen.NewHTTPProvider(appConfig.Smc,
-		httpclient.NewDefaultHTTPClient(),
-		registry,
-		logger,
+	sensorMapping, err := initSensorMapping(appConfig.SensorMapping, logger)
+	if err != nil {
+		return err
+	}
+
+	device, err := fetchSelfTestDevice(ctx, smcProvider, appConfig.Smc)
+	if err != nil {
+		return err
+	}
+	logger.Info("Fetched self-test device", "deviceID", device.ID, "name", device.Name,
+		"sensorsCount", len(device.Data.Sensors))
+
+	exporter := smartcitizen.NewAPIExporterWithRegistry(appConfig.Smc,
+		smcProvider, registry, sensorMapping, logger,
 	)
+	if err := exporter.ConvertDevice(*device); err != nil {
+		return fmt.Errorf("failed to convert device: %w", err)
+	}
+
+	families, err := promRegistry.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			return err
+		}
+	}
 
-	if err := smcProvider.Authenticate(context.Background(), credentials); err != nil {
-		logger.Error("Failed to authenticate with SmartCitizen API", "error", err)
-		return nil, fmt.Errorf("failed to authenticate with SmartCitizen API: %w", err)
+	return nil
+}
+
+// fetchSelfTestDevice returns the first device of the user or the first public device
+func fetchSelfTestDevice(ctx context.Context, provider smartcitizen.Provider, config smartcitizen.Config) (*smartcitizen.DeviceDetail, error) {
+	if config.PublicMode {
+		if len(config.PublicDeviceIDs) == 0 {
+			return nil, fmt.Errorf("no public devices configured")
+		}
+
+		return provider.GetPublicDevice(ctx, config.PublicDeviceIDs[0])
 	}
 
-	return smcProvider, nil
+	user, err := provider.GetMe(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authenticated user: %w", err)
+	}
+
+	if len(user.Devices) == 0 {
+		return nil, fmt.Errorf("user %s has no devices", user.Username)
+	}
+
+	return provider.GetDevice(ctx, user.Devices[0].ID)
+}
+
+func initSmartCitizenProvider(appConfig AppConfig, registry *metric.NamespacedRegistry, logger *slog.Logger) (*smartcitizen.HTTPProvider, error) {
+	return smartcitizen.NewAuthenticatedProvider(context.Background(), appConfig.Smc,
+		smartcitizen.NewCredentialProvider(appConfig.Smc), registry, logger,
+	)
 }
 
 func initSensorMapping(mappingConfig map[string]metric.MetricMappingItem, logger *slog.Logger) (*metric.SensorMetricMapping, error) {
@@ -239,35 +472,24 @@ func initSensorMapping(mappingConfig map[string]metric.MetricMappingItem, logger
 		return nil, fmt.Errorf("logger cannot be nil")
 	}
 
-	sensorMapping := metric.NewSensorMetricMapping()
-	for sensorName, item := range mappingConfig {
-		sensorMapping.Add(sensorName, item)
-		logger.Debug("Added sensor mapping", "sensor", sensorName, "metric", item.Metric, "category", item.Category)
+	sensorMapping, err := smartcitizen.NewSensorMetricMapping(mappingConfig)
+	if err != nil {
+		return nil, err
 	}
 
+	logger.Info("Loaded sensor mapping", "sensors", sensorMapping.Len())
 	return sensorMapping, nil
 }
 
-func loadConfigFromJSONFile(path string) (AppConfig, error) {
-	var config AppConfig
-	// Clean the path to prevent path traversal attacks
-	cleanPath := filepath.Clean(path)
-	file, err := os.Open(cleanPath)
-	if err != nil {
-		return config, err
-	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			fmt.Fprintf(os.Stderr, "Failed to close config file: %v\n", closeErr)
-		}
-	}()
-
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return config, err
-	}
+// loadConfig layers the configuration as defaults < config file < environment, see configfile.Load
+func loadConfig(path, dotEnvPath string, strict bool) (AppConfig, error) {
+	return configfile.Load[AppConfig](path, DefaultConfigPath, dotEnvPath, strict)
+}
 
-	config.ApplyDefaults()
+// StdinConfigPath as the config path reads the configuration from stdin, e.g. generated by a template
+const StdinConfigPath = configfile.StdinPath
 
-	return config, nil
+// decodeConfig decodes the JSON configuration, source names the input in errors
+func decodeConfig(r io.Reader, source string, strict bool) (AppConfig, error) {
+	return configfile.Decode[AppConfig](r, source, strict)
 }
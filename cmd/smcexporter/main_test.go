@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/timgluz/smcprober/clock"
+	"github.com/timgluz/smcprober/metric"
+	"github.com/timgluz/smcprober/smartcitizen"
+)
+
+// unsetEnv clears the variables for the test, also the ones a loaded .env file sets later
+func unsetEnv(t *testing.T, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		t.Setenv(name, "")
+		if err := os.Unsetenv(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfigLayering(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string
+		dotEnv     string
+		dotEnvFlag bool
+		env        map[string]string
+
+		wantNamespace string
+		wantInterval  int
+		wantEndpoint  string
+	}{
+		{
+			name:          "defaults",
+			config:        `{}`,
+			wantNamespace: smartcitizen.DefaultNamespace,
+			wantInterval:  30,
+			wantEndpoint:  smartcitizen.DefaultEndpoint,
+		},
+		{
+			name:          "config file overrides defaults",
+			config:        `{"namespace": "file", "scrape_interval": 60, "smartcitizen": {"endpoint": "https://file.example"}}`,
+			wantNamespace: "file",
+			wantInterval:  60,
+			wantEndpoint:  "https://file.example",
+		},
+		{
+			name:          "environment overrides config file",
+			config:        `{"namespace": "file", "scrape_interval": 60}`,
+			env:           map[string]string{EnvNamespace: "env", smartcitizen.EnvEndpoint: "https://env.example"},
+			wantNamespace: "env",
+			wantInterval:  60,
+			wantEndpoint:  "https://env.example",
+		},
+		{
+			name:          "dotenv of the config file overrides config file",
+			config:        `{"namespace": "file", "dotenv_path": "DOTENV"}`,
+			dotEnv:        "SMC_NAMESPACE=dotenv\nSMC_SCRAPE_INTERVAL=90\n",
+			wantNamespace: "dotenv",
+			wantInterval:  90,
+			wantEndpoint:  smartcitizen.DefaultEndpoint,
+		},
+		{
+			name:          "dotenv of the flag overrides config file",
+			config:        `{"namespace": "file"}`,
+			dotEnv:        "SMC_NAMESPACE=dotenv\n",
+			dotEnvFlag:    true,
+			wantNamespace: "dotenv",
+			wantInterval:  30,
+			wantEndpoint:  smartcitizen.DefaultEndpoint,
+		},
+		{
+			name:          "environment wins over dotenv",
+			config:        `{"namespace": "file", "dotenv_path": "DOTENV"}`,
+			dotEnv:        "SMC_NAMESPACE=dotenv\nSMC_SCRAPE_INTERVAL=90\n",
+			env:           map[string]string{EnvNamespace: "env"},
+			wantNamespace: "env",
+			wantInterval:  90,
+			wantEndpoint:  smartcitizen.DefaultEndpoint,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetEnv(t, EnvNamespace, EnvScrapeInterval, EnvDotEnvPath, EnvMode, smartcitizen.EnvEndpoint)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			dir := t.TempDir()
+			dotEnvPath := ""
+			if tt.dotEnv != "" {
+				dotEnvPath = writeFile(t, dir, ".env", tt.dotEnv)
+			}
+
+			// the DOTENV placeholder of the config file is replaced with the path of the .env file
+			config := tt.config
+			if !tt.dotEnvFlag {
+				config = strings.Replace(config, "DOTENV", filepath.ToSlash(dotEnvPath), 1)
+			}
+			configPath := writeFile(t, dir, "config.json", config)
+
+			flagValue := ""
+			if tt.dotEnvFlag {
+				flagValue = dotEnvPath
+			}
+
+			appConfig, err := loadConfig(configPath, flagValue, true)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if appConfig.Namespace != tt.wantNamespace {
+				t.Errorf("expected namespace %q, got %q", tt.wantNamespace, appConfig.Namespace)
+			}
+
+			if appConfig.ScrapeInterval != tt.wantInterval {
+				t.Errorf("expected scrape interval %d, got %d", tt.wantInterval, appConfig.ScrapeInterval)
+			}
+
+			if appConfig.Smc.Endpoint != tt.wantEndpoint {
+				t.Errorf("expected endpoint %q, got %q", tt.wantEndpoint, appConfig.Smc.Endpoint)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissingDotEnv(t *testing.T) {
+	unsetEnv(t, EnvDotEnvPath)
+
+	configPath := writeFile(t, t.TempDir(), "config.json", `{}`)
+	if _, err := loadConfig(configPath, filepath.Join(t.TempDir(), "missing.env"), false); err == nil {
+		t.Fatal("expected an error for a missing .env file")
+	}
+}
+
+// setStdin replaces stdin with the content for the test
+func setStdin(t *testing.T, content string) {
+	t.Helper()
+
+	stdin := writeFile(t, t.TempDir(), "stdin", content)
+	file, err := os.Open(stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() {
+		os.Stdin = original
+		file.Close()
+	})
+}
+
+func TestDecodeConfig(t *testing.T) {
+	appConfig, err := decodeConfig(strings.NewReader(`{"namespace": "piped", "scrape_interval": 60}`), "from stdin", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if appConfig.Namespace != "piped" || appConfig.ScrapeInterval != 60 {
+		t.Errorf("unexpected config %+v", appConfig)
+	}
+
+	_, err = decodeConfig(strings.NewReader(`{"namespce": "typo"}`), "from stdin", true)
+	if err == nil || !strings.Contains(err.Error(), "from stdin") {
+		t.Errorf("expected strict decoding to reject the unknown field and name the source, got %v", err)
+	}
+
+	if _, err := decodeConfig(strings.NewReader(`{"namespce": "typo"}`), "from stdin", false); err != nil {
+		t.Errorf("expected unknown fields to be ignored without strict decoding, got %v", err)
+	}
+}
+
+func TestLoadConfigFromStdin(t *testing.T) {
+	unsetEnv(t, EnvNamespace, EnvScrapeInterval, EnvDotEnvPath, EnvMode, smartcitizen.EnvEndpoint)
+	setStdin(t, `{"namespace": "piped"}`)
+
+	appConfig, err := loadConfig(StdinConfigPath, "", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if appConfig.Namespace != "piped" {
+		t.Errorf("expected the namespace from stdin, got %q", appConfig.Namespace)
+	}
+
+	// defaults still apply to the values stdin leaves out
+	if appConfig.ScrapeInterval != 30 || appConfig.Smc.Endpoint != smartcitizen.DefaultEndpoint {
+		t.Errorf("expected the defaults, got interval %d and endpoint %q", appConfig.ScrapeInterval, appConfig.Smc.Endpoint)
+	}
+}
+
+func TestAppConfigValidateSettings(t *testing.T) {
+	appConfig := AppConfig{}
+	appConfig.ApplyDefaults()
+	unsetEnv(t, appConfig.Smc.UsernameEnv, appConfig.Smc.PasswordEnv, appConfig.Smc.TokenEnv)
+
+	if err := appConfig.ValidateSettings(); err != nil {
+		t.Fatalf("expected the defaults to be valid without credentials, got %v", err)
+	}
+
+	if err := appConfig.Validate(); err == nil {
+		t.Error("expected Validate to report the missing credentials")
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *AppConfig)
+		want   string
+	}{
+		{name: "sensor labels", modify: func(c *AppConfig) { c.Smc.SensorLabels = map[string]string{"serial": "sn"} }, want: "unknown sensor label"},
+		{name: "aqi", modify: func(c *AppConfig) { c.Smc.AQI = &smartcitizen.AQIConfig{} }, want: "aqi needs at least one pollutant"},
+		{name: "smoothing alpha", modify: func(c *AppConfig) { c.Smc.SmoothingAlpha = 1.5 }, want: "smoothing_alpha"},
+		{name: "patterns", modify: func(c *AppConfig) { c.Smc.IncludeSensors = []string{"PM["} }, want: "invalid sensor pattern"},
+		{name: "mapping item", modify: func(c *AppConfig) {
+			c.SensorMapping = map[string]metric.MetricMappingItem{"Temperature": {Category: "environment"}}
+		}, want: "metric must not be empty"},
+	}
+
+	for _, tt := range tests {
+		invalid := appConfig
+		tt.modify(&invalid)
+
+		err := invalid.ValidateSettings()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+// stubTrigger counts the updates and fails them with err
+type stubTrigger struct {
+	err   error
+	calls int
+}
+
+func (s *stubTrigger) TriggerUpdate(ctx context.Context) error {
+	s.calls++
+	return s.err
+}
+
+func reload(handler http.Handler, method string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, "/reload", nil))
+	return rec
+}
+
+func TestReloadHandler(t *testing.T) {
+	trigger := &stubTrigger{}
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+	handler := newReloadHandler(context.Background(), trigger, MinReloadInterval, fakeClock, slog.New(slog.DiscardHandler))
+
+	rec := reload(handler, http.MethodGet)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: expected status 405, got %d", rec.Code)
+	}
+
+	if got := rec.Header().Get("Allow"); got != http.MethodPost {
+		t.Errorf("GET: expected Allow: POST, got %q", got)
+	}
+
+	if rec := reload(handler, http.MethodPost); rec.Code != http.StatusOK {
+		t.Fatalf("expected the first reload to succeed, got %d", rec.Code)
+	}
+
+	fakeClock.Advance(MinReloadInterval - 10*time.Second)
+	rec = reload(handler, http.MethodPost)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 within the interval, got %d", rec.Code)
+	}
+
+	if got := rec.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("expected Retry-After: 10, got %q", got)
+	}
+
+	fakeClock.Advance(10 * time.Second)
+	if rec := reload(handler, http.MethodPost); rec.Code != http.StatusOK {
+		t.Errorf("expected a reload after the interval to succeed, got %d", rec.Code)
+	}
+
+	if trigger.calls != 2 {
+		t.Errorf("expected two updates, got %d", trigger.calls)
+	}
+}
+
+func TestReloadHandlerFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "update in progress", err: smartcitizen.ErrUpdateInProgress, want: http.StatusConflict},
+		{name: "failed update", err: fmt.Errorf("fetching device 1: %w", smartcitizen.ErrUnauthorized), want: http.StatusBadGateway},
+		{name: "other error", err: errors.New("connection refused"), want: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		trigger := &stubTrigger{err: tt.err}
+		fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+		handler := newReloadHandler(context.Background(), trigger, MinReloadInterval, fakeClock, slog.New(slog.DiscardHandler))
+
+		if rec := reload(handler, http.MethodPost); rec.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, rec.Code)
+		}
+
+		if trigger.calls != 1 {
+			t.Errorf("%s: expected one update, got %d", tt.name, trigger.calls)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Server timeout defaults, the write timeout leaves room for scrapes in pull mode,
+// which wait for the API calls of the update
+const (
+	DefaultReadHeaderTimeoutSeconds = 5
+	DefaultReadTimeoutSeconds       = 10
+	DefaultWriteTimeoutSeconds      = 60
+	DefaultIdleTimeoutSeconds       = 120
+)
+
+// ServerConfig hardens the HTTP server of the exporter, e.g. against slow clients holding connections
+type ServerConfig struct {
+	ReadHeaderTimeoutSeconds int `json:"read_header_timeout_seconds,omitempty"`
+	ReadTimeoutSeconds       int `json:"read_timeout_seconds,omitempty"`
+	WriteTimeoutSeconds      int `json:"write_timeout_seconds,omitempty"`
+	IdleTimeoutSeconds       int `json:"idle_timeout_seconds,omitempty"`
+
+	// TLSCertFile and TLSKeyFile serve HTTPS instead of HTTP, SIGHUP reloads them after a rotation
+	TLSCertFile string `json:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `json:"tls_key_file,omitempty"`
+
+	// MetricsAuth protects /metrics and /reload, the probes stay unauthenticated
+	MetricsAuth MetricsAuthConfig `json:"metrics_auth"`
+}
+
+func (c *ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+func (c *ServerConfig) ApplyDefaults() {
+	if c.ReadHeaderTimeoutSeconds == 0 {
+		c.ReadHeaderTimeoutSeconds = DefaultReadHeaderTimeoutSeconds
+	}
+
+	if c.ReadTimeoutSeconds == 0 {
+		c.ReadTimeoutSeconds = DefaultReadTimeoutSeconds
+	}
+
+	if c.WriteTimeoutSeconds == 0 {
+		c.WriteTimeoutSeconds = DefaultWriteTimeoutSeconds
+	}
+
+	if c.IdleTimeoutSeconds == 0 {
+		c.IdleTimeoutSeconds = DefaultIdleTimeoutSeconds
+	}
+}
+
+func (c *ServerConfig) Validate() error {
+	var errs []error
+	if c.ReadHeaderTimeoutSeconds < 0 || c.ReadTimeoutSeconds < 0 || c.WriteTimeoutSeconds < 0 || c.IdleTimeoutSeconds < 0 {
+		errs = append(errs, fmt.Errorf("server timeouts must not be negative"))
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, fmt.Errorf("server tls_cert_file and tls_key_file must be set together"))
+	}
+
+	if err := c.MetricsAuth.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// newServer creates the HTTP server listening on the port with the configured timeouts
+func newServer(config ServerConfig, port string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(config.ReadHeaderTimeoutSeconds) * time.Second,
+		ReadTimeout:       time.Duration(config.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      time.Duration(config.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:       time.Duration(config.IdleTimeoutSeconds) * time.Second,
+	}
+}
+
+// certReloader serves the certificate loaded last, so it could be rotated without a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// Reload loads the certificate and key files, on failure the previous certificate stays in use
+func (r *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	return nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// reloadOnSIGHUP reloads the certificate on every SIGHUP until the context is done
+func (r *certReloader) reloadOnSIGHUP(ctx context.Context, logger *slog.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := r.Reload(); err != nil {
+				logger.Error("Failed to reload TLS certificate, keeping the current one", "error", err)
+				continue
+			}
+
+			logger.Info("Reloaded TLS certificate", "certFile", r.certFile)
+		}
+	}
+}
+
+// listenAndServe serves HTTPS when TLS is configured, otherwise HTTP
+func listenAndServe(ctx context.Context, server *http.Server, config ServerConfig, logger *slog.Logger) error {
+	if !config.TLSEnabled() {
+		logger.Info("Starting HTTP server", "addr", server.Addr)
+		return server.ListenAndServe()
+	}
+
+	reloader, err := newCertReloader(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return err
+	}
+	go reloader.reloadOnSIGHUP(ctx, logger)
+
+	server.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	logger.Info("Starting HTTPS server", "addr", server.Addr, "certFile", config.TLSCertFile)
+	// the certificate comes from the TLS config, so no files are passed
+	return server.ListenAndServeTLS("", "")
+}
@@ -3,16 +3,24 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
-
-	"github.com/joho/godotenv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/timgluz/smcprober/alert"
+	"github.com/timgluz/smcprober/clock"
+	"github.com/timgluz/smcprober/configfile"
+	"github.com/timgluz/smcprober/envconfig"
 	"github.com/timgluz/smcprober/httpclient"
+	"github.com/timgluz/smcprober/logging"
 	"github.com/timgluz/smcprober/metric"
 	"github.com/timgluz/smcprober/ntfy"
 	"github.com/timgluz/smcprober/smartcitizen"
@@ -21,8 +29,20 @@ import (
 const (
 	DefaultConfigPath        = "configs/config.json"
 	DefaultBatterySensorName = "Battery SCK"
+	DefaultConcurrency       = 4
 
 	DeviceStateMetricName = "Device State"
+
+	// DeviceUnknownAfter is how long a device may report an unknown state before it is notified,
+	// measured from its last update
+	DeviceUnknownAfter = time.Hour
+
+	EnvBatterySensorName = "SMC_BATTERY_SENSOR_NAME"
+	EnvLogLevel          = "SMC_LOG_LEVEL"
+	EnvLogFormat         = "SMC_LOG_FORMAT"
+	EnvDotEnvPath        = configfile.EnvDotEnvPath
+	EnvConcurrency       = "SMC_CONCURRENCY"
+	EnvStatePath         = "SMC_STATE_PATH"
 )
 
 var (
@@ -33,141 +53,353 @@ type AppConfig struct {
 	BatterySensorName string `json:"battery_sensor_name"`
 
 	LogLevel   string `json:"log_level"`
+	LogFormat  string `json:"log_format"`
 	DotEnvPath string `json:"dotenv_path"`
 
+	// Concurrency limits how many devices are fetched in parallel
+	Concurrency int `json:"concurrency"`
+
+	// StatePath keeps the alert state between runs of the job, e.g. which batteries are low,
+	// so the battery_low rule only resolves above 20%; empty forgets it after every run
+	StatePath string `json:"state_path,omitempty"`
+
+	// QuietHours keeps the non-critical notifications quiet, e.g. at night
+	QuietHours *QuietHoursConfig `json:"quiet_hours,omitempty"`
+
 	Ntfy ntfy.Config         `json:"ntfy"`
 	Smc  smartcitizen.Config `json:"smartcitizen"`
 }
 
+func (c *AppConfig) ApplyDefaults() {
+	if c.BatterySensorName == "" {
+		c.BatterySensorName = DefaultBatterySensorName
+	}
+
+	if c.Concurrency <= 0 {
+		c.Concurrency = DefaultConcurrency
+	}
+
+	c.Ntfy.ApplyDefaults()
+	c.Smc.ApplyDefaults()
+}
+
+// ApplyEnv overrides config values with the environment variables that are set
+func (c *AppConfig) ApplyEnv() error {
+	envconfig.String(EnvBatterySensorName, &c.BatterySensorName)
+	envconfig.String(EnvLogLevel, &c.LogLevel)
+	envconfig.String(EnvLogFormat, &c.LogFormat)
+	envconfig.String(EnvStatePath, &c.StatePath)
+
+	c.Ntfy.ApplyEnv()
+	return errors.Join(
+		envconfig.Int(EnvConcurrency, &c.Concurrency),
+		c.Smc.ApplyEnv(),
+	)
+}
+
+// DotEnvFile points to the .env file path, loaded before the environment by configfile.Load
+func (c *AppConfig) DotEnvFile() *string {
+	return &c.DotEnvPath
+}
+
+// Validate checks the configuration and referenced environment variables
+func (c *AppConfig) Validate() error {
+	var errs []error
+
+	if c.BatterySensorName == "" {
+		errs = append(errs, fmt.Errorf("battery_sensor_name must be set"))
+	}
+
+	if c.QuietHours != nil {
+		if _, err := c.QuietHours.Schedule(); err != nil {
+			errs = append(errs, fmt.Errorf("quiet_hours: %w", err))
+		}
+	}
+
+	if err := c.Ntfy.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.Smc.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// QuietHoursConfig suppresses non-critical notifications from start until end hour,
+// critical ones like a critically low battery are always sent
+type QuietHoursConfig struct {
+	StartHour int `json:"start_hour"`
+	EndHour   int `json:"end_hour"`
+	// Timezone of the hours, e.g. Europe/Tallinn, empty uses the local time zone
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Schedule returns the alert schedule allowing notifications outside of the quiet hours
+func (c *QuietHoursConfig) Schedule() (*alert.Schedule, error) {
+	schedule := alert.QuietHours(c.StartHour, c.EndHour)
+	if c.Timezone != "" {
+		location, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+		}
+		schedule.Location = location
+	}
+
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
 func main() {
 	var configPath string
 	var dotEnvPath string
+	var validateOnly bool
+	var strict bool
+	var reportPath string
 
-	flag.StringVar(&configPath, "config", DefaultConfigPath, "Path to configuration file")
+	flag.StringVar(&configPath, "config", DefaultConfigPath, "Path to configuration file, - reads it from stdin")
 	flag.StringVar(&dotEnvPath, "dotenv", "", "Path to .env file (overrides config file setting)")
+	flag.StringVar(&reportPath, "report", "", "Path to write a JSON report of all rule evaluations")
+	flag.BoolVar(&validateOnly, "validate", false, "Validate the configuration and exit without running")
+	flag.BoolVar(&strict, "strict", false, "Reject unknown keys in the configuration file")
 	flag.Parse()
 
-	appConfig, err := loadConfigFromJSONFile(configPath)
+	appConfig, err := loadConfig(configPath, dotEnvPath, strict)
 	if err != nil {
 		fmt.Println("Error loading config:", err)
 		os.Exit(1)
 	}
 
-	if dotEnvPath != "" {
-		appConfig.DotEnvPath = dotEnvPath
-	}
-
-	if appConfig.DotEnvPath != "" {
-		fmt.Println("Loading .env file from:", appConfig.DotEnvPath)
-		if err := godotenv.Load(appConfig.DotEnvPath); err != nil {
-			fmt.Println("Error loading .env file:", err)
+	if validateOnly {
+		if err := appConfig.Validate(); err != nil {
+			fmt.Println("Invalid configuration:")
+			fmt.Println(err)
 			os.Exit(1)
 		}
+
+		fmt.Println("Configuration is valid")
+		os.Exit(0)
 	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	logger := logging.NewLogger(os.Stdout, appConfig.LogLevel, appConfig.LogFormat)
+
+	// Cancel outstanding requests and notifications on interrupt
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-shutdown:
+			logger.Warn("Received shutdown signal, cancelling outstanding requests", "signal", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
 	// Create shared metric registry
 	namespace := "smartcitizen"
 	registry := metric.NewNamespacedRegistry(namespace, logger)
 
-	smcProvider, err := initSmartCitizenProvider(appConfig, registry, logger)
+	smcProvider, err := initSmartCitizenProvider(ctx, appConfig, registry, logger)
 	if err != nil {
 		logger.Error("Failed to initialize SmartCitizen provider", "error", err)
-		panic(err)
+		os.Exit(1)
 	}
 
-	if err := smcProvider.Ping(context.Background()); err != nil {
+	if err := smcProvider.Ping(ctx); err != nil {
 		logger.Error("Failed to ping SmartCitizen API", "error", err)
 		os.Exit(1)
 	}
 
-	user, err := smcProvider.GetMe(context.Background())
+	user, err := fetchUser(ctx, smcProvider, appConfig.Smc)
 	if err != nil {
 		logger.Error("Failed to get authenticated user", "error", err)
-		panic(err)
+		os.Exit(1)
 	}
 
 	logger.Info("Authenticated user", "userID", user.ID, "username", user.Username)
-	notifier, err := initNtfyNotifier(appConfig, logger)
+	clk := clock.Real()
+	notifier, err := initNotifier(appConfig, ntfy.DefaultNotifierRegistry(), registry, clk, logger)
 	if err != nil {
-		logger.Error("Failed to initialize ntfy notifier", "error", err)
-		panic(err)
+		logger.Error("Failed to initialize notifier", "type", appConfig.Ntfy.Type, "error", err)
+		os.Exit(1)
 	}
 
-	alertEngine, err := initAlertEngine(appConfig, notifier, logger)
+	var state jobState
+	if appConfig.StatePath != "" {
+		if state, err = loadJobState(appConfig.StatePath); err != nil {
+			logger.Error("Failed to load job state", "path", appConfig.StatePath, "error", err)
+			os.Exit(1)
+		}
+	} else {
+		logger.Info("No state_path set, alert state is not kept between runs")
+	}
+
+	// notifications sent by the previous runs are duplicates within the dedupe window
+	dedupe, _ := notifier.(*ntfy.DedupeNotifier)
+	if dedupe != nil {
+		dedupe.Restore(state.Notified)
+	}
+
+	batteryLow := alert.NewHysteresisState(state.BatteryLow...)
+	alertEngine, err := initAlertEngine(ctx, appConfig, notifier, clk, batteryLow, logger)
 	if err != nil {
 		logger.Error("Failed to initialize alert engine", "error", err)
-		panic(err)
+		os.Exit(1)
 	}
 
-	for _, device := range user.Devices {
-		logger.Info("User device", "deviceID", device.ID, "name", device.Name, "state", device.State)
-		deviceDetail, err := smcProvider.GetDevice(context.Background(), device.ID)
-		if err != nil {
-			panic(err)
+	details, fetchErrs := fetchDevices(ctx, smcProvider, user.Devices, appConfig.Concurrency, logger)
+	if ctx.Err() != nil {
+		logger.Warn("Job interrupted, skipping device evaluation",
+			"fetchedDevices", len(details), "totalDevices", len(user.Devices))
+		os.Exit(1)
+	}
+
+	results := make([]alert.RuleResult, 0)
+	for _, deviceDetail := range details {
+		results = append(results, evaluateDevice(alertEngine, deviceDetail)...)
+	}
+
+	logger.Info("Finished evaluating devices", "evaluatedDevices", len(details), "totalDevices", len(user.Devices))
+	if appConfig.StatePath != "" {
+		state.BatteryLow = batteryLow.Firing()
+		if dedupe != nil {
+			state.Notified = dedupe.Sent()
 		}
 
-		if deviceDetail == nil {
-			logger.Warn("Device detail is nil", "deviceID", device.ID)
-			continue
+		if err := saveJobState(appConfig.StatePath, state); err != nil {
+			logger.Error("Failed to save job state", "path", appConfig.StatePath, "error", err)
+			os.Exit(1)
 		}
+	}
 
-		logger.Info("Fetched device detail", "deviceID", deviceDetail.ID, "name", deviceDetail.Name, "state", deviceDetail.State, "sensorsCount", len(deviceDetail.Data.Sensors))
+	if reportPath != "" {
+		if err := writeReport(reportPath, results); err != nil {
+			logger.Error("Failed to write evaluation report", "path", reportPath, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Wrote evaluation report", "path", reportPath, "results", len(results))
+	}
 
-		evaluateDevice(alertEngine, deviceDetail)
+	if len(fetchErrs) > 0 {
+		logger.Error("Failed to fetch some devices", "failedDevices", len(fetchErrs), "error", errors.Join(fetchErrs...))
+		os.Exit(1)
 	}
 }
 
-func loadConfigFromJSONFile(path string) (AppConfig, error) {
-	var config AppConfig
-	// Clean the path to prevent path traversal attacks
-	cleanPath := filepath.Clean(path)
-	file, err := os.Open(cleanPath)
-	if err != nil {
-		return config, err
+// fetchUser returns the authenticated user, in public mode it returns
+// a placeholder user holding the configured public devices instead
+func fetchUser(ctx context.Context, provider smartcitizen.Provider, config smartcitizen.Config) (smartcitizen.User, error) {
+	if !config.PublicMode {
+		return provider.GetMe(ctx)
 	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			fmt.Fprintf(os.Stderr, "Failed to close config file: %v\n", closeErr)
+
+	user := smartcitizen.User{Username: "public"}
+	for _, deviceID := range config.PublicDeviceIDs {
+		user.Devices = append(user.Devices, smartcitizen.UserDevice{ID: deviceID})
+	}
+
+	return user, nil
+}
+
+// fetchDevices fetches device details with bounded concurrency,
+// it returns all successfully fetched devices together with the errors of failed ones
+func fetchDevices(ctx context.Context, provider smartcitizen.Provider, devices []smartcitizen.UserDevice,
+	concurrency int, logger *slog.Logger,
+) ([]*smartcitizen.DeviceDetail, []error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		details = make([]*smartcitizen.DeviceDetail, 0, len(devices))
+		errs    []error
+	)
+
+	slots := make(chan struct{}, max(concurrency, 1))
+	for _, device := range devices {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return details, append(errs, ctx.Err())
+		case slots <- struct{}{}:
 		}
-	}()
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return config, err
+		wg.Add(1)
+		go func(device smartcitizen.UserDevice) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			logger.Info("User device", "deviceID", device.ID, "name", device.Name, "state", device.State)
+			deviceDetail, err := provider.GetDevice(ctx, device.ID)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				logger.Error("Failed to get device detail", "deviceID", device.ID, "error", err)
+				errs = append(errs, fmt.Errorf("device %d: %w", device.ID, err))
+				return
+			}
+
+			if deviceDetail == nil {
+				logger.Warn("Device detail is nil", "deviceID", device.ID)
+				return
+			}
+
+			logger.Info("Fetched device detail", "deviceID", deviceDetail.ID, "name", deviceDetail.Name, "state", deviceDetail.State, "sensorsCount", len(deviceDetail.Data.Sensors))
+			details = append(details, deviceDetail)
+		}(device)
 	}
 
-	config.Ntfy.ApplyDefaults()
-	config.Smc.ApplyDefaults()
+	wg.Wait()
+	return details, errs
+}
+
+// loadConfig layers the configuration as defaults < config file < environment, see configfile.Load
+func loadConfig(path, dotEnvPath string, strict bool) (AppConfig, error) {
+	return configfile.Load[AppConfig](path, DefaultConfigPath, dotEnvPath, strict)
+}
+
+// StdinConfigPath as the config path reads the configuration from stdin, e.g. generated by a template
+const StdinConfigPath = configfile.StdinPath
 
-	return config, nil
+// decodeConfig decodes the JSON configuration, source names the input in errors
+func decodeConfig(r io.Reader, source string, strict bool) (AppConfig, error) {
+	return configfile.Decode[AppConfig](r, source, strict)
 }
 
-func initNtfyNotifier(appConfig AppConfig, logger *slog.Logger) (*ntfy.HTTPNotifier, error) {
+// initNotifier creates the notifier backend selected by the config type, counting its notifications in the metric registry;
+// with a dedupe window the clock decides when a notification may be sent again
+func initNotifier(appConfig AppConfig, notifiers *ntfy.NotifierRegistry, registry metric.Registry, c clock.Clock,
+	logger *slog.Logger,
+) (ntfy.Notifier, error) {
 	if logger == nil {
 		return nil, ErrLoggerNil
 	}
 
-	if appConfig.Ntfy.Endpoint == "" {
-		return nil, fmt.Errorf("ntfy endpoint cannot be empty")
+	notifier, err := notifiers.New(appConfig.Ntfy, registry, logger)
+	if err != nil {
+		return nil, err
 	}
 
-	notifier := ntfy.NewHTTPNotifier(appConfig.Ntfy.Endpoint, httpclient.NewDefaultHTTPClient(), logger)
-
-	if appConfig.Ntfy.TokenEnv != "" {
-		ntfyCredProvider := ntfy.NewTokenCredentialEnvProvider(appConfig.Ntfy.TokenEnv)
-		if err := notifier.SetCredentialProvider(ntfyCredProvider); err != nil {
-			logger.Warn("Failed to set ntfy credential provider", "error", err)
+	if appConfig.Ntfy.DedupeWindowSeconds > 0 {
+		dedupe, err := ntfy.NewDedupeNotifier(notifier, appConfig.Ntfy.DedupeWindowDuration())
+		if err != nil {
+			return nil, err
 		}
+		dedupe.SetClock(c)
+		return dedupe, nil
 	}
 
 	return notifier, nil
 }
 
-func initSmartCitizenProvider(appConfig AppConfig, registry metric.Registry, logger *slog.Logger) (*smartcitizen.HTTPProvider, error) {
+func initSmartCitizenProvider(ctx context.Context, appConfig AppConfig, registry metric.Registry, logger *slog.Logger) (*smartcitizen.HTTPProvider, error) {
 	if logger == nil {
 		return nil, ErrLoggerNil
 	}
@@ -176,119 +408,213 @@ func initSmartCitizenProvider(appConfig AppConfig, registry metric.Registry, log
 		return nil, fmt.Errorf("SmartCitizen endpoint cannot be empty")
 	}
 
-	smcCredProvider := smartcitizen.NewUserCredentialEnvProvider(appConfig.Smc.UsernameEnv, appConfig.Smc.PasswordEnv, appConfig.Smc.TokenEnv)
-	credentials, err := smcCredProvider.Retrieve(context.Background())
-	if err != nil {
-		logger.Error("Failed to retrieve SmartCitizen credentials", "error", err)
-		panic(err)
-	}
-
 	smcProvider := smartcitizen.NewHTTPProvider(appConfig.Smc,
 		httpclient.NewDefaultHTTPClient(),
 		registry,
 		logger,
 	)
 
-	if err := smcProvider.Authenticate(context.Background(), credentials); err != nil {
-		logger.Error("Failed to authenticate with SmartCitizen API", "error", err)
-		panic(err)
+	if appConfig.Smc.PublicMode {
+		logger.Info("Public mode enabled, skipping authentication", "devices", appConfig.Smc.PublicDeviceIDs)
+		return smcProvider, nil
+	}
+
+	smcCredProvider := smartcitizen.NewUserCredentialEnvProvider(appConfig.Smc.UsernameEnv, appConfig.Smc.PasswordEnv, appConfig.Smc.TokenEnv)
+	credentials, err := smcCredProvider.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve SmartCitizen credentials: %w", err)
+	}
+
+	if err := smcProvider.Authenticate(ctx, credentials); err != nil {
+		return nil, fmt.Errorf("failed to authenticate with SmartCitizen API: %w", err)
 	}
 
 	return smcProvider, nil
 }
 
-func initAlertEngine(appConfig AppConfig, notifier ntfy.Notifier, logger *slog.Logger) (*alert.AlertingEngine, error) {
+// initAlertEngine creates the rules of the job, batteryLow keeps the state of the battery_low rule
+func initAlertEngine(ctx context.Context, appConfig AppConfig, notifier ntfy.Notifier, c clock.Clock,
+	batteryLowState *alert.HysteresisState, logger *slog.Logger,
+) (*alert.AlertingEngine, error) {
 	if logger == nil {
 		return nil, ErrLoggerNil
 	}
 
 	engine := alert.NewAlertingEngine(logger)
+	engine.SetClock(c)
 	batterySensorName := appConfig.BatterySensorName
 
-	engine.AddRule(alert.AlertRule{
-		ID:         "battery_ok",
-		Name:       "Battery Level OK",
-		MetricName: batterySensorName,
-		Enabled:    true,
-		Condition: func(metric alert.Metric) bool {
-			return metric.Name == batterySensorName && metric.Value >= 15.0
+	// non-critical rules respect the quiet hours, they notify after them if the condition still holds
+	var quietHours *alert.Schedule
+	if appConfig.QuietHours != nil {
+		schedule, err := appConfig.QuietHours.Schedule()
+		if err != nil {
+			return nil, err
+		}
+		quietHours = schedule
+	}
+
+	// battery low fires below 15% and resolves only after the battery is charged above 20%
+	batteryLow, err := alert.ThresholdBelowWithHysteresisState(15.0, 20.0, batteryLowState)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []alert.AlertRule{
+		// the battery is ok whenever battery_low doesn't fire, between 15% and 20% it depends
+		// on whether the battery was low before, so the two rules never match together
+		{
+			ID:         "battery_ok",
+			Name:       "Battery Level OK",
+			MetricName: batterySensorName,
+			Enabled:    true,
+			Condition:  alert.Not(batteryLow),
+			Action:     alert.LogAction(logger),
 		},
-		Action: alert.LogAction(logger),
-	})
-
-	engine.AddRule(alert.AlertRule{
-		ID:         "battery_low",
-		Name:       "Battery Level Low",
-		MetricName: batterySensorName,
-		Enabled:    true,
-		Condition: func(metric alert.Metric) bool {
-			return metric.Name == batterySensorName && metric.Value < 15.0 && metric.Value >= 10.0
+
+		{
+			ID:         "battery_low",
+			Name:       "Battery Level Low",
+			MetricName: batterySensorName,
+			Enabled:    true,
+			Schedule:   quietHours,
+			// critically low batteries are reported by battery_critical_low
+			Condition: alert.And(batteryLow, alert.Not(alert.ThresholdBelow(10.0))),
+			Action: alert.MultiAction(
+				alert.LogAction(logger),
+				SendNotificationAction(ctx, notifier, c, appConfig.Ntfy.Topic, "Battery level is low"),
+			),
+		},
+
+		{
+			ID:         "battery_critical_low",
+			Name:       "Battery Level Low",
+			MetricName: batterySensorName,
+			Enabled:    true,
+			Condition:  alert.ThresholdBelow(10.0),
+			Action: alert.MultiAction(
+				alert.LogAction(logger),
+				SendNotificationAction(ctx, notifier, c, appConfig.Ntfy.Topic, "Battery level is critically low"),
+			),
 		},
-		Action: alert.MultiAction(
-			alert.LogAction(logger),
-			SendNotificationAction(notifier, appConfig.Ntfy.Topic, "Battery level is low"),
-		),
-	})
-
-	engine.AddRule(alert.AlertRule{
-		ID:         "battery_critical_low",
-		Name:       "Battery Level Low",
-		MetricName: batterySensorName,
-		Enabled:    true,
-		Condition: func(metric alert.Metric) bool {
-			return metric.Name == batterySensorName && metric.Value < 10.0
+
+		{
+			ID:         "device_online",
+			Name:       "Device Online",
+			MetricName: DeviceStateMetricName,
+			Enabled:    true,
+			Condition:  alert.StateEquals(smartcitizen.DeviceStateOnline),
+			Action:     alert.LogAction(logger),
 		},
-		Action: alert.MultiAction(
-			alert.LogAction(logger),
-			SendNotificationAction(notifier, appConfig.Ntfy.Topic, "Battery level is critically low"),
-		),
-	})
-
-	engine.AddRule(alert.AlertRule{
-		ID:         "device_online",
-		Name:       "Device Online",
-		MetricName: DeviceStateMetricName,
-		Enabled:    true,
-		Condition:  alert.ThresholdEquals(smartcitizen.DeviceStateOnline),
-		Action:     alert.LogAction(logger),
-	})
-
-	engine.AddRule(alert.AlertRule{
-		ID:         "device_offline",
-		Name:       "Device Offline",
-		MetricName: DeviceStateMetricName,
-		Enabled:    true,
-		Condition:  alert.ThresholdEquals(smartcitizen.DeviceStateOffline),
-		Action: alert.MultiAction(
-			alert.LogAction(logger),
-			SendNotificationAction(notifier, appConfig.Ntfy.Topic, "Device is offline"),
-		),
-	})
+
+		{
+			ID:         "device_offline",
+			Name:       "Device Offline",
+			MetricName: DeviceStateMetricName,
+			Enabled:    true,
+			Condition:  alert.StateEquals(smartcitizen.DeviceStateOffline),
+			Action: alert.MultiAction(
+				alert.LogAction(logger),
+				SendNotificationAction(ctx, notifier, c, appConfig.Ntfy.Topic, "Device is offline"),
+			),
+		},
+
+		// sleeping devices are expected to come back on their own, so only log them
+		{
+			ID:         "device_sleeping",
+			Name:       "Device Sleeping",
+			MetricName: DeviceStateMetricName,
+			Enabled:    true,
+			Condition:  alert.StateEquals(smartcitizen.DeviceStateSleeping),
+			Action:     alert.LogAction(logger),
+		},
+
+		// a device briefly reporting an unknown state, e.g. while it is set up, is not notified;
+		// without a known update time the device is notified right away
+		{
+			ID:         "device_unknown",
+			Name:       "Device State Unknown",
+			MetricName: DeviceStateMetricName,
+			Enabled:    true,
+			Schedule:   quietHours,
+			Condition: alert.And(
+				alert.StateEquals(smartcitizen.DeviceStateUnknown),
+				alert.StaleForWithClock(DeviceUnknownAfter, c, true),
+			),
+			Action: alert.MultiAction(
+				alert.LogAction(logger),
+				SendNotificationAction(ctx, notifier, c, appConfig.Ntfy.Topic, "Device reports an unknown state"),
+			),
+		},
+	}
+
+	for _, rule := range rules {
+		if err := engine.AddRule(rule); err != nil {
+			return nil, err
+		}
+	}
 
 	return engine, nil
 }
 
-func SendNotificationAction(notifier ntfy.Notifier, topic string, message string) alert.RuleAction {
+// SendNotificationAction sends the message, the clock dates the alert firing, see alertFiringID
+func SendNotificationAction(ctx context.Context, notifier ntfy.Notifier, c clock.Clock, topic string, message string) alert.RuleAction {
 	return func(metric alert.Metric, rule alert.AlertRule) error {
 		notification := ntfy.Notification{
 			Topic:   topic,
 			Title:   "Alert: " + rule.Name,
 			Message: message,
+			ID:      alertFiringID(rule, metric, c),
 		}
 
-		return notifier.Send(context.Background(), notification)
+		return notifier.Send(ctx, notification)
+	}
+}
+
+// SendNotificationWithAttachment sends a notification with an attachment URL,
+// ntfy downloads the file and shows it with the given filename
+func SendNotificationWithAttachment(ctx context.Context, notifier ntfy.Notifier, c clock.Clock,
+	topic, message, attachmentURL, filename string,
+) alert.RuleAction {
+	return func(metric alert.Metric, rule alert.AlertRule) error {
+		notification := ntfy.NewNotification(topic, "Alert: "+rule.Name, message,
+			ntfy.WithAttachment(attachmentURL),
+			ntfy.WithFilename(filename),
+			ntfy.WithID(alertFiringID(rule, metric, c)),
+		)
+
+		return notifier.Send(ctx, notification)
 	}
 }
 
-func evaluateDevice(engine *alert.AlertingEngine, deviceDetail *smartcitizen.DeviceDetail) {
-	metrics := mapDeviceSensorsToMetrics(deviceDetail.Data.Sensors)
+// alertFiringID stays the same for all runs of the job on the same day while the rule
+// keeps matching the device, so repeated notifications are recognized as duplicates
+func alertFiringID(rule alert.AlertRule, metric alert.Metric, c clock.Clock) string {
+	return ntfy.NotificationID(rule.ID, metric.Source, c.Now().UTC().Format(time.DateOnly))
+}
+
+func evaluateDevice(engine *alert.AlertingEngine, deviceDetail *smartcitizen.DeviceDetail) []alert.RuleResult {
+	metrics := mapDeviceSensorsToMetrics(deviceDetail.UUID, deviceDetail.Data.Sensors)
 	// add device-level metrics if needed
 	stateMetric := mapDeviceStateToMetric(deviceDetail)
 	metrics = append(metrics, stateMetric)
 
+	results := make([]alert.RuleResult, 0)
 	for _, metric := range metrics {
-		engine.Evaluate(metric)
+		results = append(results, engine.EvaluateWithResult(metric)...)
+	}
+
+	return results
+}
+
+// writeReport saves the rule evaluation results as a JSON array
+func writeReport(path string, results []alert.RuleResult) error {
+	content, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
 	}
+
+	return os.WriteFile(filepath.Clean(path), content, 0o600)
 }
 
 func mapDeviceStateToMetric(deviceDetail *smartcitizen.DeviceDetail) alert.Metric {
@@ -298,12 +624,17 @@ func mapDeviceStateToMetric(deviceDetail *smartcitizen.DeviceDetail) alert.Metri
 		Value:       deviceDetail.StateValue(),
 		Unit:        "state",
 		Timestamp:   smartcitizen.ParseTimeToUnix(deviceDetail.UpdatedAt),
+		Source:      deviceDetail.UUID,
 	}
 }
 
-func mapDeviceSensorsToMetrics(sensors []smartcitizen.DeviceSensor) []alert.Metric {
+func mapDeviceSensorsToMetrics(deviceUUID string, sensors []smartcitizen.DeviceSensor) []alert.Metric {
 	metrics := make([]alert.Metric, 0, len(sensors))
 	for _, sensor := range sensors {
+		// Ensure sensor has device UUID set
+		if sensor.DeviceUUID == "" {
+			sensor.DeviceUUID = deviceUUID
+		}
 		metrics = append(metrics, mapDeviceSensorToMetric(sensor))
 	}
 	return metrics
@@ -316,5 +647,6 @@ func mapDeviceSensorToMetric(sensor smartcitizen.DeviceSensor) alert.Metric {
 		Value:       sensor.Value,
 		Unit:        sensor.Unit,
 		Timestamp:   sensor.ToUnix(),
+		Source:      sensor.DeviceUUID,
 	}
 }
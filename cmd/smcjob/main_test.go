@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/timgluz/smcprober/alert"
+	"github.com/timgluz/smcprober/clock"
+	"github.com/timgluz/smcprober/metric"
+	"github.com/timgluz/smcprober/ntfy"
+)
+
+// unsetEnv clears the variables for the test, also the ones a loaded .env file sets later
+func unsetEnv(t *testing.T, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		t.Setenv(name, "")
+		if err := os.Unsetenv(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfigLayering(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		dotEnv string
+		env    map[string]string
+
+		wantTopic       string
+		wantConcurrency int
+	}{
+		{
+			name:            "defaults",
+			config:          `{}`,
+			wantTopic:       ntfy.DefaultNtfyTopic,
+			wantConcurrency: DefaultConcurrency,
+		},
+		{
+			name:            "config file overrides defaults",
+			config:          `{"concurrency": 2, "ntfy": {"topic": "file"}}`,
+			wantTopic:       "file",
+			wantConcurrency: 2,
+		},
+		{
+			name:            "dotenv overrides config file",
+			config:          `{"concurrency": 2, "ntfy": {"topic": "file"}}`,
+			dotEnv:          "NTFY_TOPIC=dotenv\nSMC_CONCURRENCY=8\n",
+			wantTopic:       "dotenv",
+			wantConcurrency: 8,
+		},
+		{
+			name:            "environment wins over dotenv",
+			config:          `{"concurrency": 2, "ntfy": {"topic": "file"}}`,
+			dotEnv:          "NTFY_TOPIC=dotenv\nSMC_CONCURRENCY=8\n",
+			env:             map[string]string{ntfy.EnvTopic: "env"},
+			wantTopic:       "env",
+			wantConcurrency: 8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetEnv(t, ntfy.EnvTopic, EnvConcurrency, EnvDotEnvPath)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			dir := t.TempDir()
+			configPath := writeFile(t, dir, "config.json", tt.config)
+
+			dotEnvPath := ""
+			if tt.dotEnv != "" {
+				dotEnvPath = writeFile(t, dir, ".env", tt.dotEnv)
+			}
+
+			appConfig, err := loadConfig(configPath, dotEnvPath, true)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if appConfig.Ntfy.Topic != tt.wantTopic {
+				t.Errorf("expected topic %q, got %q", tt.wantTopic, appConfig.Ntfy.Topic)
+			}
+
+			if appConfig.Concurrency != tt.wantConcurrency {
+				t.Errorf("expected concurrency %d, got %d", tt.wantConcurrency, appConfig.Concurrency)
+			}
+		})
+	}
+}
+
+func TestSendNotificationWithAttachment(t *testing.T) {
+	notifier := ntfy.NewRecordingNotifier()
+	action := SendNotificationWithAttachment(context.Background(), notifier, clock.Real(), "alerts", "Battery level is low",
+		"https://example.com/charts/battery.png", "battery.png")
+
+	rule := alert.AlertRule{ID: "battery_low", Name: "Battery Level Low"}
+	if err := action(alert.Metric{Name: "Battery SCK", Value: 12, Source: "0a1b2c3d"}, rule); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sent := notifier.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(sent))
+	}
+
+	notification := sent[0]
+	if notification.Topic != "alerts" || notification.Title != "Alert: Battery Level Low" || notification.Message != "Battery level is low" {
+		t.Errorf("unexpected notification %+v", notification)
+	}
+
+	if notification.Attach != "https://example.com/charts/battery.png" || notification.Filename != "battery.png" {
+		t.Errorf("expected the attachment to be set, got attach=%q filename=%q", notification.Attach, notification.Filename)
+	}
+}
+
+// setStdin replaces stdin with the content for the test
+func setStdin(t *testing.T, content string) {
+	t.Helper()
+
+	stdin := writeFile(t, t.TempDir(), "stdin", content)
+	file, err := os.Open(stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() {
+		os.Stdin = original
+		file.Close()
+	})
+}
+
+func TestDecodeConfig(t *testing.T) {
+	appConfig, err := decodeConfig(strings.NewReader(`{"concurrency": 2}`), "from stdin", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if appConfig.Concurrency != 2 {
+		t.Errorf("expected concurrency 2, got %d", appConfig.Concurrency)
+	}
+
+	_, err = decodeConfig(strings.NewReader(`{"concurency": 2}`), "from stdin", true)
+	if err == nil || !strings.Contains(err.Error(), "from stdin") {
+		t.Errorf("expected strict decoding to reject the unknown field and name the source, got %v", err)
+	}
+}
+
+func TestLoadConfigFromStdin(t *testing.T) {
+	unsetEnv(t, ntfy.EnvTopic, EnvConcurrency, EnvDotEnvPath)
+	setStdin(t, `{"ntfy": {"topic": "piped"}}`)
+
+	appConfig, err := loadConfig(StdinConfigPath, "", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if appConfig.Ntfy.Topic != "piped" {
+		t.Errorf("expected the topic from stdin, got %q", appConfig.Ntfy.Topic)
+	}
+
+	if appConfig.Concurrency != DefaultConcurrency {
+		t.Errorf("expected the default concurrency, got %d", appConfig.Concurrency)
+	}
+}
+
+func TestInitNotifierRegistersCounters(t *testing.T) {
+	appConfig := AppConfig{}
+	appConfig.ApplyDefaults()
+
+	logger := slog.New(slog.DiscardHandler)
+	registry := metric.NewNamespacedRegistryWithRegisterer("test", nil, logger)
+	if _, err := initNotifier(appConfig, ntfy.DefaultNotifierRegistry(), registry, clock.Real(), logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"ntfy_notifications_sent_total", "ntfy_notifications_failed_total"} {
+		if _, exists := registry.GetCollectorByName(name); !exists {
+			t.Errorf("expected %s to be registered", name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// jobState is what the job remembers between its runs, it exits after every evaluation
+type jobState struct {
+	// BatteryLow holds the metric series the battery_low rule fires for, see alert.HysteresisState
+	BatteryLow []string `json:"battery_low"`
+
+	// Notified holds the notifications sent within the dedupe window, see ntfy.DedupeNotifier.Sent
+	Notified map[string]time.Time `json:"notified,omitempty"`
+}
+
+// loadJobState reads the state of the previous run, a missing file is an empty state
+func loadJobState(path string) (jobState, error) {
+	var state jobState
+	content, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	if err := json.Unmarshal(content, &state); err != nil {
+		return state, fmt.Errorf("failed to decode state file %s: %w", path, err)
+	}
+
+	return state, nil
+}
+
+// saveJobState writes the state to a temporary file first and renames it,
+// so an interrupted job doesn't leave a truncated state behind
+func saveJobState(path string, state jobState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path = filepath.Clean(path)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
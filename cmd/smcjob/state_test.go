@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/timgluz/smcprober/alert"
+	"github.com/timgluz/smcprober/clock"
+	"github.com/timgluz/smcprober/metric"
+	"github.com/timgluz/smcprober/ntfy"
+)
+
+func TestJobStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := loadJobState(path)
+	if err != nil {
+		t.Fatalf("a missing state file must be an empty state, got %v", err)
+	}
+
+	state.BatteryLow = []string{"device-1/Battery SCK"}
+	if err := saveJobState(path, state); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := loadJobState(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !slices.Equal(loaded.BatteryLow, state.BatteryLow) {
+		t.Errorf("expected %v, got %v", state.BatteryLow, loaded.BatteryLow)
+	}
+}
+
+// runBatteryJob evaluates the battery level like a single run of the job and returns the matched rules
+func runBatteryJob(t *testing.T, state *jobState, value float64) []string {
+	t.Helper()
+
+	appConfig := AppConfig{}
+	appConfig.ApplyDefaults()
+
+	batteryLow := alert.NewHysteresisState(state.BatteryLow...)
+	engine, err := initAlertEngine(context.Background(), appConfig, ntfy.NewRecordingNotifier(),
+		clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)), batteryLow, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	matched := make([]string, 0)
+	for _, result := range engine.EvaluateWithResult(alert.Metric{Name: appConfig.BatterySensorName, Source: "device-1", Value: value}) {
+		if result.Matched {
+			matched = append(matched, result.RuleID)
+		}
+	}
+
+	state.BatteryLow = batteryLow.Firing()
+	return matched
+}
+
+func TestBatteryRulesKeepStateBetweenRuns(t *testing.T) {
+	state := &jobState{}
+
+	runs := []struct {
+		value float64
+		want  []string
+	}{
+		{value: 18, want: []string{"battery_ok"}},
+		{value: 14, want: []string{"battery_low"}},
+		{value: 17, want: []string{"battery_low"}},
+		{value: 21, want: []string{"battery_ok"}},
+		{value: 9, want: []string{"battery_critical_low"}},
+	}
+
+	for i, run := range runs {
+		if got := runBatteryJob(t, state, run.value); !slices.Equal(got, run.want) {
+			t.Errorf("run %d with %v%%: expected %v, got %v", i, run.value, run.want, got)
+		}
+	}
+}
+
+// runNotifyJob sends the battery_low notification like a single run of the job with the saved state
+func runNotifyJob(t *testing.T, path string, recorder *ntfy.RecordingNotifier, c clock.Clock) {
+	t.Helper()
+
+	appConfig := AppConfig{}
+	appConfig.ApplyDefaults()
+	appConfig.Ntfy.Type = "recording"
+	appConfig.Ntfy.DedupeWindowSeconds = 6 * 60 * 60
+
+	notifiers := ntfy.NewNotifierRegistry()
+	notifiers.Register("recording", func(config ntfy.Config, registry metric.Registry, logger *slog.Logger) (ntfy.Notifier, error) {
+		return recorder, nil
+	})
+
+	logger := slog.New(slog.DiscardHandler)
+	notifier, err := initNotifier(appConfig, notifiers, nil, c, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	state, err := loadJobState(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dedupe := notifier.(*ntfy.DedupeNotifier)
+	dedupe.Restore(state.Notified)
+
+	action := SendNotificationAction(context.Background(), notifier, c, appConfig.Ntfy.Topic, "Battery level is low")
+	if err := action(alert.Metric{Name: appConfig.BatterySensorName, Source: "device-1", Value: 12},
+		alert.AlertRule{ID: "battery_low", Name: "Battery Level Low"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	state.Notified = dedupe.Sent()
+	if err := saveJobState(path, state); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNotificationsAreNotRepeatedBetweenRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	recorder := ntfy.NewRecordingNotifier()
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 22, 0, 0, 0, time.UTC))
+
+	runNotifyJob(t, path, recorder, fakeClock)
+	fakeClock.Advance(time.Hour)
+	runNotifyJob(t, path, recorder, fakeClock)
+
+	if got := len(recorder.Sent()); got != 1 {
+		t.Fatalf("expected the second run to skip the duplicate, got %d notifications", got)
+	}
+
+	// the firing ID changes with the day of the clock, even within the dedupe window
+	fakeClock.Set(time.Date(2025, 1, 3, 0, 30, 0, 0, time.UTC))
+	runNotifyJob(t, path, recorder, fakeClock)
+
+	if got := len(recorder.Sent()); got != 2 {
+		t.Errorf("expected a new notification on the next day, got %d notifications", got)
+	}
+}
@@ -0,0 +1,109 @@
+// Package configfile loads the JSON configuration of the commands.
+//
+// Configuration is layered with the following precedence: defaults < config file < environment < flags,
+// the .env file is loaded before the environment, so it could set the overrides too.
+package configfile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/joho/godotenv"
+	"github.com/timgluz/smcprober/envconfig"
+)
+
+// StdinPath as the config path reads the configuration from stdin, e.g. generated by a template
+const StdinPath = "-"
+
+// EnvDotEnvPath overrides the .env file of the config file
+const EnvDotEnvPath = "SMC_DOTENV_PATH"
+
+// Config is implemented by the pointer to the configuration of a command
+type Config[T any] interface {
+	*T
+
+	// ApplyEnv overrides config values with the environment variables that are set
+	ApplyEnv() error
+	ApplyDefaults()
+
+	// DotEnvFile points to the path of the .env file in the config, the loader overrides it
+	DotEnvFile() *string
+}
+
+// Load layers the configuration as defaults < config file < environment, other flags are
+// applied on top of it by the caller. The .env file of the -dotenv flag or the config is loaded
+// before the environment; variables already set in the environment win over the .env file.
+// A missing config file is only an error if it isn't defaultPath. Strict rejects unknown keys in the config file
+func Load[T any, P Config[T]](path, defaultPath, dotEnvPath string, strict bool) (T, error) {
+	config, err := LoadFile[T](path, strict)
+	if errors.Is(err, os.ErrNotExist) && path == defaultPath {
+		// the default config file is optional, the environment may provide everything
+		err = nil
+	}
+
+	if err != nil {
+		return config, err
+	}
+
+	dotEnvFile := P(&config).DotEnvFile()
+	envconfig.String(EnvDotEnvPath, dotEnvFile)
+	if dotEnvPath != "" {
+		*dotEnvFile = dotEnvPath
+	}
+
+	if *dotEnvFile != "" {
+		fmt.Println("Loading .env file from:", *dotEnvFile)
+		if err := godotenv.Load(*dotEnvFile); err != nil {
+			return config, fmt.Errorf("failed to load .env file: %w", err)
+		}
+	}
+
+	if err := P(&config).ApplyEnv(); err != nil {
+		return config, err
+	}
+
+	P(&config).ApplyDefaults()
+
+	return config, nil
+}
+
+// LoadFile decodes the config file, or stdin for StdinPath
+func LoadFile[T any](path string, strict bool) (T, error) {
+	if path == StdinPath {
+		return Decode[T](os.Stdin, "from stdin", strict)
+	}
+
+	var config T
+	// Clean the path to prevent path traversal attacks
+	cleanPath := filepath.Clean(path)
+	file, err := os.Open(cleanPath)
+	if err != nil {
+		return config, err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close config file: %v\n", closeErr)
+		}
+	}()
+
+	return Decode[T](file, "file "+cleanPath, strict)
+}
+
+// Decode decodes the JSON configuration, source names the input in errors
+func Decode[T any](r io.Reader, source string, strict bool) (T, error) {
+	var config T
+	decoder := json.NewDecoder(r)
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("failed to decode config %s: %w", source, err)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,97 @@
+package configfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testEnvName = "TEST_CONFIGFILE_NAME"
+
+type testConfig struct {
+	Name       string `json:"name"`
+	Port       int    `json:"port"`
+	DotEnvPath string `json:"dotenv_path"`
+}
+
+func (c *testConfig) ApplyEnv() error {
+	if value, ok := os.LookupEnv(testEnvName); ok && value != "" {
+		c.Name = value
+	}
+
+	return nil
+}
+
+func (c *testConfig) ApplyDefaults() {
+	if c.Port == 0 {
+		c.Port = 8080
+	}
+}
+
+func (c *testConfig) DotEnvFile() *string {
+	return &c.DotEnvPath
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv(EnvDotEnvPath, "")
+	t.Setenv(testEnvName, "")
+	if err := os.Unsetenv(testEnvName); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	dotEnvPath := filepath.Join(dir, ".env")
+	writeFile(t, configPath, `{"name": "file", "dotenv_path": "`+filepath.Join(dir, "missing.env")+`"}`)
+	writeFile(t, dotEnvPath, testEnvName+"=dotenv\n")
+
+	// the flag wins over the .env file of the config
+	config, err := Load[testConfig](configPath, "", dotEnvPath, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if config.Name != "dotenv" || config.Port != 8080 || config.DotEnvPath != dotEnvPath {
+		t.Errorf("expected the .env value and the defaults, got %+v", config)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Setenv(EnvDotEnvPath, "")
+	missing := filepath.Join(t.TempDir(), "config.json")
+
+	// only the default config file is optional
+	config, err := Load[testConfig](missing, missing, "", true)
+	if err != nil {
+		t.Fatalf("expected the missing default config file to be skipped, got %v", err)
+	}
+
+	if config.Port != 8080 {
+		t.Errorf("expected the defaults, got %+v", config)
+	}
+
+	if _, err := Load[testConfig](missing, "configs/config.json", "", true); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	if _, err := Decode[testConfig](strings.NewReader(`{"nmae": "typo"}`), "from stdin", true); err == nil {
+		t.Error("expected strict decoding to reject the unknown key")
+	}
+
+	config, err := Decode[testConfig](strings.NewReader(`{"nmae": "typo", "port": 9090}`), "from stdin", false)
+	if err != nil || config.Port != 9090 {
+		t.Errorf("expected the unknown key to be ignored, got %+v: %v", config, err)
+	}
+}
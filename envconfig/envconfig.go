@@ -0,0 +1,33 @@
+// Package envconfig provides helpers to override configuration values from environment variables.
+//
+// Configuration is layered with the following precedence: defaults < config file < environment < flags.
+package envconfig
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// String overrides the target with the value of the environment variable, if it is set
+func String(name string, target *string) {
+	if value, ok := os.LookupEnv(name); ok && value != "" {
+		*target = value
+	}
+}
+
+// Int overrides the target with the integer value of the environment variable, if it is set
+func Int(name string, target *int) error {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid value for environment variable %s: %w", name, err)
+	}
+
+	*target = parsed
+	return nil
+}
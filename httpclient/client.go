@@ -1,21 +1,35 @@
 package httpclient
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"time"
 )
 
+const (
+	DefaultDialTimeout = 10 * time.Second
+	DefaultKeepAlive   = 30 * time.Second
+)
+
+// newDialContext creates the dial function of the transport. net.Dialer uses the
+// earlier of its Timeout and the request context deadline, so a caller passing a
+// shorter deadline fails fast instead of waiting for the full dial timeout.
+func newDialContext(timeout, keepAlive time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return (&net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: keepAlive,
+	}).DialContext
+}
+
 // NewHTTPClient creates an HTTP client with sensible timeout defaults
 func NewDefaultHTTPClient() *http.Client {
 	return &http.Client{
 		Timeout: 30 * time.Second, // Overall request timeout
 		Transport: &http.Transport{
 			// Connection settings
-			DialContext: (&net.Dialer{
-				Timeout:   10 * time.Second, // Time to establish connection
-				KeepAlive: 30 * time.Second, // Keep-alive probe interval
-			}).DialContext,
+			// Time to establish connection and keep-alive probe interval
+			DialContext: newDialContext(DefaultDialTimeout, DefaultKeepAlive),
 
 			// TLS handshake timeout
 			TLSHandshakeTimeout: 10 * time.Second,
@@ -32,6 +46,10 @@ func NewDefaultHTTPClient() *http.Client {
 
 			// Avoid connection reuse issues
 			DisableKeepAlives: false,
+
+			// The transport requests gzip and decompresses the response transparently,
+			// as long as requests don't set Accept-Encoding themselves
+			DisableCompression: false,
 		},
 	}
 }
@@ -46,14 +64,11 @@ func WithTimeout(timeout time.Duration) ClientOption {
 	}
 }
 
-// WithDialTimeout sets the connection dial timeout
+// WithDialTimeout sets the connection dial timeout, keeping the default keep-alive interval
 func WithDialTimeout(timeout time.Duration) ClientOption {
 	return func(c *http.Client) {
 		if transport, ok := c.Transport.(*http.Transport); ok {
-			transport.DialContext = (&net.Dialer{
-				Timeout:   timeout,
-				KeepAlive: 30 * time.Second,
-			}).DialContext
+			transport.DialContext = newDialContext(timeout, DefaultKeepAlive)
 		}
 	}
 }
@@ -94,14 +109,22 @@ func WithMaxIdleConnsPerHost(n int) ClientOption {
 	}
 }
 
-// WithKeepAlive sets the keep-alive probe interval
+// WithKeepAlive sets the keep-alive probe interval, keeping the default dial timeout
 func WithKeepAlive(interval time.Duration) ClientOption {
 	return func(c *http.Client) {
 		if transport, ok := c.Transport.(*http.Transport); ok {
-			transport.DialContext = (&net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: interval,
-			}).DialContext
+			transport.DialContext = newDialContext(DefaultDialTimeout, interval)
+		}
+	}
+}
+
+// WithDialer sets both the dial timeout and the keep-alive probe interval.
+// WithDialTimeout and WithKeepAlive each reset the other setting to its default,
+// so use this option when both need to be customized.
+func WithDialer(timeout, keepAlive time.Duration) ClientOption {
+	return func(c *http.Client) {
+		if transport, ok := c.Transport.(*http.Transport); ok {
+			transport.DialContext = newDialContext(timeout, keepAlive)
 		}
 	}
 }
@@ -0,0 +1,54 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDialHonorsContextDeadline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	tests := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{name: "default"},
+		{name: "WithDialTimeout", opts: []ClientOption{WithDialTimeout(time.Minute)}},
+		{name: "WithKeepAlive", opts: []ClientOption{WithKeepAlive(time.Minute)}},
+		{name: "WithDialer", opts: []ClientOption{WithDialer(time.Minute, time.Minute)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := NewHTTPClientWithOptions(tt.opts...).Transport.(*http.Transport)
+
+			// the listener accepts connections, only the deadline can make the dial fail
+			ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Millisecond))
+			defer cancel()
+
+			start := time.Now()
+			conn, err := transport.DialContext(ctx, "tcp", listener.Addr().String())
+			if err == nil {
+				conn.Close()
+				t.Fatal("expected the dial to fail at the context deadline")
+			}
+
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				t.Errorf("expected a timeout error, got %v", err)
+			}
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected the dial to fail fast, took %v", elapsed)
+			}
+		})
+	}
+}
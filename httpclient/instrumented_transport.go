@@ -1,16 +1,30 @@
 package httpclient
 
 import (
+	"log/slog"
 	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// EndpointExtractor maps a request path to the endpoint label of the duration histogram
+type EndpointExtractor func(path string) string
+
 // InstrumentedTransport wraps http.RoundTripper to measure request duration
 type InstrumentedTransport struct {
 	base      http.RoundTripper
 	histogram *prometheus.HistogramVec
+	logger    *slog.Logger
+
+	// EndpointExtractor controls the endpoint label, defaults to DefaultEndpointExtractor
+	EndpointExtractor EndpointExtractor
+
+	// connReused counts connections by whether they were reused, nil disables tracing
+	connReused *prometheus.CounterVec
 }
 
 // NewInstrumentedTransport creates a transport that records metrics
@@ -23,16 +37,42 @@ func NewInstrumentedTransport(base http.RoundTripper, histogram *prometheus.Hist
 	}
 
 	return &InstrumentedTransport{
-		base:      base,
-		histogram: histogram,
+		base:              base,
+		histogram:         histogram,
+		EndpointExtractor: DefaultEndpointExtractor,
 	}
 }
 
+// SetConnectionReuseCounter traces whether each request reused a pooled connection,
+// the counter must have a single "reused" label. Tracing adds overhead to every request,
+// so it is off by default.
+func (t *InstrumentedTransport) SetConnectionReuseCounter(counter *prometheus.CounterVec) {
+	t.connReused = counter
+}
+
+// SetLogger enables debug-level request tracing; bodies are never logged
+func (t *InstrumentedTransport) SetLogger(logger *slog.Logger) {
+	t.logger = logger
+}
+
 func (t *InstrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	start := time.Now()
 
-	// Use full URL path as endpoint (preserves API version info)
-	endpoint := req.URL.Path
+	// Propagate the correlation ID without modifying the caller's request
+	if requestID, ok := RequestIDFromContext(req.Context()); ok && req.Header.Get(RequestIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+
+	if t.connReused != nil {
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				t.connReused.WithLabelValues(strconv.FormatBool(info.Reused)).Inc()
+			},
+		}))
+	}
+
+	endpoint := t.extractEndpoint(req.URL.Path)
 	method := req.Method
 
 	// Execute request
@@ -42,17 +82,96 @@ func (t *InstrumentedTransport) RoundTrip(req *http.Request) (*http.Response, er
 	// Determine status
 	status := "error"
 	if err == nil {
-		status = statusCategory(resp.StatusCode)
+		status = StatusCategory(resp.StatusCode)
 	}
 
 	// Record metric
 	t.histogram.WithLabelValues(endpoint, status, method).Observe(duration)
 
+	t.logRoundTrip(req, resp, err, duration)
+
 	return resp, err
 }
 
-// statusCategory converts HTTP status code to human-friendly category
-func statusCategory(code int) string {
+func (t *InstrumentedTransport) extractEndpoint(path string) string {
+	if t.EndpointExtractor == nil {
+		return DefaultEndpointExtractor(path)
+	}
+
+	return t.EndpointExtractor(path)
+}
+
+func (t *InstrumentedTransport) logRoundTrip(req *http.Request, resp *http.Response, err error, duration float64) {
+	if t.logger == nil || !t.logger.Enabled(req.Context(), slog.LevelDebug) {
+		return
+	}
+
+	attrs := []any{
+		"method", req.Method,
+		"url", req.URL.Redacted(),
+		"headers", redactHeaders(req.Header),
+		"duration", duration,
+	}
+
+	if err != nil {
+		t.logger.Debug("HTTP request failed", append(attrs, "error", err)...)
+		return
+	}
+
+	t.logger.Debug("HTTP request completed", append(attrs, "status", resp.StatusCode)...)
+}
+
+// redactHeaders returns a copy of the headers with credentials masked
+func redactHeaders(headers http.Header) http.Header {
+	redacted := headers.Clone()
+	for _, name := range []string{"Authorization", "Cookie"} {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "REDACTED")
+		}
+	}
+
+	return redacted
+}
+
+// DefaultEndpointExtractor uses the full URL path as endpoint, which preserves the API version
+func DefaultEndpointExtractor(path string) string {
+	return path
+}
+
+// CollapseIDsEndpointExtractor replaces numeric segments such as device IDs with ":id"
+// to bound the label cardinality, e.g. /v0/devices/1234 becomes /v0/devices/:id
+func CollapseIDsEndpointExtractor(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if isNumeric(segment) {
+			segments[i] = ":id"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// isNumeric reports whether the path segment consists only of digits
+func isNumeric(segment string) bool {
+	if segment == "" {
+		return false
+	}
+
+	for _, r := range segment {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// StatusCategory converts HTTP status code to human-friendly category
+func StatusCategory(code int) string {
 	if code >= 200 && code < 300 {
 		return "success"
 	} else if code >= 400 && code < 500 {
@@ -0,0 +1,131 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStatusCategory(t *testing.T) {
+	tests := []struct {
+		code int
+		want string
+	}{
+		{code: 100, want: "unknown"},
+		{code: 200, want: "success"},
+		{code: 204, want: "success"},
+		{code: 299, want: "success"},
+		{code: 304, want: "unknown"},
+		{code: 400, want: "client_error"},
+		{code: 429, want: "client_error"},
+		{code: 499, want: "client_error"},
+		{code: 500, want: "server_error"},
+		{code: 503, want: "server_error"},
+	}
+
+	for _, tt := range tests {
+		if got := StatusCategory(tt.code); got != tt.want {
+			t.Errorf("StatusCategory(%d): expected %q, got %q", tt.code, tt.want, got)
+		}
+	}
+}
+
+func TestDefaultEndpointExtractor(t *testing.T) {
+	for _, path := range []string{"", "/", "/v0/me", "/v0/devices/1234", "/v0/devices/1234/readings"} {
+		if got := DefaultEndpointExtractor(path); got != path {
+			t.Errorf("expected the raw path %q, got %q", path, got)
+		}
+	}
+}
+
+func TestCollapseIDsEndpointExtractor(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "", want: "/"},
+		{path: "/", want: "/"},
+		{path: "/v0/me", want: "/v0/me"},
+		{path: "/v0/devices/1234", want: "/v0/devices/:id"},
+		{path: "/v0/devices/1234/", want: "/v0/devices/:id/"},
+		{path: "/v0/devices/1234/readings", want: "/v0/devices/:id/readings"},
+		{path: "/v0/devices/12/sensors/55", want: "/v0/devices/:id/sensors/:id"},
+		{path: "/v0/devices/12a", want: "/v0/devices/12a"},
+		{path: "/v0/devices/-1", want: "/v0/devices/-1"},
+		{path: "//v0", want: "//v0"},
+	}
+
+	for _, tt := range tests {
+		if got := CollapseIDsEndpointExtractor(tt.path); got != tt.want {
+			t.Errorf("CollapseIDsEndpointExtractor(%q): expected %q, got %q", tt.path, tt.want, got)
+		}
+	}
+}
+
+func newTestHistogram() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "test_request_duration_seconds",
+		Help: "Request duration",
+	}, []string{"endpoint", "status", "method"})
+}
+
+func TestInstrumentedTransportEndpointLabel(t *testing.T) {
+	tests := []struct {
+		name      string
+		override  bool
+		extractor EndpointExtractor
+		want      string
+	}{
+		{name: "default", want: "/v0/devices/1234"},
+		{name: "nil extractor", override: true, want: "/v0/devices/1234"},
+		{name: "collapse IDs", override: true, extractor: CollapseIDsEndpointExtractor, want: "/v0/devices/:id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			histogram := newTestHistogram()
+			transport := NewInstrumentedTransport(&stubRoundTripper{replies: []stubReply{{status: http.StatusOK}}}, histogram)
+			if tt.override {
+				transport.EndpointExtractor = tt.extractor
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/v0/devices/1234", nil)
+			if _, err := transport.RoundTrip(req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := testutil.CollectAndCount(histogram); got != 1 {
+				t.Fatalf("expected 1 series, got %d", got)
+			}
+
+			if _, err := histogram.GetMetricWithLabelValues(tt.want, "success", http.MethodGet); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := testutil.CollectAndCount(histogram); got != 1 {
+				t.Errorf("expected the endpoint label %q, got another series", tt.want)
+			}
+		})
+	}
+}
+
+func TestInstrumentedTransportErrorStatus(t *testing.T) {
+	histogram := newTestHistogram()
+	transport := NewInstrumentedTransport(&stubRoundTripper{replies: []stubReply{{err: errors.New("connection refused")}}}, histogram)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/v0/me", nil)
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("expected the transport error")
+	}
+
+	if _, err := histogram.GetMetricWithLabelValues("/v0/me", "error", http.MethodGet); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.CollectAndCount(histogram); got != 1 {
+		t.Error("expected the failed request to be recorded with status error")
+	}
+}
@@ -0,0 +1,64 @@
+package httpclient
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimitTransport wraps http.RoundTripper and paces outgoing requests with a token bucket,
+// so fetching many devices doesn't burst the API with simultaneous requests
+type RateLimitTransport struct {
+	base http.RoundTripper
+
+	// interval is the time to refill a single token, tolerance allows bursts of requests
+	interval  time.Duration
+	tolerance time.Duration
+
+	mu sync.Mutex
+	// next is the theoretical arrival time of the next request at the configured rate
+	next time.Time
+}
+
+// NewRateLimitTransport allows requestsPerSecond on average with bursts of up to burst requests
+func NewRateLimitTransport(base http.RoundTripper, requestsPerSecond float64, burst int) *RateLimitTransport {
+	if base == nil {
+		panic("httpclient: base RoundTripper cannot be nil")
+	}
+
+	if requestsPerSecond <= 0 {
+		panic("httpclient: requests per second must be positive")
+	}
+
+	burst = max(burst, 1)
+	interval := time.Duration(float64(time.Second) / requestsPerSecond)
+
+	return &RateLimitTransport{
+		base:      base,
+		interval:  interval,
+		tolerance: interval * time.Duration(burst-1),
+	}
+}
+
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := sleepWithContext(req.Context(), t.reserve(time.Now())); err != nil {
+		return nil, err
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// reserve takes a token and returns how long the caller has to wait before using it.
+// A request cancelled while waiting keeps its token, which only slows down later requests.
+func (t *RateLimitTransport) reserve(now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	arrival := t.next
+	if arrival.Before(now) {
+		arrival = now
+	}
+	t.next = arrival.Add(t.interval)
+
+	return max(arrival.Add(-t.tolerance).Sub(now), 0)
+}
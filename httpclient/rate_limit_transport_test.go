@@ -0,0 +1,80 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimitTransportPacing(t *testing.T) {
+	transport := NewRateLimitTransport(&stubRoundTripper{}, 10, 2)
+	now := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	// the burst goes through, further requests are paced at 100ms
+	want := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	for i, delay := range want {
+		if got := transport.reserve(now); got != delay {
+			t.Errorf("request %d: expected to wait %v, got %v", i, delay, got)
+		}
+	}
+
+	// after an idle period the bucket is full again
+	later := now.Add(time.Second)
+	for i := range 2 {
+		if got := transport.reserve(later); got != 0 {
+			t.Errorf("request %d after idling: expected no wait, got %v", i, got)
+		}
+	}
+
+	if got := transport.reserve(later); got != 100*time.Millisecond {
+		t.Errorf("expected the burst to be used up, got %v", got)
+	}
+}
+
+func TestRateLimitTransportPacesRoundTrips(t *testing.T) {
+	stub := &stubRoundTripper{replies: []stubReply{{status: http.StatusOK}}}
+	transport := NewRateLimitTransport(stub, 20, 1)
+
+	start := time.Now()
+	for range 3 {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/v0/me", nil)
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// the first request goes through at once, the next two wait 50ms each
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected the requests to be paced over at least 100ms, took %v", elapsed)
+	}
+}
+
+func TestRateLimitTransportRespectsCancellation(t *testing.T) {
+	stub := &stubRoundTripper{replies: []stubReply{{status: http.StatusOK}}}
+	transport := NewRateLimitTransport(stub, 0.1, 1)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/v0/me", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the next token is only available in 10s
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := transport.RoundTrip(req.WithContext(ctx))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to be cancelled, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the cancelled request to return at the deadline, took %v", elapsed)
+	}
+
+	if len(stub.bodies) != 1 {
+		t.Errorf("expected the cancelled request not to reach the base transport, got %d requests", len(stub.bodies))
+	}
+}
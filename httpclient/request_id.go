@@ -0,0 +1,31 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// RequestIDHeader carries the correlation ID of outgoing requests
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// NewRequestID generates a random correlation ID
+func NewRequestID() string {
+	buf := make([]byte, 16)
+	// crypto/rand.Read never returns an error
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// WithRequestID returns a context carrying the correlation ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the correlation ID of the context, if any
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey{}).(string)
+	return requestID, ok && requestID != ""
+}
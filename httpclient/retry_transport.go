@@ -0,0 +1,220 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	DefaultRetryBackoff    = 500 * time.Millisecond
+	DefaultMaxRetryBackoff = 30 * time.Second
+)
+
+// RetryPolicy decides whether a request should be retried based on the outcome of the previous attempt
+type RetryPolicy func(resp *http.Response, err error) bool
+
+// DefaultRetryPolicy retries network errors, rate limits and transient server errors
+func DefaultRetryPolicy(resp *http.Response, err error) bool {
+	if err != nil {
+		// don't retry requests the caller gave up on
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// RetryTransport wraps http.RoundTripper and replays failed requests with exponential backoff,
+// rate limited requests are retried after the delay requested by the server
+type RetryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	policy     RetryPolicy
+
+	rateLimited prometheus.Counter
+}
+
+// NewRetryTransport creates a transport that retries up to maxRetries times
+func NewRetryTransport(base http.RoundTripper, maxRetries int, backoff time.Duration) *RetryTransport {
+	if base == nil {
+		panic("httpclient: base RoundTripper cannot be nil")
+	}
+
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	return &RetryTransport{
+		base:       base,
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		maxBackoff: DefaultMaxRetryBackoff,
+		policy:     DefaultRetryPolicy,
+	}
+}
+
+// SetRetryPolicy overrides the predicate used to decide whether to retry
+func (t *RetryTransport) SetRetryPolicy(policy RetryPolicy) {
+	if policy != nil {
+		t.policy = policy
+	}
+}
+
+// SetRateLimitedCounter counts the responses rejected with 429 Too Many Requests
+func (t *RetryTransport) SetRateLimitedCounter(counter prometheus.Counter) {
+	t.rateLimited = counter
+}
+
+// SetMaxBackoff caps the delay between two attempts, including Retry-After delays
+func (t *RetryTransport) SetMaxBackoff(maxBackoff time.Duration) {
+	if maxBackoff > 0 {
+		t.maxBackoff = maxBackoff
+	}
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := bufferRequestBody(req); err != nil {
+		return nil, err
+	}
+
+	attemptReq := req
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests && t.rateLimited != nil {
+			t.rateLimited.Inc()
+		}
+
+		if attempt >= t.maxRetries || !t.policy(resp, err) {
+			return resp, err
+		}
+
+		delay := t.backoffFor(attempt)
+		if retryAfter, ok := retryAfterDelay(resp, time.Now()); ok {
+			delay = min(retryAfter, t.maxBackoff)
+		}
+
+		// release the connection of the discarded attempt
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		if err := sleepWithContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+
+		attemptReq, err = rewindRequest(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoffFor returns the exponential delay before the given retry attempt
+func (t *RetryTransport) backoffFor(attempt int) time.Duration {
+	delay := t.backoff
+	for i := 0; i < attempt; i++ {
+		delay *= 2
+		if delay >= t.maxBackoff {
+			return t.maxBackoff
+		}
+	}
+
+	return min(delay, t.maxBackoff)
+}
+
+// retryAfterDelay parses the Retry-After header of rate limited or unavailable responses,
+// it accepts both delay seconds and an HTTP date
+func retryAfterDelay(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+
+	return 0, false
+}
+
+// bufferRequestBody makes sure the request body could be replayed on retries
+func bufferRequestBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+
+	content, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	_ = req.Body.Close()
+
+	req.Body = io.NopCloser(bytes.NewReader(content))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+
+	return nil
+}
+
+// rewindRequest clones the original request with a fresh copy of its body
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.GetBody == nil {
+		return clone, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone.Body = body
+
+	return clone, nil
+}
+
+func sleepWithContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
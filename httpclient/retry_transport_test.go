@@ -0,0 +1,230 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubRoundTripper replies with the queued responses and errors in order, recording the request bodies
+type stubRoundTripper struct {
+	replies []stubReply
+	bodies  []string
+}
+
+type stubReply struct {
+	status int
+	header http.Header
+	err    error
+}
+
+func (s *stubRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		content, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = string(content)
+	}
+	s.bodies = append(s.bodies, body)
+
+	reply := s.replies[0]
+	if len(s.replies) > 1 {
+		s.replies = s.replies[1:]
+	}
+
+	if reply.err != nil {
+		return nil, reply.err
+	}
+
+	header := reply.header
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		StatusCode: reply.status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestRetryTransportRetriesTransientFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		replies    []stubReply
+		wantStatus int
+		wantErr    bool
+		wantCalls  int
+	}{
+		{
+			name:       "success needs no retry",
+			maxRetries: 3,
+			replies:    []stubReply{{status: http.StatusOK}},
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			name:       "server error is retried",
+			maxRetries: 3,
+			replies:    []stubReply{{status: http.StatusBadGateway}, {status: http.StatusServiceUnavailable}, {status: http.StatusOK}},
+			wantStatus: http.StatusOK,
+			wantCalls:  3,
+		},
+		{
+			name:       "network error is retried",
+			maxRetries: 3,
+			replies:    []stubReply{{err: errors.New("connection reset")}, {status: http.StatusOK}},
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:       "client error is not retried",
+			maxRetries: 3,
+			replies:    []stubReply{{status: http.StatusNotFound}},
+			wantStatus: http.StatusNotFound,
+			wantCalls:  1,
+		},
+		{
+			name:       "last failure is returned after max retries",
+			maxRetries: 2,
+			replies:    []stubReply{{status: http.StatusBadGateway}},
+			wantStatus: http.StatusBadGateway,
+			wantCalls:  3,
+		},
+		{
+			name:       "zero retries makes a single attempt",
+			maxRetries: 0,
+			replies:    []stubReply{{err: errors.New("connection reset")}},
+			wantErr:    true,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubRoundTripper{replies: tt.replies}
+			transport := NewRetryTransport(stub, tt.maxRetries, time.Millisecond)
+
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/v0/me", nil)
+			resp, err := transport.RoundTrip(req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+				}
+			}
+
+			if len(stub.bodies) != tt.wantCalls {
+				t.Errorf("expected %d attempts, got %d", tt.wantCalls, len(stub.bodies))
+			}
+		})
+	}
+}
+
+func TestRetryTransportReplaysRequestBody(t *testing.T) {
+	stub := &stubRoundTripper{replies: []stubReply{{status: http.StatusBadGateway}, {status: http.StatusOK}}}
+	transport := NewRetryTransport(stub, 1, time.Millisecond)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/v0/sessions", strings.NewReader("username=me"))
+	// hide the body type, so the request can't be rewound without buffering
+	req.Body = io.NopCloser(req.Body)
+	req.GetBody = nil
+
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(stub.bodies) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(stub.bodies))
+	}
+
+	for i, body := range stub.bodies {
+		if body != "username=me" {
+			t.Errorf("attempt %d: expected the full body, got %q", i, body)
+		}
+	}
+}
+
+func TestRetryTransportCustomPolicy(t *testing.T) {
+	stub := &stubRoundTripper{replies: []stubReply{{status: http.StatusNotFound}, {status: http.StatusOK}}}
+	transport := NewRetryTransport(stub, 1, time.Millisecond)
+	transport.SetRetryPolicy(func(resp *http.Response, err error) bool {
+		return err == nil && resp.StatusCode == http.StatusNotFound
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/v0/devices/1", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 after retry, got %d", resp.StatusCode)
+	}
+}
+
+func TestRetryTransportStopsWhenContextIsCancelled(t *testing.T) {
+	stub := &stubRoundTripper{replies: []stubReply{{status: http.StatusServiceUnavailable}}}
+	transport := NewRetryTransport(stub, 5, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/v0/me", nil)
+	_, err := transport.RoundTrip(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	if len(stub.bodies) != 1 {
+		t.Errorf("expected a single attempt, got %d", len(stub.bodies))
+	}
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		want       time.Duration
+		wantOK     bool
+	}{
+		{name: "seconds", status: http.StatusTooManyRequests, retryAfter: "7", want: 7 * time.Second, wantOK: true},
+		{name: "http date", status: http.StatusServiceUnavailable, retryAfter: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute, wantOK: true},
+		{name: "date in the past", status: http.StatusTooManyRequests, retryAfter: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, wantOK: true},
+		{name: "missing header", status: http.StatusTooManyRequests},
+		{name: "invalid header", status: http.StatusTooManyRequests, retryAfter: "soon"},
+		{name: "ignored for other statuses", status: http.StatusBadGateway, retryAfter: "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+
+			got, ok := retryAfterDelay(resp, now)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("expected (%v, %v), got (%v, %v)", tt.want, tt.wantOK, got, ok)
+			}
+		})
+	}
+}
@@ -1,10 +1,18 @@
 package metric
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
+	"runtime/debug"
+	"slices"
 	"sync"
 )
 
+var (
+	ErrConverterPanic = fmt.Errorf("converter panicked")
+)
+
 // Converter defines the contract for types that can register metrics in a Registry
 // from arbitrary data values. Implementations typically inspect the type or name
 // of the provided data and, when applicable, populate the given Registry with
@@ -20,6 +28,59 @@ type Converter interface {
 	// corresponding type or name. Implementations must return a non-nil error
 	// if the conversion or registration fails; otherwise they should return nil.
 	Convert(Registry, any) error
+
+	// Name identifies the converter in errors and metrics, e.g. "sensor";
+	// an empty name defaults to the Go type name of the converter.
+	Name() string
+}
+
+// ConverterError attributes a conversion failure to the converter that returned it
+type ConverterError struct {
+	Converter string
+	Err       error
+}
+
+func (e *ConverterError) Error() string {
+	return fmt.Sprintf("converter %s: %v", e.Converter, e.Err)
+}
+
+func (e *ConverterError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is returned for a converter that panicked, it matches ErrConverterPanic
+type PanicError struct {
+	Value any
+	// Stack is the stack trace of the panic
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrConverterPanic, e.Value)
+}
+
+func (e *PanicError) Is(target error) bool {
+	return target == ErrConverterPanic
+}
+
+// ConverterName returns the name of the converter, defaulting to its type name
+func ConverterName(converter Converter) string {
+	if name := converter.Name(); name != "" {
+		return name
+	}
+
+	t := reflect.TypeOf(converter)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t.Name()
+}
+
+// TypeNamer is implemented by data types that report their own type name,
+// which lets converters skip reflection on the hot path
+type TypeNamer interface {
+	TypeName() string
 }
 
 type CombinedConverter struct {
@@ -39,6 +100,34 @@ func (c *CombinedConverter) Add(converters ...Converter) {
 	c.converters = append(c.converters, converters...)
 }
 
+// Remove unregisters the converter by identity, so converters should be pointer types.
+// It reports whether the converter was registered.
+func (c *CombinedConverter) Remove(converter Converter) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, registered := range c.converters {
+		if registered == converter {
+			c.converters = slices.Delete(c.converters, i, i+1)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Converters returns a copy of the registered converters
+func (c *CombinedConverter) Converters() []Converter {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return slices.Clone(c.converters)
+}
+
+func (c *CombinedConverter) Name() string {
+	return "combined"
+}
+
 func (c *CombinedConverter) Match(name string) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -51,22 +140,59 @@ func (c *CombinedConverter) Match(name string) bool {
 	return false
 }
 
+// Convert stops at the first converter returning an error; a converter that panics, e.g. on
+// unexpected data, is reported as a PanicError and the remaining converters still run
 func (c *CombinedConverter) Convert(registry Registry, data any) error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
+	var panics []error
+	typeName := getTypeName(data)
 	for _, converter := range c.converters {
-		if !converter.Match(getTypeName(data)) {
+		if !converter.Match(typeName) {
+			continue
+		}
+
+		err := convertRecovering(converter, registry, data)
+		if err == nil {
 			continue
 		}
 
-		if err := converter.Convert(registry, data); err != nil {
+		// keep the innermost converter of nested combined converters
+		var converterErr *ConverterError
+		if !errors.As(err, &converterErr) {
+			err = &ConverterError{Converter: ConverterName(converter), Err: err}
+		}
+
+		if errors.Is(err, ErrConverterPanic) {
+			panics = append(panics, err)
+			continue
+		}
+
+		if len(panics) == 0 {
 			return err
 		}
+
+		return errors.Join(append(panics, err)...)
 	}
-	return nil
+
+	return errors.Join(panics...)
+}
+
+func convertRecovering(converter Converter, registry Registry, data any) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	return converter.Convert(registry, data)
 }
 
 func getTypeName(data any) string {
+	if namer, ok := data.(TypeNamer); ok {
+		return namer.TypeName()
+	}
+
 	return reflect.TypeOf(data).Name()
 }
@@ -0,0 +1,223 @@
+package metric
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeConverter matches a single type name and counts its conversions
+type fakeConverter struct {
+	name     string
+	typeName string
+	err      error
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *fakeConverter) Name() string {
+	return c.name
+}
+
+func (c *fakeConverter) Match(name string) bool {
+	return name == c.typeName
+}
+
+func (c *fakeConverter) Convert(registry Registry, data any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	return c.err
+}
+
+type namedData struct{}
+
+func (namedData) TypeName() string {
+	return "named"
+}
+
+type plainData struct{}
+
+func TestCombinedConverterAddRemove(t *testing.T) {
+	first := &fakeConverter{name: "first", typeName: "named"}
+	second := &fakeConverter{name: "second", typeName: "named"}
+
+	combined := NewCombinedConverter(first)
+	combined.Add(second)
+
+	if got := len(combined.Converters()); got != 2 {
+		t.Fatalf("expected 2 converters, got %d", got)
+	}
+
+	if !combined.Remove(first) {
+		t.Fatal("expected the registered converter to be removed")
+	}
+
+	if combined.Remove(first) {
+		t.Error("expected removing an unregistered converter to report false")
+	}
+
+	converters := combined.Converters()
+	if len(converters) != 1 || converters[0] != second {
+		t.Fatalf("expected only the second converter, got %v", converters)
+	}
+
+	if err := combined.Convert(nil, namedData{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first.calls != 0 || second.calls != 1 {
+		t.Errorf("expected only the second converter to run, got first=%d second=%d", first.calls, second.calls)
+	}
+}
+
+func TestCombinedConverterConvertersReturnsCopy(t *testing.T) {
+	converter := &fakeConverter{name: "first", typeName: "named"}
+	combined := NewCombinedConverter(converter)
+
+	converters := combined.Converters()
+	converters[0] = &fakeConverter{name: "replaced"}
+
+	if combined.Converters()[0] != converter {
+		t.Error("modifying the returned slice must not change the registered converters")
+	}
+}
+
+func TestCombinedConverterConcurrentAddRemove(t *testing.T) {
+	combined := NewCombinedConverter()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(3)
+		converter := &fakeConverter{name: "concurrent", typeName: "named"}
+
+		go func() {
+			defer wg.Done()
+			combined.Add(converter)
+		}()
+
+		go func() {
+			defer wg.Done()
+			// the converter may not be added yet, then it stays registered
+			combined.Remove(converter)
+		}()
+
+		go func() {
+			defer wg.Done()
+			_ = combined.Convert(nil, namedData{})
+			_ = combined.Converters()
+		}()
+	}
+	wg.Wait()
+
+	for _, converter := range combined.Converters() {
+		if !combined.Remove(converter) {
+			t.Fatal("expected every listed converter to be removable")
+		}
+	}
+
+	if got := len(combined.Converters()); got != 0 {
+		t.Errorf("expected no converters left, got %d", got)
+	}
+}
+
+func TestCombinedConverterAttributesErrors(t *testing.T) {
+	failure := errors.New("broken data")
+	inner := NewCombinedConverter(&fakeConverter{name: "sensor", typeName: "named", err: failure})
+	outer := NewCombinedConverter(inner)
+
+	err := outer.Convert(nil, namedData{})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected the converter error to wrap the failure, got %v", err)
+	}
+
+	var converterErr *ConverterError
+	if !errors.As(err, &converterErr) || converterErr.Converter != "sensor" {
+		t.Errorf("expected the innermost converter to be named, got %v", err)
+	}
+}
+
+func TestGetTypeName(t *testing.T) {
+	if got := getTypeName(namedData{}); got != "named" {
+		t.Errorf("expected the TypeName of the data, got %q", got)
+	}
+
+	if got := getTypeName(plainData{}); got != "plainData" {
+		t.Errorf("expected the reflected type name, got %q", got)
+	}
+}
+
+// BenchmarkGetTypeName compares data reporting its TypeName with the reflection fallback
+func BenchmarkGetTypeName(b *testing.B) {
+	b.Run("TypeName", func(b *testing.B) {
+		var data any = namedData{}
+		b.ReportAllocs()
+		for b.Loop() {
+			_ = getTypeName(data)
+		}
+	})
+
+	b.Run("reflection", func(b *testing.B) {
+		var data any = plainData{}
+		b.ReportAllocs()
+		for b.Loop() {
+			_ = reflect.TypeOf(data).Name()
+		}
+	})
+}
+
+// panicConverter panics on every conversion
+type panicConverter struct{}
+
+func (panicConverter) Name() string { return "" }
+
+func (panicConverter) Match(name string) bool { return name == "named" }
+
+func (panicConverter) Convert(registry Registry, data any) error { panic("unexpected data") }
+
+func TestCombinedConverterRecoversPanics(t *testing.T) {
+	later := &fakeConverter{name: "later", typeName: "named"}
+	combined := NewCombinedConverter(panicConverter{}, NewCombinedConverter(panicConverter{}), later)
+
+	err := combined.Convert(nil, namedData{})
+	if !errors.Is(err, ErrConverterPanic) {
+		t.Fatalf("expected ErrConverterPanic, got %v", err)
+	}
+
+	if later.calls != 1 {
+		t.Errorf("expected the converter after the panics to run, got %d calls", later.calls)
+	}
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "unexpected data" || len(panicErr.Stack) == 0 {
+		t.Errorf("expected the panic value and stack, got %v", err)
+	}
+
+	var converterErr *ConverterError
+	if !errors.As(err, &converterErr) || converterErr.Converter != "panicConverter" {
+		t.Errorf("expected the panic to be attributed to panicConverter, got %v", err)
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 2 {
+		t.Errorf("expected both panics to be reported, got %v", err)
+	}
+}
+
+func TestCombinedConverterStopsAtError(t *testing.T) {
+	failure := errors.New("broken data")
+	later := &fakeConverter{name: "later", typeName: "named"}
+	combined := NewCombinedConverter(panicConverter{}, &fakeConverter{name: "failing", typeName: "named", err: failure}, later)
+
+	err := combined.Convert(nil, namedData{})
+	if !errors.Is(err, failure) || !errors.Is(err, ErrConverterPanic) {
+		t.Fatalf("expected the panic and the error, got %v", err)
+	}
+
+	if later.calls != 0 {
+		t.Errorf("expected an error to stop the conversion, got %d calls", later.calls)
+	}
+}
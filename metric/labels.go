@@ -0,0 +1,23 @@
+package metric
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ErrLabelMismatch = fmt.Errorf("labels don't match the declared label names")
+)
+
+// SetGauge sets the gauge of the labels; unlike GaugeVec.With, which panics, labels that
+// don't match the label names the vector was declared with are returned as ErrLabelMismatch
+func SetGauge(vec *prometheus.GaugeVec, labels prometheus.Labels, value float64) error {
+	gauge, err := vec.GetMetricWith(labels)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLabelMismatch, err)
+	}
+
+	gauge.Set(value)
+	return nil
+}
@@ -0,0 +1,46 @@
+package metric
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSetGauge(t *testing.T) {
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "sensor_value"}, []string{"device", "sensor"})
+
+	if err := SetGauge(vec, prometheus.Labels{"device": "device-1", "sensor": "sensor-1"}, 21.5); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := testutil.ToFloat64(vec.WithLabelValues("device-1", "sensor-1")); got != 21.5 {
+		t.Errorf("expected 21.5, got %v", got)
+	}
+}
+
+func TestSetGaugeLabelMismatch(t *testing.T) {
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "sensor_value"}, []string{"device", "sensor"})
+
+	tests := []struct {
+		name   string
+		labels prometheus.Labels
+	}{
+		{name: "missing label", labels: prometheus.Labels{"device": "device-1"}},
+		{name: "extra label", labels: prometheus.Labels{"device": "device-1", "sensor": "sensor-1", "unit": "ºC"}},
+		{name: "renamed label", labels: prometheus.Labels{"device_uuid": "device-1", "sensor": "sensor-1"}},
+		{name: "no labels", labels: nil},
+	}
+
+	for _, tt := range tests {
+		err := SetGauge(vec, tt.labels, 1)
+		if !errors.Is(err, ErrLabelMismatch) {
+			t.Errorf("%s: expected ErrLabelMismatch, got %v", tt.name, err)
+		}
+	}
+
+	if got := testutil.CollectAndCount(vec); got != 0 {
+		t.Errorf("expected no gauge to be set on a mismatch, got %d", got)
+	}
+}
@@ -28,19 +28,43 @@ type NamespacedRegistry struct {
 
 	// Track registered collectors to avoid re-registration
 	collectors map[string]prometheus.Collector
+	registerer prometheus.Registerer
 
 	logger *slog.Logger
 }
 
 // NewNamespacedRegistry creates a new metric registry
+// that registers its collectors with the default Prometheus registry
 func NewNamespacedRegistry(namespace string, logger *slog.Logger) *NamespacedRegistry {
+	return NewNamespacedRegistryWithRegisterer(namespace, prometheus.DefaultRegisterer, logger)
+}
+
+// NewNamespacedRegistryWithRegisterer creates a new metric registry that registers
+// its collectors with the given registerer. With a nil registerer, collectors are
+// only tracked locally and exposed by the registry itself acting as a prometheus.Collector.
+func NewNamespacedRegistryWithRegisterer(namespace string, registerer prometheus.Registerer, logger *slog.Logger) *NamespacedRegistry {
 	return &NamespacedRegistry{
 		namespace:  namespace,
 		collectors: make(map[string]prometheus.Collector),
+		registerer: registerer,
 		logger:     logger,
 	}
 }
 
+// Describe sends no descriptors, making the registry an unchecked collector
+// as its metrics are created dynamically
+func (r *NamespacedRegistry) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect collects all metrics of the registered collectors
+func (r *NamespacedRegistry) Collect(ch chan<- prometheus.Metric) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, collector := range r.collectors {
+		collector.Collect(ch)
+	}
+}
+
 func (r *NamespacedRegistry) GetCollectorByName(name string) (prometheus.Collector, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -59,9 +83,11 @@ func (r *NamespacedRegistry) Register(name string, collector prometheus.Collecto
 	}
 
 	// Register with Prometheus
-	if err := prometheus.Register(collector); err != nil {
-		r.logger.Error("Failed to register collector", "name", name, "error", err)
-		return
+	if r.registerer != nil {
+		if err := r.registerer.Register(collector); err != nil {
+			r.logger.Error("Failed to register collector", "name", name, "error", err)
+			return
+		}
 	}
 
 	// Add to internal map
@@ -1,19 +1,131 @@
 package metric
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
 	"sync"
 )
 
+// metricNamePartPattern matches characters allowed in a Prometheus metric name part
+var metricNamePartPattern = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+var (
+	ErrInvalidMappingItem = fmt.Errorf("invalid metric mapping item")
+	ErrInvalidValue       = fmt.Errorf("invalid sensor value")
+)
+
 type MetricMappingItem struct {
 	Metric   string `json:"metric"`
 	Category string `json:"category"`
+
+	// Help overrides the help text of the value gauge
+	Help string `json:"help,omitempty"`
+
+	// Min and Max bound the plausible values, nil leaves the side unbounded
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// Clamp limits out of range values to the bounds instead of dropping them
+	Clamp bool `json:"clamp,omitempty"`
+	// Sentinels are placeholder values the API reports instead of a reading, e.g. -9999
+	Sentinels []float64 `json:"sentinels,omitempty"`
+
+	// Scale and Offset convert the value to value*scale + offset, e.g. scale 0.01 for Pa to hPa,
+	// or scale 1.8 and offset 32 for Celsius to Fahrenheit; a zero scale keeps the value.
+	// Min, Max and Sentinels apply to the value as reported, before the conversion
+	Scale  float64 `json:"scale,omitempty"`
+	Offset float64 `json:"offset,omitempty"`
+	// Unit replaces the reported unit in the unit label, it should be set with a conversion
+	Unit string `json:"unit,omitempty"`
+}
+
+// ConvertValue applies the unit conversion of the item
+func (m MetricMappingItem) ConvertValue(value float64) float64 {
+	if m.Scale != 0 {
+		value *= m.Scale
+	}
+
+	return value + m.Offset
+}
+
+// UnitLabel returns the unit of the converted value, or the reported unit without an override
+func (m MetricMappingItem) UnitLabel(reported string) string {
+	if m.Unit != "" {
+		return m.Unit
+	}
+
+	return reported
+}
+
+// CheckValue returns the value to emit, or ErrInvalidValue for NaN, infinite,
+// sentinel and out of range values; the zero item only rejects NaN and infinite values
+func (m MetricMappingItem) CheckValue(value float64) (float64, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return value, fmt.Errorf("%w: %v", ErrInvalidValue, value)
+	}
+
+	if slices.Contains(m.Sentinels, value) {
+		return value, fmt.Errorf("%w: sentinel %v", ErrInvalidValue, value)
+	}
+
+	if m.Min != nil && value < *m.Min {
+		if m.Clamp {
+			return *m.Min, nil
+		}
+
+		return value, fmt.Errorf("%w: %v is below the minimum %v", ErrInvalidValue, value, *m.Min)
+	}
+
+	if m.Max != nil && value > *m.Max {
+		if m.Clamp {
+			return *m.Max, nil
+		}
+
+		return value, fmt.Errorf("%w: %v is above the maximum %v", ErrInvalidValue, value, *m.Max)
+	}
+
+	return value, nil
 }
 
 func (m MetricMappingItem) MetricName() string {
 	return fmt.Sprintf("%s_%s", m.Category, m.Metric)
 }
 
+// HelpText returns the configured help, or one derived from the metric and category;
+// Prometheus keeps a single help text per metric name, so it can't vary per sensor
+func (m MetricMappingItem) HelpText() string {
+	if m.Help != "" {
+		return m.Help
+	}
+
+	return fmt.Sprintf("Current %s sensor value (%s)", m.Metric, m.Category)
+}
+
+// Validate checks that the item produces a valid metric name
+func (m MetricMappingItem) Validate() error {
+	var errs []error
+	if m.Metric == "" {
+		errs = append(errs, fmt.Errorf("%w: metric must not be empty", ErrInvalidMappingItem))
+	} else if !metricNamePartPattern.MatchString(m.Metric) {
+		errs = append(errs, fmt.Errorf("%w: metric %q may contain only letters, digits and underscores", ErrInvalidMappingItem, m.Metric))
+	}
+
+	if m.Category == "" {
+		errs = append(errs, fmt.Errorf("%w: category must not be empty", ErrInvalidMappingItem))
+	} else if !metricNamePartPattern.MatchString(m.Category) {
+		errs = append(errs, fmt.Errorf("%w: category %q may contain only letters, digits and underscores", ErrInvalidMappingItem, m.Category))
+	}
+
+	if m.Min != nil && m.Max != nil && *m.Min > *m.Max {
+		errs = append(errs, fmt.Errorf("%w: min %v must not be greater than max %v", ErrInvalidMappingItem, *m.Min, *m.Max))
+	}
+
+	return errors.Join(errs...)
+}
+
 type SensorMetricMapping struct {
 	mu sync.RWMutex
 
@@ -40,3 +152,19 @@ func (m *SensorMetricMapping) Get(sensorName string) (MetricMappingItem, bool) {
 	item, exists := m.items[sensorName]
 	return item, exists
 }
+
+// Len returns the number of mapped sensors
+func (m *SensorMetricMapping) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.items)
+}
+
+// Names returns the sorted names of mapped sensors
+func (m *SensorMetricMapping) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(m.items))
+}
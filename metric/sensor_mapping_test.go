@@ -0,0 +1,58 @@
+package metric
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMetricMappingItemConvertValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		item  MetricMappingItem
+		value float64
+		want  float64
+	}{
+		{name: "no conversion", item: MetricMappingItem{}, value: 21.5, want: 21.5},
+		{name: "Celsius to Fahrenheit", item: MetricMappingItem{Scale: 1.8, Offset: 32}, value: 21.5, want: 70.7},
+		{name: "freezing point", item: MetricMappingItem{Scale: 1.8, Offset: 32}, value: 0, want: 32},
+		{name: "Pa to hPa", item: MetricMappingItem{Scale: 0.01}, value: 101325, want: 1013.25},
+		{name: "offset only", item: MetricMappingItem{Offset: -273.15}, value: 294.65, want: 21.5},
+	}
+
+	for _, tt := range tests {
+		if got := tt.item.ConvertValue(tt.value); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestMetricMappingItemUnitLabel(t *testing.T) {
+	if got := (MetricMappingItem{}).UnitLabel("ºC"); got != "ºC" {
+		t.Errorf("expected the reported unit without an override, got %q", got)
+	}
+
+	if got := (MetricMappingItem{Scale: 1.8, Offset: 32, Unit: "°F"}).UnitLabel("ºC"); got != "°F" {
+		t.Errorf("expected the unit of the converted value, got %q", got)
+	}
+}
+
+func TestMetricMappingItemBoundsApplyBeforeConversion(t *testing.T) {
+	minPa, maxPa := 30000.0, 110000.0
+	item := MetricMappingItem{Min: &minPa, Max: &maxPa, Sentinels: []float64{-9999}, Scale: 0.01}
+
+	value, err := item.CheckValue(101325)
+	if err != nil {
+		t.Fatalf("expected the reported value to be in range, got %v", err)
+	}
+
+	if got := item.ConvertValue(value); math.Abs(got-1013.25) > 1e-9 {
+		t.Errorf("expected 1013.25 hPa, got %v", got)
+	}
+
+	for _, value := range []float64{1013.25, -9999, math.NaN()} {
+		if _, err := item.CheckValue(value); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("value %v: expected ErrInvalidValue, got %v", value, err)
+		}
+	}
+}
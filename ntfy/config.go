@@ -1,19 +1,47 @@
 package ntfy
 
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/timgluz/smcprober/envconfig"
+)
+
 const (
 	DefaultNtfyEndpoint    = "https://ntfy.sh"
 	DefaultNtfyTopic       = "your-ntfy-topic"
 	DefaultNtfyTokenEnvVar = "NTFY_TOKEN" // #nosec G101 -- This is an environment variable name, not a credential
 )
 
+// Environment variables overriding the config file values
+const (
+	EnvEndpoint = "NTFY_ENDPOINT"
+	EnvTopic    = "NTFY_TOPIC"
+	EnvTokenEnv = "NTFY_TOKEN_ENV"
+)
+
 type Config struct {
+	// Type selects the notifier backend, see NotifierRegistry
+	Type string `json:"type,omitempty"`
+
 	Endpoint string `json:"endpoint"`
 	Topic    string `json:"topic"`
 	TokenEnv string `json:"token_env"`
+
+	// DedupeWindowSeconds suppresses identical notifications within the window, 0 disables it
+	DedupeWindowSeconds int `json:"dedupe_window_seconds,omitempty"`
+}
+
+func (c *Config) DedupeWindowDuration() time.Duration {
+	return time.Duration(c.DedupeWindowSeconds) * time.Second
 }
 
 func DefaultNtfyConfig() Config {
 	return Config{
+		Type:     NotifierTypeNtfy,
 		Endpoint: DefaultNtfyEndpoint,
 		Topic:    DefaultNtfyTopic,
 		TokenEnv: DefaultNtfyTokenEnvVar,
@@ -21,6 +49,10 @@ func DefaultNtfyConfig() Config {
 }
 
 func (c *Config) ApplyDefaults() {
+	if c.Type == "" {
+		c.Type = NotifierTypeNtfy
+	}
+
 	if c.Endpoint == "" {
 		c.Endpoint = DefaultNtfyEndpoint
 	}
@@ -33,3 +65,33 @@ func (c *Config) ApplyDefaults() {
 		c.TokenEnv = DefaultNtfyTokenEnvVar
 	}
 }
+
+// ApplyEnv overrides config values with the environment variables that are set
+func (c *Config) ApplyEnv() {
+	envconfig.String(EnvEndpoint, &c.Endpoint)
+	envconfig.String(EnvTopic, &c.Topic)
+	envconfig.String(EnvTokenEnv, &c.TokenEnv)
+}
+
+// Validate reports all configuration problems at once, it doesn't make any network calls
+func (c *Config) Validate() error {
+	var errs []error
+
+	if _, err := url.ParseRequestURI(c.Endpoint); err != nil {
+		errs = append(errs, fmt.Errorf("invalid ntfy endpoint %q: %w", c.Endpoint, err))
+	}
+
+	if c.Topic == "" || c.Topic == DefaultNtfyTopic {
+		errs = append(errs, fmt.Errorf("ntfy topic must be set, got %q", c.Topic))
+	}
+
+	if c.DedupeWindowSeconds < 0 {
+		errs = append(errs, fmt.Errorf("dedupe_window_seconds must not be negative, got %d", c.DedupeWindowSeconds))
+	}
+
+	if c.TokenEnv != "" && os.Getenv(c.TokenEnv) == "" {
+		errs = append(errs, fmt.Errorf("environment variable %s must be set", c.TokenEnv))
+	}
+
+	return errors.Join(errs...)
+}
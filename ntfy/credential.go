@@ -6,6 +6,8 @@ import (
 	"os"
 )
 
+// TokenCredentialProvider retrieves the token the notifier authenticates with;
+// Retrieve must return once ctx is done, e.g. when a secret manager doesn't answer in time
 type TokenCredentialProvider interface {
 	Retrieve(ctx context.Context) (string, error)
 }
@@ -21,6 +23,10 @@ func NewTokenCredentialEnvProvider(envVar string) *TokenCredentialEnvProvider {
 }
 
 func (p *TokenCredentialEnvProvider) Retrieve(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
 	token := os.Getenv(p.envVar)
 	if token == "" {
 		return "", fmt.Errorf("environment variable %s must be set", p.envVar)
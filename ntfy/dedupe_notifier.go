@@ -0,0 +1,120 @@
+package ntfy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/timgluz/smcprober/clock"
+)
+
+var (
+	ErrNilNotifier = fmt.Errorf("notifier cannot be nil")
+)
+
+// DedupeNotifier suppresses identical notifications sent within the window,
+// e.g. when several alert rules fire for the same device at once
+type DedupeNotifier struct {
+	next   Notifier
+	window time.Duration
+
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	clock clock.Clock
+}
+
+// NewDedupeNotifier wraps next, it returns ErrNilNotifier without a notifier to forward to
+func NewDedupeNotifier(next Notifier, window time.Duration) (*DedupeNotifier, error) {
+	if next == nil {
+		return nil, fmt.Errorf("dedupe notifier: %w", ErrNilNotifier)
+	}
+
+	return &DedupeNotifier{
+		next:   next,
+		window: window,
+		seen:   make(map[string]time.Time),
+		clock:  clock.Real(),
+	}, nil
+}
+
+// SetClock replaces the clock deciding when the window is over
+func (n *DedupeNotifier) SetClock(c clock.Clock) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.clock = c
+}
+
+// Send forwards the notification unless an identical one was sent within the window;
+// the key is reserved before sending, so concurrent identical notifications are sent once,
+// and released when the send fails, so it could be retried
+func (n *DedupeNotifier) Send(ctx context.Context, msg Notification) error {
+	key := dedupeKey(msg)
+
+	n.mu.Lock()
+	now := n.clock.Now()
+	n.prune(now)
+	if _, ok := n.seen[key]; ok {
+		n.mu.Unlock()
+		return nil
+	}
+	n.seen[key] = now
+	n.mu.Unlock()
+
+	if err := n.next.Send(ctx, msg); err != nil {
+		n.mu.Lock()
+		if n.seen[key].Equal(now) {
+			delete(n.seen, key)
+		}
+		n.mu.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// Sent returns the keys of the notifications sent within the window and when they were sent,
+// a job running once per invocation saves them and restores them in the next run
+func (n *DedupeNotifier) Sent() map[string]time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.prune(n.clock.Now())
+	return maps.Clone(n.seen)
+}
+
+// Restore marks the notifications returned by Sent as sent, entries outside the window are dropped
+func (n *DedupeNotifier) Restore(sent map[string]time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	maps.Copy(n.seen, sent)
+	n.prune(n.clock.Now())
+}
+
+// prune drops the entries older than the window, the caller must hold the lock
+func (n *DedupeNotifier) prune(now time.Time) {
+	for key, sentAt := range n.seen {
+		if now.Sub(sentAt) >= n.window {
+			delete(n.seen, key)
+		}
+	}
+}
+
+// dedupeKey hashes the ID of the notification, or without an ID the fields identifying it,
+// separated by a zero byte so the field boundaries can't be shifted
+func dedupeKey(msg Notification) string {
+	var sum [sha256.Size]byte
+	if msg.ID != "" {
+		sum = sha256.Sum256([]byte(msg.Topic + "\x00" + msg.ID))
+	} else {
+		sum = sha256.Sum256([]byte(msg.Topic + "\x00" + msg.Title + "\x00" + msg.Message))
+	}
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,177 @@
+package ntfy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timgluz/smcprober/clock"
+)
+
+func newTestDedupeNotifier(t *testing.T, next Notifier, fakeClock *clock.FakeClock) *DedupeNotifier {
+	t.Helper()
+
+	notifier, err := NewDedupeNotifier(next, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	notifier.SetClock(fakeClock)
+	return notifier
+}
+
+func TestDedupeNotifierSuppressesDuplicates(t *testing.T) {
+	recorder := NewRecordingNotifier()
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+
+	notifier := newTestDedupeNotifier(t, recorder, fakeClock)
+
+	first := NewNotification("alerts", "Alert: Battery Level Low", "Battery level is low", WithID("battery_low/device-1"))
+	other := NewNotification("alerts", "Alert: Battery Level Low", "Battery level is low", WithID("battery_low/device-2"))
+	for _, msg := range []Notification{first, first, other} {
+		if err := notifier.Send(context.Background(), msg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if got := len(recorder.Sent()); got != 2 {
+		t.Fatalf("expected the duplicate to be suppressed, got %d notifications", got)
+	}
+
+	fakeClock.Advance(time.Hour)
+	if err := notifier.Send(context.Background(), first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := len(recorder.Sent()); got != 3 {
+		t.Errorf("expected the notification to be sent again after the window, got %d notifications", got)
+	}
+}
+
+func TestDedupeNotifierRestore(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+	msg := NewNotification("alerts", "Alert: Battery Level Low", "Battery level is low", WithID("battery_low/device-1"))
+
+	firstRun := newTestDedupeNotifier(t, NewRecordingNotifier(), fakeClock)
+	if err := firstRun.Send(context.Background(), msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sent := firstRun.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 sent notification, got %v", sent)
+	}
+
+	// the next run within the window restores what the first one sent
+	fakeClock.Advance(30 * time.Minute)
+	recorder := NewRecordingNotifier()
+	nextRun := newTestDedupeNotifier(t, recorder, fakeClock)
+	nextRun.Restore(sent)
+
+	if err := nextRun.Send(context.Background(), msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := len(recorder.Sent()); got != 0 {
+		t.Errorf("expected the restored notification to be a duplicate, got %d notifications", got)
+	}
+
+	// a run after the window drops the restored entries
+	fakeClock.Advance(time.Hour)
+	lateRun := newTestDedupeNotifier(t, recorder, fakeClock)
+	lateRun.Restore(sent)
+
+	if got := lateRun.Sent(); len(got) != 0 {
+		t.Errorf("expected the expired entries to be dropped, got %v", got)
+	}
+}
+
+func TestNewDedupeNotifierRejectsNil(t *testing.T) {
+	if _, err := NewDedupeNotifier(nil, time.Hour); !errors.Is(err, ErrNilNotifier) {
+		t.Errorf("expected ErrNilNotifier, got %v", err)
+	}
+}
+
+// blockingNotifier holds every send until release is closed and counts the sends
+type blockingNotifier struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (n *blockingNotifier) Send(ctx context.Context, msg Notification) error {
+	n.mu.Lock()
+	n.calls++
+	n.mu.Unlock()
+
+	n.started <- struct{}{}
+	<-n.release
+	return nil
+}
+
+func TestDedupeNotifierConcurrentDuplicates(t *testing.T) {
+	blocking := &blockingNotifier{started: make(chan struct{}, 2), release: make(chan struct{})}
+	notifier := newTestDedupeNotifier(t, blocking, clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)))
+	msg := NewNotification("alerts", "Alert: Device Offline", "Device is offline", WithID("device_offline/device-1"))
+
+	first := make(chan error, 1)
+	go func() {
+		first <- notifier.Send(context.Background(), msg)
+	}()
+
+	// the duplicate arrives while the first notification is still being sent
+	<-blocking.started
+	if err := notifier.Send(context.Background(), msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	close(blocking.release)
+	if err := <-first; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if blocking.calls != 1 {
+		t.Errorf("expected the concurrent duplicate to be suppressed, got %d sends", blocking.calls)
+	}
+}
+
+// failingNotifier fails every send while err is set
+type failingNotifier struct {
+	err      error
+	recorder *RecordingNotifier
+}
+
+func (n *failingNotifier) Send(ctx context.Context, msg Notification) error {
+	if n.err != nil {
+		return n.err
+	}
+
+	return n.recorder.Send(ctx, msg)
+}
+
+func TestDedupeNotifierReleasesFailedSends(t *testing.T) {
+	failing := &failingNotifier{err: errors.New("ntfy unavailable"), recorder: NewRecordingNotifier()}
+	notifier := newTestDedupeNotifier(t, failing, clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)))
+	msg := NewNotification("alerts", "Alert: Device Offline", "Device is offline", WithID("device_offline/device-1"))
+
+	if err := notifier.Send(context.Background(), msg); err == nil {
+		t.Fatal("expected the failed send to be returned")
+	}
+
+	if got := notifier.Sent(); len(got) != 0 {
+		t.Errorf("expected the failed notification not to be remembered, got %v", got)
+	}
+
+	failing.err = nil
+	if err := notifier.Send(context.Background(), msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := len(failing.recorder.Sent()); got != 1 {
+		t.Errorf("expected the retry to be sent, got %d notifications", got)
+	}
+}
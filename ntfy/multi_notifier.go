@@ -0,0 +1,50 @@
+package ntfy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MultiNotifier fans every notification out to all of its notifiers,
+// e.g. to get both a push notification and an email for critical alerts
+type MultiNotifier struct {
+	notifiers []Notifier
+
+	// requireAll fails the send if any notifier fails, otherwise one successful notifier is enough
+	requireAll bool
+}
+
+func NewMultiNotifier(notifiers ...Notifier) *MultiNotifier {
+	return &MultiNotifier{
+		notifiers:  notifiers,
+		requireAll: true,
+	}
+}
+
+// SetRequireAll decides whether a partial failure fails the whole send, it is the default;
+// when disabled the send only fails if none of the notifiers succeeded
+func (n *MultiNotifier) SetRequireAll(requireAll bool) {
+	n.requireAll = requireAll
+}
+
+// Send delivers the notification to all notifiers, even if some of them fail,
+// and reports the failures as a joined error
+func (n *MultiNotifier) Send(ctx context.Context, msg Notification) error {
+	var errs []error
+	for i, notifier := range n.notifiers {
+		if err := notifier.Send(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("notifier %d (%T): %w", i, notifier, err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	if n.requireAll || len(errs) == len(n.notifiers) {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package ntfy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// stubNotifier counts the sends and returns err
+type stubNotifier struct {
+	err   error
+	calls int
+}
+
+func (n *stubNotifier) Send(ctx context.Context, msg Notification) error {
+	n.calls++
+	return n.err
+}
+
+func TestMultiNotifierSend(t *testing.T) {
+	emailDown := errors.New("smtp unavailable")
+	pushDown := errors.New("ntfy unavailable")
+
+	tests := []struct {
+		name       string
+		errs       []error
+		requireAll bool
+		wantErrs   []error
+	}{
+		{name: "all ok, require all", errs: []error{nil, nil}, requireAll: true},
+		{name: "all ok, any", errs: []error{nil, nil}, requireAll: false},
+		{name: "partial failure, require all", errs: []error{nil, emailDown}, requireAll: true, wantErrs: []error{emailDown}},
+		{name: "partial failure, any", errs: []error{nil, emailDown}, requireAll: false},
+		{name: "all failing, require all", errs: []error{pushDown, emailDown}, requireAll: true, wantErrs: []error{pushDown, emailDown}},
+		{name: "all failing, any", errs: []error{pushDown, emailDown}, requireAll: false, wantErrs: []error{pushDown, emailDown}},
+	}
+
+	for _, tt := range tests {
+		stubs := make([]*stubNotifier, len(tt.errs))
+		notifiers := make([]Notifier, len(tt.errs))
+		for i, err := range tt.errs {
+			stubs[i] = &stubNotifier{err: err}
+			notifiers[i] = stubs[i]
+		}
+
+		multi := NewMultiNotifier(notifiers...)
+		multi.SetRequireAll(tt.requireAll)
+
+		err := multi.Send(context.Background(), NewNotification("alerts", "Alert", "Device is offline"))
+		if len(tt.wantErrs) == 0 && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+
+		for _, want := range tt.wantErrs {
+			if !errors.Is(err, want) {
+				t.Errorf("%s: expected the error to join %v, got %v", tt.name, want, err)
+			}
+		}
+
+		// a failing notifier doesn't stop the others
+		for i, stub := range stubs {
+			if stub.calls != 1 {
+				t.Errorf("%s: expected notifier %d to be called once, got %d", tt.name, i, stub.calls)
+			}
+		}
+	}
+}
+
+func TestMultiNotifierErrorNamesNotifier(t *testing.T) {
+	multi := NewMultiNotifier(&stubNotifier{}, &stubNotifier{err: errors.New("smtp unavailable")})
+
+	err := multi.Send(context.Background(), NewNotification("alerts", "Alert", "Device is offline"))
+	if err == nil || !strings.Contains(err.Error(), "notifier 1 (*ntfy.stubNotifier)") {
+		t.Errorf("expected the error to name the failing notifier, got %v", err)
+	}
+}
+
+func TestMultiNotifierWithoutNotifiers(t *testing.T) {
+	if err := NewMultiNotifier().Send(context.Background(), NewNotification("alerts", "Alert", "Device is offline")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
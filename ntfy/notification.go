@@ -1,5 +1,17 @@
 package ntfy
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidDelay = fmt.Errorf("invalid notification delay")
+)
+
 type Notification struct {
 	Topic   string `json:"topic"`
 	Title   string `json:"title"`
@@ -11,6 +23,30 @@ type Notification struct {
 	Click    string `json:"click,omitempty"`
 
 	Tags []string `json:"tags,omitempty"`
+
+	// Delay schedules the delivery, either a duration like 30m or a Unix timestamp
+	Delay string `json:"delay,omitempty"`
+
+	// Endpoint overrides the default server of the notifier, it is not part of the message
+	Endpoint string `json:"-"`
+
+	// ID identifies the alert firing the notification is sent for, notifications with the same ID
+	// are duplicates; it is sent in the Idempotency-Key header for proxies that deduplicate requests,
+	// ntfy itself ignores it, so the DedupeNotifier suppresses the duplicates
+	ID string `json:"-"`
+}
+
+// NotificationID derives a stable ID from the parts identifying an alert firing,
+// e.g. the rule ID, the device and the day, so resending after a restart yields the same ID
+func NotificationID(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		// the zero byte separates the parts, so their boundaries can't be shifted
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)[:16])
 }
 
 type NotificationOption func(*Notification)
@@ -46,6 +82,59 @@ func WithTags(tags []string) NotificationOption {
 
 }
 
+// WithDelay schedules the notification, e.g. a follow-up if a device is still offline,
+// the delay is checked when the notification is sent
+func WithDelay(delay string) NotificationOption {
+	return func(n *Notification) {
+		n.Delay = delay
+	}
+}
+
+// WithID marks notifications for the same alert firing as duplicates, see NotificationID
+func WithID(id string) NotificationOption {
+	return func(n *Notification) {
+		n.ID = id
+	}
+}
+
+// WithEndpoint sends the notification to another ntfy server than the notifier default
+func WithEndpoint(endpoint string) NotificationOption {
+	return func(n *Notification) {
+		n.Endpoint = endpoint
+	}
+}
+
+// Validate checks the fields the server would reject
+func (n Notification) Validate() error {
+	return validateDelay(n.Delay)
+}
+
+// validateDelay accepts a positive duration or a Unix timestamp, the formats ntfy understands
+func validateDelay(delay string) error {
+	if delay == "" {
+		return nil
+	}
+
+	if timestamp, err := strconv.ParseInt(delay, 10, 64); err == nil {
+		if timestamp <= 0 {
+			return fmt.Errorf("%w %q: timestamp must be positive", ErrInvalidDelay, delay)
+		}
+
+		return nil
+	}
+
+	duration, err := time.ParseDuration(delay)
+	if err != nil {
+		return fmt.Errorf("%w %q: expected a duration like 30m or a Unix timestamp", ErrInvalidDelay, delay)
+	}
+
+	if duration <= 0 {
+		return fmt.Errorf("%w %q: duration must be positive", ErrInvalidDelay, delay)
+	}
+
+	return nil
+}
+
 func NewNotification(topic, title, message string, opts ...NotificationOption) Notification {
 	notification := Notification{
 		Topic:   topic,
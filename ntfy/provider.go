@@ -7,8 +7,25 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timgluz/smcprober/metric"
+)
+
+var (
+	ErrInvalidEndpoint = fmt.Errorf("invalid notification endpoint")
 )
 
+// DefaultCredentialTimeout bounds the token retrieval, so a slow credential provider
+// can't hold up the notification until the request deadline
+const DefaultCredentialTimeout = 5 * time.Second
+
+// IdempotencyKeyHeader carries the ID of the notification, see Notification.ID
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 type Notifier interface {
 	Send(ctx context.Context, msg Notification) error
 }
@@ -19,45 +36,105 @@ type HTTPNotifier struct {
 	client      *http.Client
 	logger      *slog.Logger
 	credentials TokenCredentialProvider
+
+	credentialTimeout time.Duration
+
+	// Metrics, nil without a registry
+	sentCounter   *prometheus.CounterVec
+	failedCounter *prometheus.CounterVec
 }
 
 func NewHTTPNotifier(endpoint string, client *http.Client, logger *slog.Logger) *HTTPNotifier {
 	return &HTTPNotifier{
-		endpoint: endpoint,
-		client:   client,
-		logger:   logger,
+		endpoint:          endpoint,
+		client:            client,
+		logger:            logger,
+		credentialTimeout: DefaultCredentialTimeout,
 	}
 }
 
+// NewHTTPNotifierWithRegistry creates a notifier counting the sent and failed notifications per topic,
+// e.g. to alert when the notifications themselves can't be delivered
+func NewHTTPNotifierWithRegistry(endpoint string, client *http.Client, registry metric.Registry, logger *slog.Logger) *HTTPNotifier {
+	notifier := NewHTTPNotifier(endpoint, client, logger)
+	notifier.sentCounter = registry.GetOrCreateCounterVec(
+		"ntfy_notifications_sent_total",
+		"Total notifications delivered to the ntfy server",
+		[]string{"topic"},
+	)
+	notifier.failedCounter = registry.GetOrCreateCounterVec(
+		"ntfy_notifications_failed_total",
+		"Total notifications that could not be delivered",
+		[]string{"topic"},
+	)
+
+	return notifier
+}
+
 func (n *HTTPNotifier) SetCredentialProvider(provider TokenCredentialProvider) error {
 	n.credentials = provider
 	return nil
 }
 
+// SetCredentialTimeout limits how long the credential provider may take to retrieve the token,
+// 0 only keeps the deadline of the send context
+func (n *HTTPNotifier) SetCredentialTimeout(timeout time.Duration) {
+	n.credentialTimeout = timeout
+}
+
 func (n *HTTPNotifier) Send(ctx context.Context, msg Notification) error {
-	// Implementation of sending notification
+	err := n.send(ctx, msg)
+	if err != nil {
+		if n.failedCounter != nil {
+			n.failedCounter.WithLabelValues(msg.Topic).Inc()
+		}
+
+		return err
+	}
+
+	if n.sentCounter != nil {
+		n.sentCounter.WithLabelValues(msg.Topic).Inc()
+	}
+
+	return nil
+}
+
+func (n *HTTPNotifier) send(ctx context.Context, msg Notification) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+
 	jsonData, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.endpoint, bytes.NewBuffer(jsonData))
+	endpoint, err := n.resolveEndpoint(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if msg.ID != "" {
+		req.Header.Set(IdempotencyKeyHeader, msg.ID)
+	}
 
-	// Add authentication if credentials are provided
-	if n.credentials != nil {
-		token, err := n.credentials.Retrieve(ctx)
+	// Add authentication if credentials are provided, the token is only
+	// sent to the host of the default endpoint to not leak it to other servers
+	if n.credentials != nil && n.isDefaultHost(endpoint) {
+		token, err := n.retrieveToken(ctx)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to retrieve ntfy token: %w", err)
 		}
 		req.Header.Set("Authorization", "Bearer "+token)
 	}
 
-	n.logger.Info("Sending notification", "topic", msg.Topic)
+	n.logger.Info("Sending notification", "topic", msg.Topic, "endpoint", endpoint.Redacted())
 	resp, err := n.client.Do(req)
 	if err != nil {
 		return err
@@ -76,3 +153,41 @@ func (n *HTTPNotifier) Send(ctx context.Context, msg Notification) error {
 
 	return nil
 }
+
+// retrieveToken asks the credential provider for the token within the credential timeout
+func (n *HTTPNotifier) retrieveToken(ctx context.Context) (string, error) {
+	if n.credentialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.credentialTimeout)
+		defer cancel()
+	}
+
+	return n.credentials.Retrieve(ctx)
+}
+
+// resolveEndpoint returns the endpoint override of the notification, or the default endpoint
+func (n *HTTPNotifier) resolveEndpoint(msg Notification) (*url.URL, error) {
+	if msg.Endpoint == "" {
+		return url.Parse(n.endpoint)
+	}
+
+	endpoint, err := url.ParseRequestURI(msg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %w", ErrInvalidEndpoint, msg.Endpoint, err)
+	}
+
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("%w %q: scheme must be http or https", ErrInvalidEndpoint, msg.Endpoint)
+	}
+
+	return endpoint, nil
+}
+
+func (n *HTTPNotifier) isDefaultHost(endpoint *url.URL) bool {
+	defaultEndpoint, err := url.Parse(n.endpoint)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(defaultEndpoint.Host, endpoint.Host)
+}
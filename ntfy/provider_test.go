@@ -0,0 +1,212 @@
+package ntfy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newCaptureServer records the JSON body of every request and replies with the status
+func newCaptureServer(t *testing.T, status int) (*httptest.Server, *[]map[string]any) {
+	t.Helper()
+
+	payloads := make([]map[string]any, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request body: %v", err)
+		}
+
+		var payload map[string]any
+		if err := json.Unmarshal(content, &payload); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		payloads = append(payloads, payload)
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &payloads
+}
+
+func TestHTTPNotifierSendsAttachment(t *testing.T) {
+	server, payloads := newCaptureServer(t, http.StatusOK)
+	notifier := NewHTTPNotifier(server.URL, server.Client(), slog.New(slog.DiscardHandler))
+
+	notification := NewNotification("alerts", "Alert: Battery Level Low", "Battery level is low",
+		WithAttachment("https://example.com/charts/battery.png"),
+		WithFilename("battery.png"),
+	)
+	if err := notifier.Send(context.Background(), notification); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*payloads) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(*payloads))
+	}
+
+	want := map[string]any{
+		"topic":    "alerts",
+		"title":    "Alert: Battery Level Low",
+		"message":  "Battery level is low",
+		"attach":   "https://example.com/charts/battery.png",
+		"filename": "battery.png",
+	}
+	assertPayload(t, (*payloads)[0], want)
+}
+
+// assertPayload compares the decoded JSON body with the expected fields, no other fields may be sent
+func assertPayload(t *testing.T, got, want map[string]any) {
+	t.Helper()
+
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value, got[key])
+		}
+	}
+
+	for key := range got {
+		if _, ok := want[key]; !ok {
+			t.Errorf("unexpected field %s=%v in payload", key, got[key])
+		}
+	}
+}
+
+// slowCredentialProvider blocks until the context is done, like an unreachable secret manager
+type slowCredentialProvider struct{}
+
+func (slowCredentialProvider) Retrieve(ctx context.Context) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestHTTPNotifierCancelsSlowCredentialProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		ctx     func() (context.Context, context.CancelFunc)
+	}{
+		{
+			name:    "credential timeout",
+			timeout: 50 * time.Millisecond,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+		},
+		{
+			name: "caller deadline without credential timeout",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, payloads := newCaptureServer(t, http.StatusOK)
+			notifier := NewHTTPNotifier(server.URL, server.Client(), slog.New(slog.DiscardHandler))
+			notifier.SetCredentialTimeout(tt.timeout)
+			if err := notifier.SetCredentialProvider(slowCredentialProvider{}); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			start := time.Now()
+			err := notifier.Send(ctx, NewNotification("alerts", "Alert", "Battery level is low"))
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected the credential retrieval to time out, got %v", err)
+			}
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected the retrieval to be cancelled at the deadline, took %v", elapsed)
+			}
+
+			if len(*payloads) != 0 {
+				t.Errorf("expected no notification without a token, got %d", len(*payloads))
+			}
+		})
+	}
+}
+
+func TestHTTPNotifierSendsDelay(t *testing.T) {
+	for _, delay := range []string{"30m", "1735819200"} {
+		server, payloads := newCaptureServer(t, http.StatusOK)
+		notifier := NewHTTPNotifier(server.URL, server.Client(), slog.New(slog.DiscardHandler))
+
+		notification := NewNotification("alerts", "Device offline", "Is the device still offline?", WithDelay(delay))
+		if err := notifier.Send(context.Background(), notification); err != nil {
+			t.Fatalf("delay %q: unexpected error: %v", delay, err)
+		}
+
+		assertPayload(t, (*payloads)[0], map[string]any{
+			"topic":   "alerts",
+			"title":   "Device offline",
+			"message": "Is the device still offline?",
+			"delay":   delay,
+		})
+	}
+}
+
+func TestHTTPNotifierRejectsInvalidDelay(t *testing.T) {
+	for _, delay := range []string{"tomorrow", "-5m", "0s", "0", "-1"} {
+		server, payloads := newCaptureServer(t, http.StatusOK)
+		notifier := NewHTTPNotifier(server.URL, server.Client(), slog.New(slog.DiscardHandler))
+
+		err := notifier.Send(context.Background(), NewNotification("alerts", "Device offline", "", WithDelay(delay)))
+		if !errors.Is(err, ErrInvalidDelay) {
+			t.Errorf("delay %q: expected ErrInvalidDelay, got %v", delay, err)
+		}
+
+		if len(*payloads) != 0 {
+			t.Errorf("delay %q: expected no request, got %d", delay, len(*payloads))
+		}
+	}
+}
+
+func TestNotificationWithoutDelayOmitsField(t *testing.T) {
+	content, err := json.Marshal(NewNotification("alerts", "Alert", "Battery level is low"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(content, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := payload["delay"]; ok {
+		t.Errorf("expected no delay field, got %s", content)
+	}
+}
+
+func TestHTTPNotifierSendsIdempotencyKey(t *testing.T) {
+	headers := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get(IdempotencyKeyHeader))
+	}))
+	t.Cleanup(server.Close)
+
+	notifier := NewHTTPNotifier(server.URL, server.Client(), slog.New(slog.DiscardHandler))
+	id := NotificationID("battery_low", "device-1", "2025-01-02")
+	for _, msg := range []Notification{
+		NewNotification("alerts", "Alert", "Battery level is low", WithID(id)),
+		NewNotification("alerts", "Alert", "Battery level is low"),
+	} {
+		if err := notifier.Send(context.Background(), msg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(headers) != 2 || headers[0] != id || headers[1] != "" {
+		t.Errorf("expected the ID only for the notification that has one, got %q", headers)
+	}
+}
@@ -0,0 +1,50 @@
+package ntfy
+
+import (
+	"context"
+	"sync"
+)
+
+// RecordingNotifier keeps all notifications in memory instead of sending them,
+// it is useful for tests and dry runs
+type RecordingNotifier struct {
+	mu sync.RWMutex
+
+	sent []Notification
+}
+
+func NewRecordingNotifier() *RecordingNotifier {
+	return &RecordingNotifier{
+		sent: make([]Notification, 0),
+	}
+}
+
+func (n *RecordingNotifier) Send(ctx context.Context, msg Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+// Sent returns a copy of all recorded notifications in the order they were sent
+func (n *RecordingNotifier) Sent() []Notification {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	sent := make([]Notification, len(n.sent))
+	copy(sent, n.sent)
+	return sent
+}
+
+// Reset drops all recorded notifications
+func (n *RecordingNotifier) Reset() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.sent = n.sent[:0]
+}
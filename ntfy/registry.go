@@ -0,0 +1,99 @@
+package ntfy
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/timgluz/smcprober/httpclient"
+	"github.com/timgluz/smcprober/metric"
+)
+
+const (
+	NotifierTypeNtfy = "ntfy"
+)
+
+var (
+	ErrUnknownNotifierType = fmt.Errorf("unknown notifier type")
+)
+
+// NotifierFactory creates a notifier backend from the notification config,
+// backends count their notifications in the registry unless it is nil
+type NotifierFactory func(config Config, registry metric.Registry, logger *slog.Logger) (Notifier, error)
+
+// NotifierRegistry maps the notifier types of the config to their backends
+type NotifierRegistry struct {
+	mu sync.RWMutex
+
+	factories map[string]NotifierFactory
+}
+
+func NewNotifierRegistry() *NotifierRegistry {
+	return &NotifierRegistry{
+		factories: make(map[string]NotifierFactory),
+	}
+}
+
+// DefaultNotifierRegistry returns a registry with the built-in backends
+func DefaultNotifierRegistry() *NotifierRegistry {
+	registry := NewNotifierRegistry()
+	registry.Register(NotifierTypeNtfy, NewNtfyNotifier)
+
+	return registry
+}
+
+// Register adds or replaces the backend of the notifier type
+func (r *NotifierRegistry) Register(notifierType string, factory NotifierFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.factories[notifierType] = factory
+}
+
+// Types returns the sorted names of the registered notifier types
+func (r *NotifierRegistry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(r.factories))
+}
+
+// New creates the notifier selected by the config type
+func (r *NotifierRegistry) New(config Config, registry metric.Registry, logger *slog.Logger) (Notifier, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[config.Type]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q, expected one of: %s", ErrUnknownNotifierType, config.Type, strings.Join(r.Types(), ", "))
+	}
+
+	return factory(config, registry, logger)
+}
+
+// NewNtfyNotifier creates an ntfy backend authenticating with the token of config.TokenEnv
+func NewNtfyNotifier(config Config, registry metric.Registry, logger *slog.Logger) (Notifier, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("ntfy endpoint cannot be empty")
+	}
+
+	client := httpclient.NewDefaultHTTPClient()
+
+	var notifier *HTTPNotifier
+	if registry != nil {
+		notifier = NewHTTPNotifierWithRegistry(config.Endpoint, client, registry, logger)
+	} else {
+		notifier = NewHTTPNotifier(config.Endpoint, client, logger)
+	}
+
+	if config.TokenEnv != "" {
+		if err := notifier.SetCredentialProvider(NewTokenCredentialEnvProvider(config.TokenEnv)); err != nil {
+			return nil, err
+		}
+	}
+
+	return notifier, nil
+}
@@ -0,0 +1,84 @@
+package ntfy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/timgluz/smcprober/metric"
+)
+
+func notificationCount(t *testing.T, registry *metric.NamespacedRegistry, name, topic string) float64 {
+	t.Helper()
+
+	collector, exists := registry.GetCollectorByName(name)
+	if !exists {
+		t.Fatalf("expected %s to be registered", name)
+	}
+
+	return testutil.ToFloat64(collector.(*prometheus.CounterVec).WithLabelValues(topic))
+}
+
+func TestNtfyNotifierCountsNotifications(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+
+	tests := []struct {
+		name       string
+		status     int
+		wantSent   float64
+		wantFailed float64
+	}{
+		{name: "delivered", status: http.StatusOK, wantSent: 1},
+		{name: "rejected", status: http.StatusForbidden, wantFailed: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newCaptureServer(t, tt.status)
+			registry := metric.NewNamespacedRegistryWithRegisterer("test", nil, logger)
+
+			notifier, err := DefaultNotifierRegistry().New(Config{Type: NotifierTypeNtfy, Endpoint: server.URL}, registry, logger)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_ = notifier.Send(context.Background(), NewNotification("alerts", "Alert", "Battery level is low"))
+
+			if got := notificationCount(t, registry, "ntfy_notifications_sent_total", "alerts"); got != tt.wantSent {
+				t.Errorf("expected %v sent, got %v", tt.wantSent, got)
+			}
+
+			if got := notificationCount(t, registry, "ntfy_notifications_failed_total", "alerts"); got != tt.wantFailed {
+				t.Errorf("expected %v failed, got %v", tt.wantFailed, got)
+			}
+		})
+	}
+}
+
+func TestNtfyNotifierWithoutRegistry(t *testing.T) {
+	server, payloads := newCaptureServer(t, http.StatusOK)
+
+	notifier, err := NewNtfyNotifier(Config{Type: NotifierTypeNtfy, Endpoint: server.URL}, nil, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := notifier.Send(context.Background(), NewNotification("alerts", "Alert", "Battery level is low")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*payloads) != 1 {
+		t.Errorf("expected 1 notification, got %d", len(*payloads))
+	}
+}
+
+func TestNotifierRegistryUnknownType(t *testing.T) {
+	_, err := DefaultNotifierRegistry().New(Config{Type: "pager"}, nil, slog.New(slog.DiscardHandler))
+	if !errors.Is(err, ErrUnknownNotifierType) {
+		t.Errorf("expected ErrUnknownNotifierType, got %v", err)
+	}
+}
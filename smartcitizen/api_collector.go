@@ -0,0 +1,84 @@
+package smartcitizen
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const DefaultCollectTimeout = 30 * time.Second
+
+// APICollector fetches data from the SmartCitizen API lazily when Prometheus scrapes /metrics.
+//
+// Unlike APIExporter.Start, which polls the API on a ticker, no API calls are made
+// while nobody scrapes the exporter. To avoid hammering the API on rapid or parallel
+// scrapes, data is cached and refreshed at most once per minInterval; scrapes in
+// between return the cached values. The trade-off is that a scrape which triggers
+// a refresh takes as long as the API calls, so scrape timeouts must allow for it.
+type APICollector struct {
+	exporter    *APIExporter
+	source      prometheus.Collector
+	minInterval time.Duration
+	timeout     time.Duration
+
+	ctx context.Context
+
+	mu          sync.Mutex
+	lastRefresh time.Time
+}
+
+// NewAPICollector wraps the exporter, whose registry must be a prometheus.Collector
+// that is not registered elsewhere, see metric.NewNamespacedRegistryWithRegisterer
+func NewAPICollector(ctx context.Context, exporter *APIExporter, minInterval time.Duration) (*APICollector, error) {
+	if exporter == nil {
+		return nil, fmt.Errorf("exporter cannot be nil")
+	}
+
+	source, ok := exporter.registry.(prometheus.Collector)
+	if !ok {
+		return nil, fmt.Errorf("exporter registry %T does not implement prometheus.Collector", exporter.registry)
+	}
+
+	// in pull mode the collector is the updater, it runs as long as it is registered
+	if exporter.updaterUpGauge != nil {
+		exporter.updaterUpGauge.Set(1)
+	}
+
+	return &APICollector{
+		exporter:    exporter,
+		source:      source,
+		minInterval: minInterval,
+		timeout:     DefaultCollectTimeout,
+		ctx:         ctx,
+	}, nil
+}
+
+// Describe sends no descriptors, as metrics are created dynamically from API data
+func (c *APICollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *APICollector) Collect(ch chan<- prometheus.Metric) {
+	c.refresh()
+	c.source.Collect(ch)
+}
+
+// refresh updates the metrics if the cached data is older than minInterval,
+// concurrent scrapes wait for the running refresh instead of starting their own
+func (c *APICollector) refresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.exporter.clock.Now()
+	if !c.lastRefresh.IsZero() && now.Sub(c.lastRefresh) < c.minInterval {
+		c.exporter.logger.Debug("Serving cached metrics", "lastRefresh", c.lastRefresh)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	defer cancel()
+
+	_ = c.exporter.runUpdate(ctx)
+	c.lastRefresh = now
+}
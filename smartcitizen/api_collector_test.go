@@ -0,0 +1,86 @@
+package smartcitizen
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/timgluz/smcprober/clock"
+	"github.com/timgluz/smcprober/metric"
+)
+
+// newTestExporter creates an exporter of a public device whose API isn't reachable
+func newTestExporter(t *testing.T) (*APIExporter, *metric.NamespacedRegistry) {
+	t.Helper()
+
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	config := Config{PublicMode: true, PublicDeviceIDs: []int{1}}
+	config.ApplyDefaults()
+
+	logger := slog.New(slog.DiscardHandler)
+	registry := metric.NewNamespacedRegistryWithRegisterer("test", nil, logger)
+	return NewAPIExporterWithRegistry(config, provider, registry, metric.NewSensorMetricMapping(), logger), registry
+}
+
+func TestAPICollectorReportsUpdaterUp(t *testing.T) {
+	exporter, _ := newTestExporter(t)
+
+	if got := testutil.ToFloat64(exporter.updaterUpGauge); got != 0 {
+		t.Fatalf("expected the updater to be down before it starts, got %v", got)
+	}
+
+	if _, err := NewAPICollector(context.Background(), exporter, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := testutil.ToFloat64(exporter.updaterUpGauge); got != 1 {
+		t.Errorf("expected the pull mode collector to report the updater up, got %v", got)
+	}
+}
+
+func TestAPICollectorRefreshesOncePerInterval(t *testing.T) {
+	var requests atomic.Int64
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	})
+
+	config := Config{PublicMode: true, PublicDeviceIDs: []int{1}}
+	config.ApplyDefaults()
+
+	logger := slog.New(slog.DiscardHandler)
+	registry := metric.NewNamespacedRegistryWithRegisterer("test", nil, logger)
+	exporter := NewAPIExporterWithRegistry(config, provider, registry, metric.NewSensorMetricMapping(), logger)
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+	exporter.SetClock(fakeClock)
+
+	collector, err := NewAPICollector(context.Background(), exporter, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testutil.CollectAndCount(collector)
+	fetched := requests.Load()
+	if fetched == 0 {
+		t.Fatal("expected the first scrape to fetch the device")
+	}
+
+	fakeClock.Advance(59 * time.Second)
+	testutil.CollectAndCount(collector)
+	if got := requests.Load(); got != fetched {
+		t.Errorf("expected the scrape within the interval to be served from the cache, got %d requests", got-fetched)
+	}
+
+	fakeClock.Advance(time.Second)
+	testutil.CollectAndCount(collector)
+	if got := requests.Load(); got == fetched {
+		t.Error("expected the scrape after the interval to fetch again")
+	}
+}
@@ -2,14 +2,35 @@ package smartcitizen
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timgluz/smcprober/clock"
+	"github.com/timgluz/smcprober/httpclient"
 	"github.com/timgluz/smcprober/metric"
 )
 
+var (
+	ErrUpdateInProgress = fmt.Errorf("metrics update already in progress")
+	ErrReauthBackoff    = fmt.Errorf("re-authentication is backing off after a failed attempt")
+	ErrNoDevices        = fmt.Errorf("no devices found")
+	ErrConverterPanic   = metric.ErrConverterPanic
+)
+
+// noUpdateYet is the device count before the first successful update
+const noUpdateYet = -1
+
+// Re-authentication attempts back off exponentially, so a changed password doesn't lock the account
+const (
+	DefaultReauthBackoff = 30 * time.Second
+	MaxReauthBackoff     = 15 * time.Minute
+)
+
 // APIExporter uses the metric registry
 type APIExporter struct {
 	config Config
@@ -19,8 +40,42 @@ type APIExporter struct {
 	converter metric.Converter
 	logger    *slog.Logger
 
+	sensorFilter   *SensorFilter
+	statsConverter *DeviceSensorStatsConverter
+	clock          clock.Clock
+
+	// updating guards against overlapping updates
+	updating sync.Mutex
+
+	// credentials re-authenticate rejected sessions, nil disables re-authentication;
+	// the backoff state is guarded by updating
+	credentials    UserCredentialProvider
+	reauthFailures int
+	nextReauthAt   time.Time
+
+	// lastUpdateAt is the start of the previous update, guarded by updating
+	lastUpdateAt time.Time
+
+	// lastDevicesCount is the number of devices of the latest successful update, for readiness
+	lastDevicesCount atomic.Int64
+
+	// stop signals the background updater to exit, done is closed once it has exited;
+	// started makes Start run only once
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	started  atomic.Bool
+
 	// Metrics
-	dataErrorCounter *prometheus.CounterVec
+	dataErrorCounter      *prometheus.CounterVec
+	skippedUpdatesCounter prometheus.Counter
+	lastSuccessGauge      prometheus.Gauge
+	scrapeDurationGauge   prometheus.Gauge
+	scrapeIntervalGauge   prometheus.Gauge
+	devicesGauge          prometheus.Gauge
+	sensorsGauge          prometheus.Gauge
+	updaterUpGauge        prometheus.Gauge
+	reauthCounter         *prometheus.CounterVec
 }
 
 func NewAPIExporter(namespace string, config Config, provider Provider, logger *slog.Logger) *APIExporter {
@@ -37,56 +92,253 @@ func NewAPIExporterWithRegistry(config Config, provider Provider,
 	logger *slog.Logger,
 ) *APIExporter {
 	// Register converters
+	deviceInfoConverter := NewDeviceInfoConverter("info")
+	deviceInfoConverter.SetIncludeOwner(config.OwnerFilter != OwnerFilterSelf)
+	deviceInfoConverter.SetIncludeMACAddress(config.IncludeMACAddress)
+	deviceStateConverter := NewDeviceStateConverter("state")
+	deviceStateConverter.SetStateValues(config.StateValues)
+	deviceLocationConverter := NewDeviceLocationConverter("location")
+	sensorConverter := NewDeviceSensorConverter("state", sensorMapping)
+	sensorConverter.SetIncludeUnit(config.IncludeUnitLabel)
+	sensorConverter.SetSensorLabels(config.SensorLabels)
+	if config.SmoothingAlpha > 0 {
+		sensorConverter.SetSmoothingAlpha(config.SmoothingAlpha)
+	}
+	sensorInfoConverter := NewDeviceSensorInfoConverter("info")
+	sensorInfoConverter.SetSensorMapping(sensorMapping)
+
+	// Attach configured constant labels, e.g. tenant, to every emitted metric
+	deviceInfoConverter.SetExtraLabels(config.ExtraLabels)
+	deviceStateConverter.SetExtraLabels(config.ExtraLabels)
+	deviceLocationConverter.SetExtraLabels(config.ExtraLabels)
+	sensorConverter.SetExtraLabels(config.ExtraLabels)
+	sensorInfoConverter.SetExtraLabels(config.ExtraLabels)
+
 	converter := metric.NewCombinedConverter()
-	converter.Add(NewDeviceInfoConverter("device_info"),
-		NewDeviceStateConverter("device_state"),
-		NewDeviceSensorConverter("sensor", sensorMapping),
-		NewDeviceSensorInfoConverter("sensor_info"),
+	converter.Add(deviceInfoConverter,
+		deviceStateConverter,
+		deviceLocationConverter,
+		sensorConverter,
+		sensorInfoConverter,
 	)
 
+	if config.AQI != nil {
+		aqiConverter := NewDeviceAQIConverter("aqi", *config.AQI, sensorMapping)
+		aqiConverter.SetExtraLabels(config.ExtraLabels)
+		converter.Add(aqiConverter)
+	}
+
+	var statsConverter *DeviceSensorStatsConverter
+	if config.StatsWindowSeconds > 0 {
+		statsConverter = NewDeviceSensorStatsConverter("value", config.StatsWindowDuration(), sensorMapping)
+		statsConverter.SetSensorLabels(config.SensorLabels)
+		statsConverter.SetExtraLabels(config.ExtraLabels)
+		converter.Add(statsConverter)
+	}
+
 	// Create error counter once
 	dataErrorCounter := registry.GetOrCreateCounterVec(
 		"data_errors_total",
-		"Total data processing errors",
-		[]string{"type"},
+		"Total data processing errors by the failing converter",
+		[]string{"converter", "type"},
+	)
+
+	lastSuccessGauge := registry.GetOrCreateGauge(
+		"exporter_last_success_timestamp_seconds",
+		"Unix timestamp of the last successful metrics update",
+	)
+
+	scrapeDurationGauge := registry.GetOrCreateGauge(
+		"exporter_last_scrape_duration_seconds",
+		"Duration of the last successful metrics update in seconds",
+	)
+
+	scrapeIntervalGauge := registry.GetOrCreateGauge(
+		"exporter_scrape_interval_seconds",
+		"Observed time between the starts of the last two metrics updates in seconds",
+	)
+
+	skippedUpdatesCounter := registry.GetOrCreateCounter(
+		"exporter_updates_skipped_total",
+		"Total metrics updates skipped because the previous update was still running",
+	)
+
+	devicesGauge := registry.GetOrCreateGauge(
+		"devices_total",
+		"Number of devices seen in the latest metrics update",
+	)
+
+	sensorsGauge := registry.GetOrCreateGauge(
+		"sensors_total",
+		"Number of sensors across all devices seen in the latest metrics update",
+	)
+
+	updaterUpGauge := registry.GetOrCreateGauge(
+		"exporter_updater_up",
+		"Whether the metrics updater, the background loop or the pull mode collector, is running (1) or has stopped (0)",
 	)
 
-	return &APIExporter{
-		config:           config,
-		provider:         provider,
-		registry:         registry,
-		converter:        converter,
-		logger:           logger,
-		dataErrorCounter: dataErrorCounter,
+	reauthCounter := registry.GetOrCreateCounterVec(
+		"reauthentications_total",
+		"Total re-authentication attempts after the session was rejected or expired",
+		[]string{"result"},
+	)
+
+	exporter := &APIExporter{
+		config:                config,
+		provider:              provider,
+		registry:              registry,
+		converter:             converter,
+		sensorFilter:          NewSensorFilter(config.IncludeSensors, config.ExcludeSensors),
+		statsConverter:        statsConverter,
+		clock:                 clock.Real(),
+		logger:                logger,
+		dataErrorCounter:      dataErrorCounter,
+		skippedUpdatesCounter: skippedUpdatesCounter,
+		lastSuccessGauge:      lastSuccessGauge,
+		scrapeDurationGauge:   scrapeDurationGauge,
+		scrapeIntervalGauge:   scrapeIntervalGauge,
+		devicesGauge:          devicesGauge,
+		sensorsGauge:          sensorsGauge,
+		updaterUpGauge:        updaterUpGauge,
+		reauthCounter:         reauthCounter,
+		stop:                  make(chan struct{}),
+		done:                  make(chan struct{}),
+	}
+	exporter.lastDevicesCount.Store(noUpdateYet)
+
+	return exporter
+}
+
+// Ready reports ErrNoDevices while the latest update found no devices, if the config requires devices;
+// until the first update finished it isn't known, so it isn't ready either
+func (e *APIExporter) Ready() error {
+	if !e.config.RequireDevices {
+		return nil
+	}
+
+	switch count := e.lastDevicesCount.Load(); count {
+	case noUpdateYet:
+		return fmt.Errorf("%w yet, waiting for the first metrics update", ErrNoDevices)
+	case 0:
+		return fmt.Errorf("%w in the latest metrics update", ErrNoDevices)
+	default:
+		return nil
+	}
+}
+
+// SetClock replaces the clock used for update timestamps and the stats windows
+func (e *APIExporter) SetClock(c clock.Clock) {
+	e.clock = c
+	if e.statsConverter != nil {
+		e.statsConverter.SetClock(c)
+	}
+}
+
+// SetCredentialProvider enables re-authentication with freshly retrieved credentials
+// when the session expires or is rejected, e.g. after the token lifetime of username/password logins
+func (e *APIExporter) SetCredentialProvider(credentials UserCredentialProvider) {
+	e.credentials = credentials
+}
+
+// SetNameStrategy overrides the metric names of all converters, call it before the first update
+func (e *APIExporter) SetNameStrategy(names NameStrategy) {
+	combined, ok := e.converter.(*metric.CombinedConverter)
+	if !ok {
+		return
+	}
+
+	for _, converter := range combined.Converters() {
+		if named, ok := converter.(interface{ SetNameStrategy(NameStrategy) }); ok {
+			named.SetNameStrategy(names)
+		}
 	}
 }
 
+// loggerFor returns a logger tagged with the correlation ID of the update cycle
+func (e *APIExporter) loggerFor(ctx context.Context) *slog.Logger {
+	if requestID, ok := httpclient.RequestIDFromContext(ctx); ok {
+		return e.logger.With("requestID", requestID)
+	}
+
+	return e.logger
+}
+
 func (e *APIExporter) fetchAPIData(ctx context.Context) (*UserDeviceCollection, error) {
+	if e.config.PublicMode {
+		return e.fetchPublicAPIData(ctx)
+	}
+
+	logger := e.loggerFor(ctx)
+	if e.sessionExpired() {
+		logger.Info("Session has expired, re-authenticating")
+		if err := e.reauthenticate(ctx); err != nil {
+			logger.Warn("Failed to re-authenticate expired session", "error", err)
+		}
+	}
+
 	user, err := e.provider.GetMe(ctx)
+	if e.credentials != nil && (errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrNoSession)) {
+		logger.Warn("Session was rejected, re-authenticating", "error", err)
+		if reauthErr := e.reauthenticate(ctx); reauthErr != nil {
+			logger.Error("Failed to re-authenticate", "error", reauthErr)
+		} else {
+			user, err = e.provider.GetMe(ctx)
+		}
+	}
+
 	if err != nil {
-		e.logger.Error("Failed to get authenticated user", "error", err)
+		logger.Error("Failed to get authenticated user", "error", err)
 		return nil, fmt.Errorf("failed to get authenticated user: %w", err)
 	}
 
+	// an account without devices usually means the credentials belong to another user
+	if len(user.Devices) == 0 {
+		logger.Warn("Authenticated user has no devices, check the configured credentials",
+			"userID", user.ID, "username", user.Username)
+	}
+
 	result := UserDeviceCollection{
 		User:    user,
 		Devices: make([]DeviceDetail, 0),
 	}
 
 	for _, device := range user.Devices {
-		e.logger.Info("User device", "deviceID", device.ID, "name", device.Name, "state", device.State)
+		// abort promptly on shutdown instead of fetching remaining devices
+		select {
+		case <-ctx.Done():
+			logger.Warn("Fetching devices cancelled", "fetchedDevices", len(result.Devices), "totalDevices", len(user.Devices))
+			return nil, ctx.Err()
+		default:
+		}
+
+		logger.Info("User device", "deviceID", device.ID, "name", device.Name, "state", device.State)
 		deviceDetail, err := e.provider.GetDevice(ctx, device.ID)
+		if errors.Is(err, ErrInvalidDeviceDetail) {
+			logger.Warn("Skipping device with invalid detail", "deviceID", device.ID, "error", err)
+			e.dataErrorCounter.WithLabelValues("provider", "invalid_device").Inc()
+			continue
+		}
+
 		if err != nil {
-			e.logger.Error("Failed to get device detail", "deviceID", device.ID, "error", err)
+			logger.Error("Failed to get device detail", "deviceID", device.ID, "error", err)
 			return nil, fmt.Errorf("failed to get device %d: %w", device.ID, err)
 		}
 
 		if deviceDetail == nil {
-			e.logger.Warn("Device detail is nil", "deviceID", device.ID)
+			logger.Warn("Device detail is nil", "deviceID", device.ID)
+			continue
+		}
+
+		joinUserDevice(deviceDetail, device)
+
+		if !e.isOwnerAllowed(user.ID, deviceDetail) {
+			logger.Debug("Skipping device filtered by owner", "deviceID", device.ID,
+				"ownerID", deviceDetail.Owner.ID, "ownerFilter", e.config.OwnerFilter)
 			continue
 		}
 
-		e.logger.Info("Fetched device detail", "deviceID", deviceDetail.ID,
+		logger.Info("Fetched device detail", "deviceID", deviceDetail.ID,
 			"name", deviceDetail.Name, "state", deviceDetail.State,
 			"sensorsCount", len(deviceDetail.Data.Sensors),
 		)
@@ -96,8 +348,155 @@ func (e *APIExporter) fetchAPIData(ctx context.Context) (*UserDeviceCollection,
 	return &result, nil
 }
 
-func (e *APIExporter) updateMetrics(ctx context.Context) {
-	e.logger.Info("Updating metrics from SmartCitizen API")
+// sessionExpired reports whether the provider session is past its known lifetime
+func (e *APIExporter) sessionExpired() bool {
+	if e.credentials == nil {
+		return false
+	}
+
+	session, ok := e.provider.(interface{ SessionExpiresAt() time.Time })
+	if !ok {
+		return false
+	}
+
+	expiresAt := session.SessionExpiresAt()
+	return !expiresAt.IsZero() && !e.clock.Now().Before(expiresAt)
+}
+
+// reauthenticate authenticates again with freshly retrieved credentials,
+// after a failure it returns ErrReauthBackoff until the backoff has passed
+func (e *APIExporter) reauthenticate(ctx context.Context) error {
+	now := e.clock.Now()
+	if now.Before(e.nextReauthAt) {
+		return fmt.Errorf("%w, next attempt at %s", ErrReauthBackoff, e.nextReauthAt.Format(time.RFC3339))
+	}
+
+	credential, err := e.credentials.Retrieve(ctx)
+	if err == nil {
+		err = e.provider.Authenticate(ctx, credential)
+	}
+
+	if err != nil {
+		e.nextReauthAt = now.Add(reauthBackoff(e.reauthFailures))
+		e.reauthFailures++
+		e.reauthCounter.WithLabelValues("failure").Inc()
+		return fmt.Errorf("failed to re-authenticate: %w", err)
+	}
+
+	e.reauthFailures = 0
+	e.nextReauthAt = time.Time{}
+	e.reauthCounter.WithLabelValues("success").Inc()
+	e.loggerFor(ctx).Info("Re-authenticated with SmartCitizen API")
+	return nil
+}
+
+// reauthBackoff doubles the wait after every consecutive failure up to MaxReauthBackoff
+func reauthBackoff(failures int) time.Duration {
+	backoff := DefaultReauthBackoff
+	for i := 0; i < failures && backoff < MaxReauthBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, MaxReauthBackoff)
+}
+
+// joinUserDevice copies the fields only listed in the user device list into the detail
+func joinUserDevice(detail *DeviceDetail, device UserDevice) {
+	if detail.UUID != device.UUID {
+		return
+	}
+
+	if detail.KitID == 0 {
+		detail.KitID = device.KitID
+	}
+
+	if detail.MACAddress == "" {
+		detail.MACAddress = device.MACAddress
+	}
+}
+
+// fetchPublicAPIData fetches the configured public devices without a user session
+func (e *APIExporter) fetchPublicAPIData(ctx context.Context) (*UserDeviceCollection, error) {
+	logger := e.loggerFor(ctx)
+	result := UserDeviceCollection{
+		Devices: make([]DeviceDetail, 0, len(e.config.PublicDeviceIDs)),
+	}
+
+	for _, deviceID := range e.config.PublicDeviceIDs {
+		select {
+		case <-ctx.Done():
+			logger.Warn("Fetching public devices cancelled", "fetchedDevices", len(result.Devices),
+				"totalDevices", len(e.config.PublicDeviceIDs))
+			return nil, ctx.Err()
+		default:
+		}
+
+		deviceDetail, err := e.provider.GetPublicDevice(ctx, deviceID)
+		if errors.Is(err, ErrInvalidDeviceDetail) {
+			logger.Warn("Skipping device with invalid detail", "deviceID", deviceID, "error", err)
+			e.dataErrorCounter.WithLabelValues("provider", "invalid_device").Inc()
+			continue
+		}
+
+		if err != nil {
+			logger.Error("Failed to get public device detail", "deviceID", deviceID, "error", err)
+			return nil, fmt.Errorf("failed to get public device %d: %w", deviceID, err)
+		}
+
+		logger.Info("Fetched public device detail", "deviceID", deviceDetail.ID,
+			"name", deviceDetail.Name, "state", deviceDetail.State,
+			"sensorsCount", len(deviceDetail.Data.Sensors),
+		)
+		result.Devices = append(result.Devices, *deviceDetail)
+	}
+
+	return &result, nil
+}
+
+// isOwnerAllowed applies the owner filter comparing the device owner with the authenticated user
+func (e *APIExporter) isOwnerAllowed(userID int, detail *DeviceDetail) bool {
+	switch e.config.OwnerFilter {
+	case OwnerFilterSelf:
+		return detail.Owner.ID == userID
+	case OwnerFilterShared:
+		return detail.Owner.ID != userID
+	default:
+		return true
+	}
+}
+
+// TriggerUpdate updates the metrics out of band, e.g. on a manual reload.
+// It returns ErrUpdateInProgress if another update is still running.
+func (e *APIExporter) TriggerUpdate(ctx context.Context) error {
+	return e.runUpdate(ctx)
+}
+
+// runUpdate guards against overlapping updates, which would fetch the same data twice
+func (e *APIExporter) runUpdate(ctx context.Context) error {
+	if !e.updating.TryLock() {
+		e.logger.Warn("Previous metrics update is still running, skipping")
+		e.skippedUpdatesCounter.Inc()
+		return ErrUpdateInProgress
+	}
+	defer e.updating.Unlock()
+
+	return e.updateMetrics(ctx)
+}
+
+func (e *APIExporter) updateMetrics(ctx context.Context) error {
+	// Tie together all log lines and API requests of this cycle
+	ctx = httpclient.WithRequestID(ctx, httpclient.NewRequestID())
+	logger := e.loggerFor(ctx)
+
+	logger.Info("Updating metrics from SmartCitizen API")
+	start := e.clock.Now()
+
+	// slow cycles and skipped ticks show up as drift from the configured interval
+	if !e.lastUpdateAt.IsZero() {
+		e.scrapeIntervalGauge.Set(start.Sub(e.lastUpdateAt).Seconds())
+	}
+	e.lastUpdateAt = start
+
 	// Track requests
 	reqCounter := e.registry.GetOrCreateCounter(
 		"api_requests_total",
@@ -108,7 +507,7 @@ func (e *APIExporter) updateMetrics(ctx context.Context) {
 	// Fetch data
 	data, err := e.fetchAPIData(ctx)
 	if err != nil {
-		e.logger.Error("Error fetching data", "error", err)
+		logger.Error("Error fetching data", "error", err)
 		errCounter := e.registry.GetOrCreateCounterVec(
 			"api_errors_total",
 			"Total API errors",
@@ -116,7 +515,7 @@ func (e *APIExporter) updateMetrics(ctx context.Context) {
 		)
 		errCounter.WithLabelValues("fetch_error").Inc()
 
-		return
+		return err
 	}
 
 	successCounter := e.registry.GetOrCreateCounter(
@@ -126,72 +525,227 @@ func (e *APIExporter) updateMetrics(ctx context.Context) {
 	successCounter.Inc()
 
 	// Update metrics dynamically based on API response
-	e.processAPIData(data)
+	e.processAPIData(ctx, data)
+
+	finishedAt := e.clock.Now()
+	e.scrapeDurationGauge.Set(finishedAt.Sub(start).Seconds())
+	e.lastSuccessGauge.Set(float64(finishedAt.UnixNano()) / 1e9)
+	return nil
 }
 
-func (e *APIExporter) processAPIData(data *UserDeviceCollection) {
+func (e *APIExporter) processAPIData(ctx context.Context, data *UserDeviceCollection) {
+	logger := e.loggerFor(ctx)
 	if data == nil {
-		e.logger.Warn("No data to process")
+		logger.Warn("No data to process")
+		e.devicesGauge.Set(0)
+		e.sensorsGauge.Set(0)
+		e.lastDevicesCount.Store(0)
 		return
 	}
 
+	// Reset fleet size on every cycle, so an empty response doesn't keep stale values
+	sensorsCount := 0
+	for _, device := range data.Devices {
+		sensorsCount += len(device.Data.Sensors)
+	}
+	e.devicesGauge.Set(float64(len(data.Devices)))
+	e.sensorsGauge.Set(float64(sensorsCount))
+	e.lastDevicesCount.Store(int64(len(data.Devices)))
+	if len(data.Devices) == 0 {
+		logger.Warn("Metrics update found no devices")
+	}
+
 	// Map user device details to metrics
 	for _, device := range data.Devices {
-		if err := e.convertDeviceDetailToMetrics(device); err != nil {
-			e.logger.Error("Failed to map device detail to metrics", "error", err, "deviceID", device.ID)
+		if err := e.convertDeviceDetailToMetrics(logger, device); err != nil {
+			logger.Error("Failed to map device detail to metrics", "error", err, "deviceID", device.ID)
 			continue
 		}
 
-		if err := e.convertDeviceSensorsToMetrics(device.UUID, device.Data.Sensors); err != nil {
-			e.logger.Error("Failed to map device sensors to metrics", "error", err, "deviceID", device.ID)
+		if err := e.convertDeviceSensorsToMetrics(logger, device.UUID, device.Data.Sensors); err != nil {
+			logger.Error("Failed to map device sensors to metrics", "error", err, "deviceID", device.ID)
 			continue
 		}
 	}
+
+	// Drop the stats windows of sensors missing from this cycle, e.g. of removed devices
+	if e.statsConverter != nil {
+		if pruned := e.statsConverter.Prune(e.registry); pruned > 0 {
+			logger.Debug("Pruned stale sensor stats windows", "count", pruned)
+		}
+	}
 }
 
+// ConvertDevice runs the device and its sensors through all converters,
+// unlike the background updater it reports every conversion error
+func (e *APIExporter) ConvertDevice(device DeviceDetail) error {
+	var errs []error
+	if err := e.convertDeviceDetailToMetrics(e.logger, device); err != nil {
+		errs = append(errs, fmt.Errorf("device %d: %w", device.ID, err))
+	}
+
+	for _, sensor := range device.Data.Sensors {
+		if err := e.convertDeviceSensorsToMetrics(e.logger, device.UUID, []DeviceSensor{sensor}); err != nil {
+			errs = append(errs, fmt.Errorf("device %d sensor %q: %w", device.ID, sensor.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Start runs the background updater until the context is cancelled or Stop is called,
+// later calls return right away
 func (e *APIExporter) Start(ctx context.Context, interval time.Duration) {
+	if !e.started.CompareAndSwap(false, true) {
+		e.logger.Warn("Metrics updater is already started")
+		return
+	}
+	defer close(e.done)
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	if e.updaterUpGauge != nil {
+		e.updaterUpGauge.Set(1)
+		defer e.updaterUpGauge.Set(0)
+	}
+
 	if e.registry == nil {
 		e.logger.Error("Metric registry is not initialized")
 		return
 	}
 
 	// Update metrics immediately on start
-	e.updateMetrics(ctx)
+	_ = e.runUpdate(ctx)
 
 	for {
 		select {
 		case <-ctx.Done():
 			e.logger.Info("Stopping metrics updater", "reason", ctx.Err())
 			return
+		case <-e.stop:
+			e.logger.Info("Stopping metrics updater", "reason", "stop requested")
+			return
 		case <-ticker.C:
-			e.updateMetrics(ctx)
+			_ = e.runUpdate(ctx)
 			e.logger.Info("Metrics updated, will update again after interval", "interval", interval)
 		}
 	}
 }
 
-func (e *APIExporter) convertDeviceDetailToMetrics(detail DeviceDetail) error {
-	if err := e.converter.Convert(e.registry, detail); err != nil {
-		e.logger.Error("Error converting device detail to metrics", "deviceID", detail.ID, "error", err)
-		e.dataErrorCounter.WithLabelValues("mapping_error").Inc()
+// Stop signals the background updater to exit after the running update finishes,
+// unlike cancelling the context it doesn't abort in-flight API requests
+func (e *APIExporter) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+}
+
+// Done is closed once Start has returned; it never closes if Start wasn't called
+func (e *APIExporter) Done() <-chan struct{} {
+	return e.done
+}
+
+// Wait blocks until Start has returned
+func (e *APIExporter) Wait() {
+	<-e.done
+}
+
+// conversionErrors splits the joined errors of the converters, e.g. of several converters that panicked
+func conversionErrors(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, err := range joined.Unwrap() {
+		errs = append(errs, conversionErrors(err)...)
+	}
+
+	return errs
+}
+
+// recordConversionError counts every failure by the converter that returned it and the kind of error
+func (e *APIExporter) recordConversionError(err error) {
+	for _, err := range conversionErrors(err) {
+		e.recordConverterError(err)
+	}
+}
+
+func (e *APIExporter) recordConverterError(err error) {
+	converter := ""
+	var converterErr *metric.ConverterError
+	if errors.As(err, &converterErr) {
+		converter = converterErr.Converter
+	}
+
+	errorType := "mapping_error"
+	switch {
+	case errors.Is(err, ErrInvalidDataType):
+		errorType = "invalid_type"
+	case errors.Is(err, metric.ErrInvalidValue):
+		errorType = "invalid_value"
+	case errors.Is(err, metric.ErrLabelMismatch):
+		errorType = "label_mismatch"
+	case errors.Is(err, ErrConverterPanic):
+		errorType = "panic"
+	}
+
+	e.dataErrorCounter.WithLabelValues(converter, errorType).Inc()
+}
+
+// convert runs the converters, a panic caused by the data of a single device or sensor is
+// recovered by the combined converter and returned as ErrConverterPanic, its stack is logged here
+func (e *APIExporter) convert(logger *slog.Logger, data any) error {
+	err := e.converter.Convert(e.registry, data)
+	if err == nil {
+		return nil
+	}
+
+	for _, err := range conversionErrors(err) {
+		var panicErr *metric.PanicError
+		var converterErr *metric.ConverterError
+		if errors.As(err, &panicErr) && errors.As(err, &converterErr) {
+			logger.Error("Converter panicked", "converter", converterErr.Converter, "panic", panicErr.Value, "stack", string(panicErr.Stack))
+		}
+	}
+
+	return err
+}
+
+func (e *APIExporter) convertDeviceDetailToMetrics(logger *slog.Logger, detail DeviceDetail) error {
+	if err := e.convert(logger, detail); err != nil {
+		logger.Error("Error converting device detail to metrics", "deviceID", detail.ID, "error", err)
+		e.recordConversionError(err)
 		return err
 	}
 	return nil
 }
 
-func (e *APIExporter) convertDeviceSensorsToMetrics(deviceUUID string, sensors []DeviceSensor) error {
+func (e *APIExporter) convertDeviceSensorsToMetrics(logger *slog.Logger, deviceUUID string, sensors []DeviceSensor) error {
 	for _, sensor := range sensors {
+		if !e.sensorFilter.Allows(sensor.Name) {
+			logger.Debug("Skipping filtered sensor", "sensorID", sensor.ID, "name", sensor.Name)
+			continue
+		}
+
 		// Ensure sensor has device UUID set
 		if sensor.DeviceUUID == "" {
 			sensor.DeviceUUID = deviceUUID
 		}
 
-		if err := e.converter.Convert(e.registry, sensor); err != nil {
-			e.logger.Error("Error converting sensor data to metrics", "sensorID", sensor.ID, "error", err)
-			e.dataErrorCounter.WithLabelValues("mapping_error").Inc()
+		err := e.convert(logger, sensor)
+		if errors.Is(err, metric.ErrInvalidValue) || errors.Is(err, ErrConverterPanic) {
+			// a bad reading of one sensor shouldn't drop the remaining sensors of the device
+			logger.Warn("Skipping sensor that failed to convert", "sensorID", sensor.ID, "error", err)
+			e.recordConversionError(err)
+			continue
+		}
+
+		if err != nil {
+			logger.Error("Error converting sensor data to metrics", "sensorID", sensor.ID, "error", err)
+			e.recordConversionError(err)
 			return err
 		}
 	}
@@ -0,0 +1,233 @@
+package smartcitizen
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/timgluz/smcprober/clock"
+	"github.com/timgluz/smcprober/metric"
+)
+
+// panickingConverter panics on the sensors with the name, like a converter hitting unexpected data
+type panickingConverter struct {
+	sensorName string
+}
+
+func (c panickingConverter) Name() string {
+	return "panicking"
+}
+
+func (c panickingConverter) Match(name string) bool {
+	return name == DeviceSensorType
+}
+
+func (c panickingConverter) Convert(registry metric.Registry, data any) error {
+	if sensor, ok := data.(DeviceSensor); ok && sensor.Name == c.sensorName {
+		panic("unexpected sensor data")
+	}
+
+	return nil
+}
+
+func TestAPIExporterConvertRecoversPanic(t *testing.T) {
+	exporter, registry := newTestExporter(t)
+	// the panicking converter runs before the default converters
+	exporter.converter = metric.NewCombinedConverter(panickingConverter{sensorName: "Broken"}, exporter.converter)
+	logger := slog.New(slog.DiscardHandler)
+
+	broken := DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Broken", DeviceUUID: "device-1", Value: 1}
+	err := exporter.convert(logger, broken)
+	if !errors.Is(err, ErrConverterPanic) {
+		t.Fatalf("expected ErrConverterPanic, got %v", err)
+	}
+
+	var converterErr *metric.ConverterError
+	if !errors.As(err, &converterErr) || converterErr.Converter != "panicking" {
+		t.Errorf("expected the panic to name the converter, got %v", err)
+	}
+
+	// the converters after the panicking one still run for the same sensor
+	if got := gaugeValue(t, registry, "sensor_state", sensorLabels(nil, broken)); got != 1 {
+		t.Errorf("expected the later converters to convert the sensor, got %v", got)
+	}
+}
+
+func TestAPIExporterConvertDeviceCountsPanics(t *testing.T) {
+	exporter, registry := newTestExporter(t)
+	exporter.converter = metric.NewCombinedConverter(panickingConverter{sensorName: "Broken"}, exporter.converter)
+
+	device := DeviceDetail{ID: 1, UUID: "device-1", Name: "Balcony", Data: DeviceData{
+		Sensors: []DeviceSensor{
+			{ID: 55, UUID: "sensor-1", Name: "Broken", Value: 1},
+			{ID: 56, UUID: "sensor-2", Name: "Temperature", Value: 21.5},
+		},
+	}}
+
+	if err := exporter.ConvertDevice(device); err != nil {
+		t.Fatalf("expected the panic to be skipped like an invalid value, got %v", err)
+	}
+
+	if got := testutil.ToFloat64(exporter.dataErrorCounter.WithLabelValues("panicking", "panic")); got != 1 {
+		t.Errorf("expected one panic to be counted under the converter, got %v", got)
+	}
+
+	collector, _ := registry.GetCollectorByName("sensor_state")
+	if got := testutil.CollectAndCount(collector); got != 2 {
+		t.Errorf("expected both sensors in sensor_state, got %d series", got)
+	}
+}
+
+// rejectingProvider rejects every session and fails to authenticate while authErr is set
+type rejectingProvider struct {
+	authErr  error
+	attempts int
+}
+
+func (p *rejectingProvider) Authenticate(ctx context.Context, credential UserCredential) error {
+	p.attempts++
+	return p.authErr
+}
+
+func (p *rejectingProvider) HasSession() bool { return false }
+
+func (p *rejectingProvider) Ping(ctx context.Context) error { return nil }
+
+func (p *rejectingProvider) GetMe(ctx context.Context) (User, error) {
+	return User{}, ErrUnauthorized
+}
+
+func (p *rejectingProvider) GetDevice(ctx context.Context, deviceID int) (*DeviceDetail, error) {
+	return nil, ErrUnauthorized
+}
+
+func (p *rejectingProvider) GetPublicDevice(ctx context.Context, deviceID int) (*DeviceDetail, error) {
+	return nil, ErrUnauthorized
+}
+
+type staticCredentials struct{}
+
+func (staticCredentials) Retrieve(ctx context.Context) (UserCredential, error) {
+	return UserCredential{Username: "user", Password: "secret"}, nil
+}
+
+func TestReauthBackoff(t *testing.T) {
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute,
+		MaxReauthBackoff, MaxReauthBackoff, MaxReauthBackoff}
+
+	for failures, backoff := range want {
+		if got := reauthBackoff(failures); got != backoff {
+			t.Errorf("%d failures: expected %s, got %s", failures, backoff, got)
+		}
+	}
+
+	if got := reauthBackoff(100); got != MaxReauthBackoff {
+		t.Errorf("expected the backoff to stay at the cap, got %s", got)
+	}
+}
+
+func TestAPIExporterReauthBacksOff(t *testing.T) {
+	provider := &rejectingProvider{authErr: errors.New("invalid credentials")}
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+
+	config := Config{}
+	config.ApplyDefaults()
+
+	logger := slog.New(slog.DiscardHandler)
+	registry := metric.NewNamespacedRegistryWithRegisterer("test", nil, logger)
+	exporter := NewAPIExporterWithRegistry(config, provider, registry, metric.NewSensorMetricMapping(), logger)
+	exporter.SetCredentialProvider(staticCredentials{})
+	exporter.SetClock(fakeClock)
+
+	update := func(elapsed time.Duration, wantAttempts int) {
+		t.Helper()
+
+		fakeClock.Advance(elapsed)
+		if err := exporter.TriggerUpdate(context.Background()); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("expected the rejected session to fail the update, got %v", err)
+		}
+
+		if provider.attempts != wantAttempts {
+			t.Fatalf("after %s: expected %d authentication attempts, got %d", elapsed, wantAttempts, provider.attempts)
+		}
+	}
+
+	update(0, 1)
+	// attempts within the backoff are skipped, it doubles after every failure
+	update(29*time.Second, 1)
+	update(time.Second, 2)
+	update(59*time.Second, 2)
+	update(time.Second, 3)
+	update(2*time.Minute, 4)
+	update(4*time.Minute, 5)
+	update(8*time.Minute, 6)
+
+	// capped at MaxReauthBackoff
+	update(MaxReauthBackoff-time.Second, 6)
+	update(time.Second, 7)
+	update(MaxReauthBackoff, 8)
+
+	// a success resets the backoff, the next failure waits the initial backoff again
+	provider.authErr = nil
+	update(MaxReauthBackoff, 9)
+	provider.authErr = errors.New("password changed")
+	update(0, 10)
+	update(DefaultReauthBackoff-time.Second, 10)
+	update(time.Second, 11)
+
+	if got := testutil.ToFloat64(exporter.reauthCounter.WithLabelValues("success")); got != 1 {
+		t.Errorf("expected one successful re-authentication, got %v", got)
+	}
+
+	if got := testutil.ToFloat64(exporter.reauthCounter.WithLabelValues("failure")); got != 10 {
+		t.Errorf("expected ten failed re-authentications, got %v", got)
+	}
+}
+
+func TestAPIExporterStartOnlyOnce(t *testing.T) {
+	exporter, _ := newTestExporter(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	exporter.Start(ctx, time.Hour)
+	select {
+	case <-exporter.Done():
+	default:
+		t.Fatal("expected Done to be closed after Start returned")
+	}
+
+	// a second call must neither panic on closing done again nor run the updater
+	exporter.Start(context.Background(), time.Hour)
+	exporter.Wait()
+}
+
+func TestAPIExporterPrunesRemovedDeviceStats(t *testing.T) {
+	config := Config{StatsWindowSeconds: 3600}
+	config.ApplyDefaults()
+
+	logger := slog.New(slog.DiscardHandler)
+	registry := metric.NewNamespacedRegistryWithRegisterer("test", nil, logger)
+	exporter := NewAPIExporterWithRegistry(config, &rejectingProvider{}, registry, metric.NewSensorMetricMapping(), logger)
+
+	device := func(id int, uuid string) DeviceDetail {
+		return DeviceDetail{ID: id, UUID: uuid, Name: "Balcony", Data: DeviceData{
+			Sensors: []DeviceSensor{{ID: 55, UUID: "sensor-1", Name: "Temperature", Value: 21.5}},
+		}}
+	}
+
+	exporter.processAPIData(context.Background(), &UserDeviceCollection{Devices: []DeviceDetail{device(1, "device-1"), device(2, "device-2")}})
+	exporter.processAPIData(context.Background(), &UserDeviceCollection{Devices: []DeviceDetail{device(1, "device-1")}})
+
+	collector, exists := registry.GetCollectorByName("sensor_value_avg")
+	if !exists {
+		t.Fatal("expected sensor_value_avg to be registered")
+	}
+
+	if got := testutil.CollectAndCount(collector); got != 1 {
+		t.Errorf("expected the stats of the removed device to be deleted, got %d series", got)
+	}
+}
@@ -0,0 +1,244 @@
+package smartcitizen
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timgluz/smcprober/metric"
+)
+
+// Built-in breakpoint sets of AQIPollutant.Pollutant
+const (
+	PollutantPM25 = "pm2_5"
+	PollutantPM10 = "pm10"
+)
+
+// Aggregates of the sub-indices of AQIConfig.Aggregate
+const (
+	AQIAggregateMax  = "max"
+	AQIAggregateMean = "mean"
+)
+
+// AQIBreakpoint maps the concentration range of a pollutant to a range of the index
+type AQIBreakpoint struct {
+	ConcLow   float64 `json:"conc_low"`
+	ConcHigh  float64 `json:"conc_high"`
+	IndexLow  float64 `json:"index_low"`
+	IndexHigh float64 `json:"index_high"`
+}
+
+// DefaultAQIBreakpoints are the US EPA breakpoints in µg/m3, as revised in 2024
+var DefaultAQIBreakpoints = map[string][]AQIBreakpoint{
+	PollutantPM25: {
+		{ConcLow: 0, ConcHigh: 9.0, IndexLow: 0, IndexHigh: 50},
+		{ConcLow: 9.1, ConcHigh: 35.4, IndexLow: 51, IndexHigh: 100},
+		{ConcLow: 35.5, ConcHigh: 55.4, IndexLow: 101, IndexHigh: 150},
+		{ConcLow: 55.5, ConcHigh: 125.4, IndexLow: 151, IndexHigh: 200},
+		{ConcLow: 125.5, ConcHigh: 225.4, IndexLow: 201, IndexHigh: 300},
+		{ConcLow: 225.5, ConcHigh: 325.4, IndexLow: 301, IndexHigh: 500},
+	},
+	PollutantPM10: {
+		{ConcLow: 0, ConcHigh: 54, IndexLow: 0, IndexHigh: 50},
+		{ConcLow: 55, ConcHigh: 154, IndexLow: 51, IndexHigh: 100},
+		{ConcLow: 155, ConcHigh: 254, IndexLow: 101, IndexHigh: 150},
+		{ConcLow: 255, ConcHigh: 354, IndexLow: 151, IndexHigh: 200},
+		{ConcLow: 355, ConcHigh: 424, IndexLow: 201, IndexHigh: 300},
+		{ConcLow: 425, ConcHigh: 604, IndexLow: 301, IndexHigh: 500},
+	},
+}
+
+// AQIPollutant is an input sensor of the index and the breakpoints of its sub-index
+type AQIPollutant struct {
+	// Sensor is the name of the sensor reporting the pollutant, e.g. "Sensirion SEN5X - PM2.5"
+	Sensor string `json:"sensor"`
+	// Pollutant selects the DefaultAQIBreakpoints when no Breakpoints are given
+	Pollutant   string          `json:"pollutant,omitempty"`
+	Breakpoints []AQIBreakpoint `json:"breakpoints,omitempty"`
+}
+
+func (p AQIPollutant) breakpoints() []AQIBreakpoint {
+	if len(p.Breakpoints) > 0 {
+		return p.Breakpoints
+	}
+
+	return DefaultAQIBreakpoints[p.Pollutant]
+}
+
+// subIndex interpolates the index of the concentration linearly within its breakpoint range,
+// concentrations beyond the last range get its highest index; ok is false without breakpoints
+func (p AQIPollutant) subIndex(concentration float64) (index float64, ok bool) {
+	breakpoints := p.breakpoints()
+	if len(breakpoints) == 0 {
+		return 0, false
+	}
+
+	for _, bp := range breakpoints {
+		if concentration > bp.ConcHigh {
+			continue
+		}
+
+		// concentrations between two ranges, e.g. 9.05 for pm2_5, start the next range
+		if concentration <= bp.ConcLow {
+			return bp.IndexLow, true
+		}
+
+		return bp.IndexLow + (bp.IndexHigh-bp.IndexLow)/(bp.ConcHigh-bp.ConcLow)*(concentration-bp.ConcLow), true
+	}
+
+	return breakpoints[len(breakpoints)-1].IndexHigh, true
+}
+
+// AQIConfig computes an air quality index of every device from its pollutant sensors
+type AQIConfig struct {
+	Pollutants []AQIPollutant `json:"pollutants"`
+	// Aggregate combines the sub-indices, max as the US EPA AQI does, or mean
+	Aggregate string `json:"aggregate,omitempty"`
+}
+
+func (c AQIConfig) Validate() error {
+	var errs []error
+	if len(c.Pollutants) == 0 {
+		errs = append(errs, fmt.Errorf("aqi needs at least one pollutant"))
+	}
+
+	for i, pollutant := range c.Pollutants {
+		if pollutant.Sensor == "" {
+			errs = append(errs, fmt.Errorf("aqi pollutant %d: sensor must be set", i))
+		}
+
+		if len(pollutant.Breakpoints) == 0 {
+			if _, ok := DefaultAQIBreakpoints[pollutant.Pollutant]; !ok {
+				errs = append(errs, fmt.Errorf("aqi pollutant %d: unknown pollutant %q, set breakpoints or one of: %s, %s",
+					i, pollutant.Pollutant, PollutantPM25, PollutantPM10))
+			}
+		}
+
+		for _, bp := range pollutant.Breakpoints {
+			if bp.ConcHigh <= bp.ConcLow || bp.IndexHigh < bp.IndexLow {
+				errs = append(errs, fmt.Errorf("aqi pollutant %d: breakpoint %v must have increasing ranges", i, bp))
+			}
+		}
+	}
+
+	switch c.Aggregate {
+	case "", AQIAggregateMax, AQIAggregateMean:
+	default:
+		errs = append(errs, fmt.Errorf("invalid aqi aggregate %q, expected max or mean", c.Aggregate))
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeviceAQIConverter emits the air quality index of a device computed from several of its sensors
+type DeviceAQIConverter struct {
+	extraLabels
+	naming
+
+	metricName    string
+	config        AQIConfig
+	sensorMapping *metric.SensorMetricMapping
+}
+
+// NewDeviceAQIConverter emits the index gauge, e.g. device_aqi for "aqi"; pollutant values
+// are checked and converted with their sensor mapping like the sensor gauges
+func NewDeviceAQIConverter(metricName string, config AQIConfig, sensorMapping *metric.SensorMetricMapping) *DeviceAQIConverter {
+	if sensorMapping == nil {
+		sensorMapping = metric.NewSensorMetricMapping()
+	}
+
+	return &DeviceAQIConverter{metricName: metricName, config: config, sensorMapping: sensorMapping}
+}
+
+func (c *DeviceAQIConverter) Name() string {
+	return "device_aqi"
+}
+
+func (c *DeviceAQIConverter) Match(name string) bool {
+	return name == DeviceDetailType
+}
+
+// Convert skips devices missing any of the pollutant sensors or reporting an invalid value for one,
+// a partial index would understate it
+func (c *DeviceAQIConverter) Convert(registry metric.Registry, data any) error {
+	device, ok := data.(DeviceDetail)
+	if !ok {
+		return ErrInvalidDataType
+	}
+
+	values := make(map[string]float64, len(device.Data.Sensors))
+	for _, sensor := range device.Data.Sensors {
+		sensorMetric, _ := c.sensorMapping.Get(sensor.Name)
+		value, err := sensorMetric.CheckValue(sensor.Value)
+		if err != nil {
+			continue
+		}
+
+		values[sensor.Name] = sensorMetric.ConvertValue(value)
+	}
+
+	labels := c.withExtraLabels(prometheus.Labels{
+		"uuid": device.UUID,
+	})
+
+	subIndices, ok := c.subIndices(values)
+	if !ok {
+		// a stale index would hide that a pollutant is missing
+		c.deleteIndex(registry, labels)
+		return nil
+	}
+
+	gauge := registry.GetOrCreateGaugeVec(
+		c.deviceMetric(c.metricName),
+		"Air quality index of the device computed from its pollutant sensors",
+		c.labelNames("uuid"),
+	)
+
+	return metric.SetGauge(gauge, labels, c.aggregate(subIndices))
+}
+
+// subIndices computes the index of every pollutant, it fails if any of them is missing or out of range
+func (c *DeviceAQIConverter) subIndices(values map[string]float64) ([]float64, bool) {
+	subIndices := make([]float64, 0, len(c.config.Pollutants))
+	for _, pollutant := range c.config.Pollutants {
+		concentration, ok := values[pollutant.Sensor]
+		if !ok || concentration < 0 {
+			return nil, false
+		}
+
+		index, ok := pollutant.subIndex(concentration)
+		if !ok {
+			return nil, false
+		}
+
+		subIndices = append(subIndices, index)
+	}
+
+	return subIndices, len(subIndices) > 0
+}
+
+// deleteIndex drops the series of the device, without creating the gauge if no index was emitted yet
+func (c *DeviceAQIConverter) deleteIndex(registry metric.Registry, labels prometheus.Labels) {
+	collector, exists := registry.GetCollectorByName(c.deviceMetric(c.metricName))
+	if !exists {
+		return
+	}
+
+	if gauge, ok := collector.(*prometheus.GaugeVec); ok {
+		gauge.Delete(labels)
+	}
+}
+
+func (c *DeviceAQIConverter) aggregate(subIndices []float64) float64 {
+	if c.config.Aggregate == AQIAggregateMean {
+		var sum float64
+		for _, index := range subIndices {
+			sum += index
+		}
+
+		return sum / float64(len(subIndices))
+	}
+
+	return slices.Max(subIndices)
+}
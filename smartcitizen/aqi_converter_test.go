@@ -0,0 +1,167 @@
+package smartcitizen
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/timgluz/smcprober/metric"
+)
+
+func aqiDevice(sensors ...DeviceSensor) DeviceDetail {
+	return DeviceDetail{ID: 1, UUID: "device-1", Name: "Balcony", Data: DeviceData{Sensors: sensors}}
+}
+
+func TestAQIPollutantSubIndex(t *testing.T) {
+	pollutant := AQIPollutant{Sensor: "PM2.5", Pollutant: PollutantPM25}
+
+	tests := []struct {
+		concentration float64
+		want          float64
+	}{
+		{concentration: 0, want: 0},
+		{concentration: 4.5, want: 25},
+		{concentration: 9.05, want: 51},
+		{concentration: 35.4, want: 100},
+		{concentration: 500, want: 500},
+	}
+
+	for _, tt := range tests {
+		got, ok := pollutant.subIndex(tt.concentration)
+		if !ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("concentration %v: expected %v, got %v (ok=%v)", tt.concentration, tt.want, got, ok)
+		}
+	}
+}
+
+func TestAQIPollutantSubIndexWithoutBreakpoints(t *testing.T) {
+	pollutant := AQIPollutant{Sensor: "NO2", Pollutant: "no2"}
+
+	if index, ok := pollutant.subIndex(12); ok {
+		t.Errorf("expected no index without breakpoints, got %v", index)
+	}
+}
+
+func TestDeviceAQIConverterWithoutBreakpoints(t *testing.T) {
+	// an unknown pollutant fails Validate, the converter must not panic on it either
+	converter := NewDeviceAQIConverter("aqi", AQIConfig{Pollutants: []AQIPollutant{{Sensor: "NO2", Pollutant: "no2"}}}, nil)
+	registry := newTestRegistry()
+
+	if err := converter.Convert(registry, aqiDevice(DeviceSensor{Name: "NO2", Value: 12})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, exists := registry.GetCollectorByName("device_aqi"); exists {
+		t.Error("expected no index without breakpoints")
+	}
+}
+
+func TestDeviceAQIConverterAggregate(t *testing.T) {
+	pollutants := []AQIPollutant{
+		{Sensor: "PM2.5", Pollutant: PollutantPM25},
+		{Sensor: "PM10", Pollutant: PollutantPM10},
+	}
+	device := aqiDevice(DeviceSensor{Name: "PM2.5", Value: 4.5}, DeviceSensor{Name: "PM10", Value: 104.5})
+
+	tests := []struct {
+		aggregate string
+		want      float64
+	}{
+		{aggregate: "", want: 75.5},
+		{aggregate: AQIAggregateMax, want: 75.5},
+		{aggregate: AQIAggregateMean, want: 50.25},
+	}
+
+	for _, tt := range tests {
+		converter := NewDeviceAQIConverter("aqi", AQIConfig{Pollutants: pollutants, Aggregate: tt.aggregate}, nil)
+		registry := newTestRegistry()
+		if err := converter.Convert(registry, device); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := gaugeValue(t, registry, "device_aqi", prometheus.Labels{"uuid": "device-1"}); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("aggregate %q: expected %v, got %v", tt.aggregate, tt.want, got)
+		}
+	}
+}
+
+func TestDeviceAQIConverterUsesSensorMapping(t *testing.T) {
+	sensorMapping := metric.NewSensorMetricMapping()
+	// the sensor reports mg/m3, the breakpoints are in µg/m3
+	sensorMapping.Add("PM2.5", metric.MetricMappingItem{Scale: 1000, Unit: "µg/m3", Sentinels: []float64{-1}})
+
+	converter := NewDeviceAQIConverter("aqi", AQIConfig{Pollutants: []AQIPollutant{{Sensor: "PM2.5", Pollutant: PollutantPM25}}}, sensorMapping)
+	registry := newTestRegistry()
+
+	if err := converter.Convert(registry, aqiDevice(DeviceSensor{Name: "PM2.5", Value: 0.0045})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := gaugeValue(t, registry, "device_aqi", prometheus.Labels{"uuid": "device-1"}); math.Abs(got-25) > 1e-9 {
+		t.Errorf("expected the index of the converted 4.5 µg/m3, got %v", got)
+	}
+
+	// a sentinel deletes the index instead of computing one from -1
+	if err := converter.Convert(registry, aqiDevice(DeviceSensor{Name: "PM2.5", Value: -1})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	collector, _ := registry.GetCollectorByName("device_aqi")
+	if got := testutil.CollectAndCount(collector); got != 0 {
+		t.Errorf("expected the index to be deleted on a sentinel, got %d series", got)
+	}
+}
+
+func TestDeviceAQIConverterDeletesStaleIndex(t *testing.T) {
+	converter := NewDeviceAQIConverter("aqi", AQIConfig{Pollutants: []AQIPollutant{
+		{Sensor: "PM2.5", Pollutant: PollutantPM25},
+		{Sensor: "PM10", Pollutant: PollutantPM10},
+	}}, nil)
+	registry := newTestRegistry()
+
+	other := DeviceDetail{ID: 2, UUID: "device-2", Name: "Garden", Data: DeviceData{Sensors: []DeviceSensor{
+		{Name: "PM2.5", Value: 4.5}, {Name: "PM10", Value: 104.5},
+	}}}
+
+	for _, device := range []DeviceDetail{
+		aqiDevice(DeviceSensor{Name: "PM2.5", Value: 4.5}, DeviceSensor{Name: "PM10", Value: 104.5}),
+		other,
+		// the PM10 sensor stopped reporting
+		aqiDevice(DeviceSensor{Name: "PM2.5", Value: 4.5}),
+	} {
+		if err := converter.Convert(registry, device); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	collector, _ := registry.GetCollectorByName("device_aqi")
+	if got := testutil.CollectAndCount(collector); got != 1 {
+		t.Fatalf("expected only the index of device-2, got %d series", got)
+	}
+
+	if got := gaugeValue(t, registry, "device_aqi", prometheus.Labels{"uuid": "device-2"}); math.Abs(got-75.5) > 1e-9 {
+		t.Errorf("expected the index of device-2 to be kept, got %v", got)
+	}
+}
+
+func TestDeviceAQIConverterSkipsPartialIndex(t *testing.T) {
+	converter := NewDeviceAQIConverter("aqi", AQIConfig{Pollutants: []AQIPollutant{
+		{Sensor: "PM2.5", Pollutant: PollutantPM25},
+		{Sensor: "PM10", Pollutant: PollutantPM10},
+	}}, nil)
+	registry := newTestRegistry()
+
+	for _, device := range []DeviceDetail{
+		aqiDevice(DeviceSensor{Name: "PM2.5", Value: 4.5}),
+		aqiDevice(DeviceSensor{Name: "PM2.5", Value: 4.5}, DeviceSensor{Name: "PM10", Value: math.NaN()}),
+	} {
+		if err := converter.Convert(registry, device); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if _, exists := registry.GetCollectorByName("device_aqi"); exists {
+		t.Error("expected no index with a missing or invalid pollutant")
+	}
+}
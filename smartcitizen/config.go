@@ -1,5 +1,17 @@
 package smartcitizen
 
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/timgluz/smcprober/envconfig"
+)
+
 const (
 	DefaultUsernameEnv = "SMARTCITIZEN_USERNAME"
 	DefaultPasswordEnv = "SMARTCITIZEN_PASSWORD"
@@ -7,6 +19,26 @@ const (
 
 	DefaultEndpoint   = "https://api.smartcitizen.me"
 	DefaultAPIVersion = "v0"
+
+	DefaultRetryBackoffMillis = 500
+)
+
+// Owner filters select devices by their owner compared to the authenticated user
+const (
+	OwnerFilterAll    = "all"
+	OwnerFilterSelf   = "self"
+	OwnerFilterShared = "shared"
+)
+
+// Environment variables overriding the config file values
+const (
+	EnvEndpoint           = "SMC_ENDPOINT"
+	EnvAPIVersion         = "SMC_API_VERSION"
+	EnvUsernameEnv        = "SMC_USERNAME_ENV"
+	EnvPasswordEnv        = "SMC_PASSWORD_ENV"
+	EnvTokenEnv           = "SMC_TOKEN_ENV"
+	EnvMaxRetries         = "SMC_MAX_RETRIES"
+	EnvRetryBackoffMillis = "SMC_RETRY_BACKOFF_MS"
 )
 
 type Config struct {
@@ -16,6 +48,73 @@ type Config struct {
 	UsernameEnv string `json:"username_env"`
 	PasswordEnv string `json:"password_env"`
 	TokenEnv    string `json:"token_env"`
+
+	// MaxRetries is the number of times a failed API request is retried, 0 disables retries
+	MaxRetries         int `json:"max_retries"`
+	RetryBackoffMillis int `json:"retry_backoff_ms"`
+
+	// PingTimeoutSeconds and FetchTimeoutSeconds limit single ping and user/device requests,
+	// 0 leaves them to the overall HTTP client timeout
+	PingTimeoutSeconds  int `json:"ping_timeout_seconds,omitempty"`
+	FetchTimeoutSeconds int `json:"fetch_timeout_seconds,omitempty"`
+
+	// RequestsPerSecond paces API requests with bursts of up to RequestsBurst requests,
+	// 0 disables rate limiting
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+	RequestsBurst     int     `json:"requests_burst,omitempty"`
+
+	// TraceConnections counts whether API requests reuse pooled connections,
+	// which helps to debug keep-alive issues; it adds overhead to every request
+	TraceConnections bool `json:"trace_connections,omitempty"`
+
+	// ExtraLabels are constant labels attached to every device and sensor metric,
+	// e.g. {"tenant": "acme"} to tell apart exporters of different accounts
+	ExtraLabels map[string]string `json:"extra_labels,omitempty"`
+
+	// SensorLabels renames the labels of the sensor value metrics, keyed by the default label:
+	// id, sensor, name or device; an empty name drops the label, e.g. {"device": "device_uuid", "id": ""}
+	SensorLabels map[string]string `json:"sensor_labels,omitempty"`
+
+	// IncludeSensors and ExcludeSensors filter exported sensors by name or glob pattern,
+	// empty lists export all sensors
+	IncludeSensors []string `json:"include_sensors,omitempty"`
+	ExcludeSensors []string `json:"exclude_sensors,omitempty"`
+
+	// StatsWindowSeconds enables min/max/avg sensor gauges aggregated over the window, 0 disables them
+	StatsWindowSeconds int `json:"stats_window_seconds,omitempty"`
+
+	// IncludeUnitLabel adds the sensor unit as unit label to the sensor value gauges.
+	// It is opt-in as changing the label set of existing series breaks queries and
+	// dashboards matching on the exact labels; the unit is also on sensor_info.
+	IncludeUnitLabel bool `json:"include_unit_label,omitempty"`
+
+	// SmoothingAlpha in (0, 1] smooths sensor values with an exponential moving average,
+	// 0 disables smoothing
+	SmoothingAlpha float64 `json:"smoothing_alpha,omitempty"`
+
+	// OwnerFilter exports only own devices (self), devices owned by others (shared) or both (all)
+	OwnerFilter string `json:"owner_filter,omitempty"`
+
+	// IncludeMACAddress adds the device MAC address as mac_address label to device_info;
+	// it is off by default as MAC addresses identify the hardware of a person
+	IncludeMACAddress bool `json:"include_mac_address,omitempty"`
+
+	// StateValues maps device state strings to gauge values, e.g. {"never_published": 0},
+	// entries override or extend DefaultStateValues
+	StateValues map[string]float64 `json:"state_values,omitempty"`
+
+	// PublicMode monitors the world-readable devices listed in PublicDeviceIDs
+	// without authentication, so no credentials are required
+	PublicMode      bool  `json:"public_mode,omitempty"`
+	PublicDeviceIDs []int `json:"public_device_ids,omitempty"`
+
+	// RequireDevices makes the exporter unready while the latest update found no devices,
+	// e.g. when the credentials point at an empty account; with pull mode the updates only
+	// run on scrapes, so readiness shouldn't gate the scrapes
+	RequireDevices bool `json:"require_devices,omitempty"`
+
+	// AQI emits an air quality index per device computed from its pollutant sensors, nil disables it
+	AQI *AQIConfig `json:"aqi,omitempty"`
 }
 
 func (c *Config) ApplyDefaults() {
@@ -38,4 +137,125 @@ func (c *Config) ApplyDefaults() {
 	if c.TokenEnv == "" {
 		c.TokenEnv = DefaultTokenEnv
 	}
+
+	if c.RetryBackoffMillis <= 0 {
+		c.RetryBackoffMillis = DefaultRetryBackoffMillis
+	}
+
+	if c.OwnerFilter == "" {
+		c.OwnerFilter = OwnerFilterAll
+	}
+
+	stateValues := maps.Clone(DefaultStateValues)
+	maps.Copy(stateValues, c.StateValues)
+	c.StateValues = stateValues
+}
+
+// ApplyEnv overrides config values with the environment variables that are set
+func (c *Config) ApplyEnv() error {
+	envconfig.String(EnvEndpoint, &c.Endpoint)
+	envconfig.String(EnvAPIVersion, &c.APIVersion)
+	envconfig.String(EnvUsernameEnv, &c.UsernameEnv)
+	envconfig.String(EnvPasswordEnv, &c.PasswordEnv)
+	envconfig.String(EnvTokenEnv, &c.TokenEnv)
+
+	return errors.Join(
+		envconfig.Int(EnvMaxRetries, &c.MaxRetries),
+		envconfig.Int(EnvRetryBackoffMillis, &c.RetryBackoffMillis),
+	)
+}
+
+func (c *Config) StatsWindowDuration() time.Duration {
+	return time.Duration(c.StatsWindowSeconds) * time.Second
+}
+
+func (c *Config) RetryBackoffDuration() time.Duration {
+	return time.Duration(c.RetryBackoffMillis) * time.Millisecond
+}
+
+func (c *Config) PingTimeoutDuration() time.Duration {
+	return time.Duration(c.PingTimeoutSeconds) * time.Second
+}
+
+func (c *Config) FetchTimeoutDuration() time.Duration {
+	return time.Duration(c.FetchTimeoutSeconds) * time.Second
+}
+
+// Validate reports all configuration problems at once, it doesn't make any network calls
+func (c *Config) Validate() error {
+	return errors.Join(c.ValidateSettings(), c.ValidateCredentials())
+}
+
+// ValidateCredentials checks that the environment variables of the login are set, public mode needs none
+func (c *Config) ValidateCredentials() error {
+	if c.PublicMode {
+		return nil
+	}
+
+	var errs []error
+	if os.Getenv(c.UsernameEnv) == "" {
+		errs = append(errs, fmt.Errorf("environment variable %s must be set", c.UsernameEnv))
+	}
+
+	if os.Getenv(c.PasswordEnv) == "" && os.Getenv(c.TokenEnv) == "" {
+		errs = append(errs, fmt.Errorf("either environment variable %s or %s must be set", c.PasswordEnv, c.TokenEnv))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateSettings checks the configuration without the credentials, the exporter runs it on
+// every start and leaves missing credentials to the login
+func (c *Config) ValidateSettings() error {
+	var errs []error
+
+	if _, err := url.ParseRequestURI(c.Endpoint); err != nil {
+		errs = append(errs, fmt.Errorf("invalid SmartCitizen endpoint %q: %w", c.Endpoint, err))
+	}
+
+	if c.PublicMode && len(c.PublicDeviceIDs) == 0 {
+		errs = append(errs, fmt.Errorf("public_device_ids must not be empty in public mode"))
+	}
+
+	if c.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("max_retries must not be negative, got %d", c.MaxRetries))
+	}
+
+	if c.PingTimeoutSeconds < 0 || c.FetchTimeoutSeconds < 0 {
+		errs = append(errs, fmt.Errorf("ping_timeout_seconds and fetch_timeout_seconds must not be negative"))
+	}
+
+	if c.RequestsPerSecond < 0 || c.RequestsBurst < 0 {
+		errs = append(errs, fmt.Errorf("requests_per_second and requests_burst must not be negative"))
+	}
+
+	if c.SmoothingAlpha < 0 || c.SmoothingAlpha > 1 {
+		errs = append(errs, fmt.Errorf("smoothing_alpha must be between 0 and 1, got %v", c.SmoothingAlpha))
+	}
+
+	switch c.OwnerFilter {
+	case OwnerFilterAll, OwnerFilterSelf, OwnerFilterShared:
+	default:
+		errs = append(errs, fmt.Errorf("invalid owner_filter %q, expected one of: all, self, shared", c.OwnerFilter))
+	}
+
+	if err := ValidateLabelNames(c.ExtraLabels); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := ValidateSensorLabels(c.SensorLabels, c.ExtraLabels); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := ValidateSensorPatterns(slices.Concat(c.IncludeSensors, c.ExcludeSensors)); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.AQI != nil {
+		if err := c.AQI.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
 }
@@ -2,8 +2,11 @@ package smartcitizen
 
 import (
 	"fmt"
+	"maps"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/timgluz/smcprober/metric"
@@ -19,12 +22,32 @@ const (
 )
 
 type DeviceInfoConverter struct {
-	metricName string
+	extraLabels
+	naming
+
+	metricName        string
+	includeOwner      bool
+	includeMACAddress bool
 }
 
+// NewDeviceInfoConverter emits the device info gauge, the metric name is handed to the
+// NameStrategy, e.g. "info" becomes device_info with DefaultNameStrategy
 func NewDeviceInfoConverter(metricName string) *DeviceInfoConverter {
+	return &DeviceInfoConverter{metricName: metricName}
+}
+
+// SetIncludeOwner adds the owner_username label, useful when exporting shared devices
+func (c *DeviceInfoConverter) SetIncludeOwner(include bool) {
+	c.includeOwner = include
+}
+
+// SetIncludeMACAddress adds the mac_address label, devices without a known MAC get an empty value
+func (c *DeviceInfoConverter) SetIncludeMACAddress(include bool) {
+	c.includeMACAddress = include
+}
 
-	return &DeviceInfoConverter{metricName}
+func (c *DeviceInfoConverter) Name() string {
+	return "device_info"
 }
 
 func (c *DeviceInfoConverter) Match(name string) bool {
@@ -37,28 +60,64 @@ func (c *DeviceInfoConverter) Convert(registry metric.Registry, data any) error
 		return fmt.Errorf("%w: Invalid data type %v", ErrInvalidDataType, reflect.TypeOf(data))
 	}
 
-	labels := prometheus.Labels{
+	labels := c.withExtraLabels(prometheus.Labels{
 		"uuid":        device.UUID,
 		"name":        device.Name,
 		"description": device.Description,
+		"kit_id":      kitIDLabel(device.KitID),
+	})
+
+	labelNames := []string{"uuid", "name", "description", "kit_id"}
+	if c.includeOwner {
+		labels["owner_username"] = device.Owner.Username
+		labelNames = append(labelNames, "owner_username")
+	}
+
+	if c.includeMACAddress {
+		labels["mac_address"] = strings.ToLower(device.MACAddress)
+		labelNames = append(labelNames, "mac_address")
 	}
 
 	gauge := registry.GetOrCreateGaugeVec(
-		c.metricName,
+		c.deviceMetric(c.metricName),
 		"Static information about Smart Citizen devices",
-		[]string{"uuid", "name", "description"},
+		c.labelNames(labelNames...),
 	)
 
-	gauge.With(labels).Set(1)
-	return nil
+	return metric.SetGauge(gauge, labels, 1)
+}
+
+// kitIDLabel leaves the label empty for devices without a known kit
+func kitIDLabel(kitID int) string {
+	if kitID == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(kitID)
 }
 
 type DeviceStateConverter struct {
-	metricName string
+	extraLabels
+	naming
+
+	metricName  string
+	stateValues map[string]float64
 }
 
+// NewDeviceStateConverter emits <metricName>_has_published, e.g. device_state_has_published for "state"
 func NewDeviceStateConverter(metricName string) *DeviceStateConverter {
-	return &DeviceStateConverter{metricName}
+	return &DeviceStateConverter{metricName: metricName, stateValues: DefaultStateValues}
+}
+
+// SetStateValues overrides the mapping of state strings to gauge values
+func (c *DeviceStateConverter) SetStateValues(values map[string]float64) {
+	if len(values) > 0 {
+		c.stateValues = values
+	}
+}
+
+func (c *DeviceStateConverter) Name() string {
+	return "device_state"
 }
 
 func (c *DeviceStateConverter) Match(name string) bool {
@@ -72,25 +131,116 @@ func (c *DeviceStateConverter) Convert(registry metric.Registry, data any) error
 	}
 
 	gauge := registry.GetOrCreateGaugeVec(
-		c.metricName+"_has_published",
+		c.deviceMetric(c.metricName+"_has_published"),
 		"Indicates whether the device has published data (1) or not (0)",
-		[]string{"device", "name"},
+		c.labelNames("device", "name"),
 	)
 
-	labels := prometheus.Labels{
+	labels := c.withExtraLabels(prometheus.Labels{
 		"device": device.UUID,
 		"name":   device.Name,
+	})
+
+	value, ok := device.LookupStateValue(c.stateValues)
+	if !ok {
+		// surface states introduced by the API, so the mapping could be extended
+		unknownCounter := registry.GetOrCreateCounterVec(
+			c.deviceMetric(c.metricName+"_unknown_total"),
+			"Total devices reported with a state missing from the state mapping",
+			[]string{"state"},
+		)
+		unknownCounter.WithLabelValues(device.State).Inc()
+	}
+
+	return metric.SetGauge(gauge, labels, value)
+}
+
+type DeviceLocationConverter struct {
+	extraLabels
+	naming
+
+	metricName string
+}
+
+// NewDeviceLocationConverter emits the location info and device_elevation_meters gauges,
+// e.g. device_location for "location"
+func NewDeviceLocationConverter(metricName string) *DeviceLocationConverter {
+	return &DeviceLocationConverter{metricName: metricName}
+}
+
+func (c *DeviceLocationConverter) Name() string {
+	return "device_location"
+}
+
+func (c *DeviceLocationConverter) Match(name string) bool {
+	return name == DeviceDetailType
+}
+
+func (c *DeviceLocationConverter) Convert(registry metric.Registry, data any) error {
+	device, ok := data.(DeviceDetail)
+	if !ok {
+		return ErrInvalidDataType
+	}
+
+	location := device.Data.Location
+	// unlocated devices would otherwise show up at (0,0)
+	if location.Latitude == 0 && location.Longitude == 0 {
+		return nil
+	}
+
+	locationGauge := registry.GetOrCreateGaugeVec(
+		c.deviceMetric(c.metricName),
+		"Location of Smart Citizen devices",
+		c.labelNames("uuid", "city", "country", "exposure"),
+	)
+
+	err := metric.SetGauge(locationGauge, c.withExtraLabels(prometheus.Labels{
+		"uuid":     device.UUID,
+		"city":     location.City,
+		"country":  location.Country,
+		"exposure": location.Exposure,
+	}), 1)
+	if err != nil {
+		return err
 	}
 
-	gauge.With(labels).Set(device.StateValue())
-	return nil
+	elevationGauge := registry.GetOrCreateGaugeVec(
+		c.deviceMetric("elevation_meters"),
+		"Elevation of Smart Citizen devices in meters",
+		c.labelNames("uuid"),
+	)
+
+	return metric.SetGauge(elevationGauge, c.withExtraLabels(prometheus.Labels{
+		"uuid": device.UUID,
+	}), location.Elevation)
 }
 
 type DeviceSensorConverter struct {
+	extraLabels
+	naming
+
 	metricName    string
 	sensorMapping *metric.SensorMetricMapping
+
+	// includeUnit adds the unit label to the value gauges
+	includeUnit bool
+
+	// labelRenames renames or, with an empty name, drops the default sensor labels
+	labelRenames map[string]string
+
+	// smoothingAlpha enables exponential moving average of sensor values, 0 disables it
+	smoothingAlpha float64
+	mu             sync.Mutex
+	smoothed       map[string]float64
+
+	// gauges caches the collectors of the registry, Convert runs for every sensor on every cycle
+	gaugesMu       sync.RWMutex
+	gauges         map[string]*prometheus.GaugeVec
+	gaugesRegistry metric.Registry
 }
 
+// NewDeviceSensorConverter emits the value gauges of mapped sensors and <metricName> for the others,
+// e.g. sensor_state for "state"
 func NewDeviceSensorConverter(metricName string, sensorMapping *metric.SensorMetricMapping) *DeviceSensorConverter {
 	return &DeviceSensorConverter{
 		metricName:    metricName,
@@ -98,9 +248,81 @@ func NewDeviceSensorConverter(metricName string, sensorMapping *metric.SensorMet
 	}
 }
 
+// SetIncludeUnit adds the unit label to the value gauges, so dashboards can pick the axis unit
+// from the series itself; the unit of a sensor doesn't change, so it adds no extra series
+func (c *DeviceSensorConverter) SetIncludeUnit(include bool) {
+	c.includeUnit = include
+}
+
+// SetSmoothingAlpha enables exponential moving average smoothing of the emitted values,
+// higher alpha follows new readings faster; the raw values are emitted as <metric>_raw
+func (c *DeviceSensorConverter) SetSmoothingAlpha(alpha float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.smoothingAlpha = alpha
+	c.smoothed = make(map[string]float64)
+}
+
+// SetSensorLabels renames the default sensor labels of the value gauges, e.g. device to device_uuid,
+// an empty name drops the label, e.g. the high-cardinality id; see ValidateSensorLabels
+func (c *DeviceSensorConverter) SetSensorLabels(renames map[string]string) {
+	c.labelRenames = maps.Clone(renames)
+}
+
+func (c *DeviceSensorConverter) Name() string {
+	return "sensor"
+}
+
 func (c *DeviceSensorConverter) Match(name string) bool {
 	return name == DeviceSensorType
 }
+
+// gaugeVec returns the cached gauge, creating it in the registry on first use
+func (c *DeviceSensorConverter) gaugeVec(registry metric.Registry, name, help string) *prometheus.GaugeVec {
+	c.gaugesMu.RLock()
+	gauge, ok := c.gauges[name]
+	cached := ok && c.gaugesRegistry == registry
+	c.gaugesMu.RUnlock()
+	if cached {
+		return gauge
+	}
+
+	c.gaugesMu.Lock()
+	defer c.gaugesMu.Unlock()
+
+	// drop collectors of another registry
+	if c.gauges == nil || c.gaugesRegistry != registry {
+		c.gauges = make(map[string]*prometheus.GaugeVec)
+		c.gaugesRegistry = registry
+	}
+
+	labelNames := sensorLabelNames(c.labelRenames)
+	if c.includeUnit {
+		labelNames = append(labelNames, "unit")
+	}
+
+	gauge = registry.GetOrCreateGaugeVec(name, help, c.labelNames(labelNames...))
+	c.gauges[name] = gauge
+	return gauge
+}
+
+// smooth returns the moving average of the sensor including the new value
+func (c *DeviceSensorConverter) smooth(sensor DeviceSensor) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// sensor UUIDs identify the sensor model, so key by device too
+	key := sensor.DeviceUUID + "/" + sensor.UUID
+	value := sensor.Value
+	if previous, ok := c.smoothed[key]; ok {
+		value = c.smoothingAlpha*sensor.Value + (1-c.smoothingAlpha)*previous
+	}
+	c.smoothed[key] = value
+
+	return value
+}
+
 func (c *DeviceSensorConverter) Convert(registry metric.Registry, data any) error {
 	sensor, ok := data.(DeviceSensor)
 	if !ok {
@@ -108,37 +330,80 @@ func (c *DeviceSensorConverter) Convert(registry metric.Registry, data any) erro
 	}
 
 	// Default to the generic state metric name
-	metricName := c.metricName + "_state"
+	metricName := c.sensorMetric("", c.metricName)
+	rawMetricName := c.sensorMetric("", c.metricName+"_raw")
+	help := "Current sensor value"
 	sensorMetric, exists := c.sensorMapping.Get(sensor.Name)
 
 	// Use the mapped metric name only if the mapping exists and has a non-empty Metric field
 	if exists && sensorMetric.Metric != "" {
-		metricName = c.metricName + "_" + sensorMetric.MetricName()
+		metricName = c.sensorMetric(sensorMetric.Category, sensorMetric.Metric)
+		rawMetricName = c.sensorMetric(sensorMetric.Category, sensorMetric.Metric+"_raw")
+		help = sensorMetric.HelpText()
 	}
 
-	gauge := registry.GetOrCreateGaugeVec(
-		metricName,
-		"Current sensor value",
-		[]string{"id", "sensor", "name", "device"},
-	)
+	// unmapped sensors get the zero item, which only rejects NaN and infinite values
+	value, err := sensorMetric.CheckValue(sensor.Value)
+	if err != nil {
+		return fmt.Errorf("sensor %q of device %s: %w", sensor.Name, sensor.DeviceUUID, err)
+	}
+	sensor.Value = sensorMetric.ConvertValue(value)
+	sensor.Unit = sensorMetric.UnitLabel(sensor.Unit)
 
-	labels := prometheus.Labels{
-		"id":     strconv.Itoa(sensor.ID),
-		"sensor": sensor.UUID,
-		"name":   sensor.Name,
-		"device": sensor.DeviceUUID,
+	gauge := c.gaugeVec(registry, metricName, help)
+
+	labels := c.withExtraLabels(sensorLabels(c.labelRenames, sensor))
+	if c.includeUnit {
+		labels["unit"] = sensor.Unit
+	}
+
+	// The reading time is exported as a companion gauge instead of the sample timestamp:
+	// Prometheus drops samples with timestamps outside its ingestion window and marks
+	// series stale unexpectedly, while a gauge lets users compute the reading age with
+	// time() - sensor_reading_timestamp_seconds.
+	if readingAt := sensor.ToUnix(); readingAt > 0 {
+		timestampGauge := c.gaugeVec(registry,
+			c.sensorMetric("", "reading_timestamp_seconds"),
+			"Unix timestamp of the latest sensor reading",
+		)
+		if err := metric.SetGauge(timestampGauge, labels, float64(readingAt)); err != nil {
+			return err
+		}
 	}
 
-	gauge.With(labels).Set(sensor.Value)
-	return nil
+	if c.smoothingAlpha <= 0 {
+		return metric.SetGauge(gauge, labels, sensor.Value)
+	}
+
+	rawGauge := c.gaugeVec(registry, rawMetricName, "Current sensor value without smoothing")
+
+	if err := metric.SetGauge(rawGauge, labels, sensor.Value); err != nil {
+		return err
+	}
+	return metric.SetGauge(gauge, labels, c.smooth(sensor))
 }
 
 type DeviceSensorInfoConverter struct {
-	metricName string
+	extraLabels
+	naming
+
+	metricName    string
+	sensorMapping *metric.SensorMetricMapping
 }
 
+// NewDeviceSensorInfoConverter emits the sensor info gauge, e.g. sensor_info for "info"
 func NewDeviceSensorInfoConverter(metricName string) *DeviceSensorInfoConverter {
-	return &DeviceSensorInfoConverter{metricName}
+	return &DeviceSensorInfoConverter{metricName: metricName}
+}
+
+// SetSensorMapping reports the unit of the converted values, like the unit label of the value gauges;
+// without a mapping the unit reported by the API is kept
+func (c *DeviceSensorInfoConverter) SetSensorMapping(sensorMapping *metric.SensorMetricMapping) {
+	c.sensorMapping = sensorMapping
+}
+
+func (c *DeviceSensorInfoConverter) Name() string {
+	return "sensor_info"
 }
 
 func (c *DeviceSensorInfoConverter) Match(name string) bool {
@@ -151,20 +416,25 @@ func (c *DeviceSensorInfoConverter) Convert(registry metric.Registry, data any)
 		return ErrInvalidDataType
 	}
 
-	labels := prometheus.Labels{
+	unit := sensor.Unit
+	if c.sensorMapping != nil {
+		sensorMetric, _ := c.sensorMapping.Get(sensor.Name)
+		unit = sensorMetric.UnitLabel(sensor.Unit)
+	}
+
+	labels := c.withExtraLabels(prometheus.Labels{
 		"id":          strconv.Itoa(sensor.ID),
 		"sensor":      sensor.UUID,
 		"name":        sensor.Name,
-		"unit":        sensor.Unit,
+		"unit":        unit,
 		"description": sensor.Description,
-	}
+	})
 
 	gauge := registry.GetOrCreateGaugeVec(
-		c.metricName,
+		c.sensorMetric("", c.metricName),
 		"Static information about Smart Citizen device sensors",
-		[]string{"id", "sensor", "name", "unit", "description"},
+		c.labelNames("id", "sensor", "name", "unit", "description"),
 	)
 
-	gauge.With(labels).Set(1)
-	return nil
+	return metric.SetGauge(gauge, labels, 1)
 }
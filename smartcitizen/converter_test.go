@@ -0,0 +1,196 @@
+package smartcitizen
+
+import (
+	"log/slog"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timgluz/smcprober/metric"
+)
+
+func newTestRegistry() *metric.NamespacedRegistry {
+	return metric.NewNamespacedRegistryWithRegisterer("test", nil, slog.New(slog.DiscardHandler))
+}
+
+func TestDeviceSensorConverterCachesGaugesPerRegistry(t *testing.T) {
+	converter := NewDeviceSensorConverter("state", metric.NewSensorMetricMapping())
+	first := newTestRegistry()
+
+	gauge := converter.gaugeVec(first, "sensor_value", "Current sensor value")
+	if registered, _ := first.GetCollectorByName("sensor_value"); registered != gauge {
+		t.Fatal("expected the cached gauge to be the registered one")
+	}
+
+	if converter.gaugeVec(first, "sensor_value", "Current sensor value") != gauge {
+		t.Error("expected the gauge to be cached")
+	}
+
+	// e.g. after a reload the converter writes to a new registry
+	second := newTestRegistry()
+	other := converter.gaugeVec(second, "sensor_value", "Current sensor value")
+	if other == gauge {
+		t.Error("expected a gauge of the new registry")
+	}
+
+	if registered, _ := second.GetCollectorByName("sensor_value"); registered != other {
+		t.Error("expected the gauge to be registered in the new registry")
+	}
+}
+
+func TestDeviceSensorConverterConvertsUnits(t *testing.T) {
+	sensorMapping := metric.NewSensorMetricMapping()
+	sensorMapping.Add("Temperature", metric.MetricMappingItem{Category: "environment", Metric: "temperature_fahrenheit",
+		Scale: 1.8, Offset: 32, Unit: "°F"})
+	sensorMapping.Add("Barometric Pressure", metric.MetricMappingItem{Category: "environment", Metric: "pressure_hpa",
+		Scale: 0.01, Unit: "hPa"})
+
+	converter := NewDeviceSensorConverter("state", sensorMapping)
+	converter.SetIncludeUnit(true)
+	infoConverter := NewDeviceSensorInfoConverter("info")
+	infoConverter.SetSensorMapping(sensorMapping)
+	registry := newTestRegistry()
+
+	tests := []struct {
+		sensor     DeviceSensor
+		metricName string
+		wantUnit   string
+		want       float64
+	}{
+		{
+			sensor:     DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-1", Unit: "ºC", Value: 21.5},
+			metricName: "sensor_environment_temperature_fahrenheit",
+			wantUnit:   "°F",
+			want:       70.7,
+		},
+		{
+			sensor:     DeviceSensor{ID: 58, UUID: "sensor-2", Name: "Barometric Pressure", DeviceUUID: "device-1", Unit: "Pa", Value: 101325},
+			metricName: "sensor_environment_pressure_hpa",
+			wantUnit:   "hPa",
+			want:       1013.25,
+		},
+	}
+
+	for _, tt := range tests {
+		if err := converter.Convert(registry, tt.sensor); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.sensor.Name, err)
+		}
+
+		labels := sensorLabels(nil, tt.sensor)
+		labels["unit"] = tt.wantUnit
+		if got := gaugeValue(t, registry, tt.metricName, labels); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: expected %v %s, got %v", tt.sensor.Name, tt.want, tt.wantUnit, got)
+		}
+
+		// sensor_info reports the unit of the converted value too
+		if err := infoConverter.Convert(registry, tt.sensor); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.sensor.Name, err)
+		}
+
+		infoLabels := prometheus.Labels{"id": strconv.Itoa(tt.sensor.ID), "sensor": tt.sensor.UUID, "name": tt.sensor.Name,
+			"unit": tt.wantUnit, "description": ""}
+		if got := gaugeValue(t, registry, "sensor_info", infoLabels); got != 1 {
+			t.Errorf("%s: expected sensor_info with the unit %s, got %v", tt.sensor.Name, tt.wantUnit, got)
+		}
+	}
+}
+
+func TestDeviceSensorConverterSmoothing(t *testing.T) {
+	converter := NewDeviceSensorConverter("state", metric.NewSensorMetricMapping())
+	converter.SetSmoothingAlpha(0.5)
+	registry := newTestRegistry()
+
+	sensor := DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-1", Value: 10}
+	labels := sensorLabels(nil, sensor)
+
+	// the first value seeds the average, then every value moves it halfway
+	steps := []struct {
+		value    float64
+		smoothed float64
+	}{
+		{value: 10, smoothed: 10},
+		{value: 20, smoothed: 15},
+		{value: 30, smoothed: 22.5},
+		{value: 22.5, smoothed: 22.5},
+	}
+
+	for _, step := range steps {
+		sensor.Value = step.value
+		if err := converter.Convert(registry, sensor); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := gaugeValue(t, registry, "sensor_state", labels); math.Abs(got-step.smoothed) > 1e-9 {
+			t.Errorf("value %v: expected the smoothed value %v, got %v", step.value, step.smoothed, got)
+		}
+
+		if got := gaugeValue(t, registry, "sensor_state_raw", labels); got != step.value {
+			t.Errorf("value %v: expected the raw value, got %v", step.value, got)
+		}
+	}
+
+	// the same sensor model of another device starts its own average
+	other := DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-2", Value: 0}
+	if err := converter.Convert(registry, other); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := gaugeValue(t, registry, "sensor_state", sensorLabels(nil, other)); got != 0 {
+		t.Errorf("expected device-2 to be seeded with its own value, got %v", got)
+	}
+}
+
+func TestDeviceSensorConverterWithoutSmoothing(t *testing.T) {
+	converter := NewDeviceSensorConverter("state", metric.NewSensorMetricMapping())
+	registry := newTestRegistry()
+
+	for _, value := range []float64{10, 20} {
+		sensor := DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-1", Value: value}
+		if err := converter.Convert(registry, sensor); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := gaugeValue(t, registry, "sensor_state", sensorLabels(nil, sensor)); got != value {
+			t.Errorf("expected the value %v as is, got %v", value, got)
+		}
+	}
+
+	if _, exists := registry.GetCollectorByName("sensor_state_raw"); exists {
+		t.Error("expected no raw gauge without smoothing")
+	}
+}
+
+// BenchmarkDeviceSensorConverterGaugeVec compares the cached gauge with the registry lookup it replaces
+func BenchmarkDeviceSensorConverterGaugeVec(b *testing.B) {
+	registry := newTestRegistry()
+	converter := NewDeviceSensorConverter("state", metric.NewSensorMetricMapping())
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			_ = converter.gaugeVec(registry, "sensor_value", "Current sensor value")
+		}
+	})
+
+	b.Run("registry", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			_ = registry.GetOrCreateGaugeVec("sensor_value", "Current sensor value",
+				converter.labelNames(sensorLabelNames(converter.labelRenames)...))
+		}
+	})
+}
+
+func BenchmarkDeviceSensorConverterConvert(b *testing.B) {
+	registry := newTestRegistry()
+	converter := NewDeviceSensorConverter("state", metric.NewSensorMetricMapping())
+	sensor := DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-1", Unit: "ºC", Value: 21.5}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := converter.Convert(registry, sensor); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
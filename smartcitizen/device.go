@@ -1,7 +1,15 @@
 package smartcitizen
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
+// Device states are exported as numeric gauge values so they can be graphed and
+// alerted on. Online and offline map to 1 and 0, sleeping devices sit in between
+// at 0.5 as they are expected to publish again, and any state we do not recognise
+// is reported as -1 so it never gets mistaken for a healthy or offline device.
 const (
 	DeviceStateOnline   = 1.0
 	DeviceStateOffline  = 0.0
@@ -9,6 +17,18 @@ const (
 	DeviceStateUnknown  = -1.0
 )
 
+var (
+	ErrInvalidDeviceDetail = fmt.Errorf("invalid device detail")
+)
+
+// DefaultStateValues maps the state strings reported by the API to gauge values
+var DefaultStateValues = map[string]float64{
+	"online":        DeviceStateOnline,
+	"has_published": DeviceStateOnline,
+	"offline":       DeviceStateOffline,
+	"sleeping":      DeviceStateSleeping,
+}
+
 type UserDevice struct {
 	ID          int    `json:"id"`
 	UUID        string `json:"uuid"`
@@ -32,6 +52,12 @@ type DeviceDetail struct {
 	SystemTags  []string `json:"system_tags"`
 	UserTags    []string `json:"user_tags"`
 
+	// KitID identifies the hardware kit model, it is joined from the user device list
+	// when the detail response doesn't include it
+	KitID int `json:"kit_id,omitempty"`
+	// MACAddress is joined from the user device list, the API only shows it to the owner
+	MACAddress string `json:"mac_address,omitempty"`
+
 	Owner User       `json:"owner"`
 	Data  DeviceData `json:"data"`
 
@@ -40,6 +66,24 @@ type DeviceDetail struct {
 	LastReadingAt string `json:"last_reading_at"`
 }
 
+// Validate checks that the device detail carries the identifiers required to
+// label its metrics; the API may respond with an empty object for missing devices.
+func (d *DeviceDetail) Validate() error {
+	if d.ID == 0 {
+		return fmt.Errorf("%w: missing device id", ErrInvalidDeviceDetail)
+	}
+
+	if d.UUID == "" {
+		return fmt.Errorf("%w: missing uuid for device %d", ErrInvalidDeviceDetail, d.ID)
+	}
+
+	return nil
+}
+
+func (d DeviceDetail) TypeName() string {
+	return DeviceDetailType
+}
+
 func (d *DeviceDetail) GetSensorByName(name string) (*DeviceSensor, bool) {
 	if d.Data.Sensors == nil {
 		return nil, false
@@ -55,16 +99,19 @@ func (d *DeviceDetail) GetSensorByName(name string) (*DeviceSensor, bool) {
 }
 
 func (d *DeviceDetail) StateValue() float64 {
-	switch d.State {
-	case "online", "has_published":
-		return DeviceStateOnline
-	case "offline":
-		return DeviceStateOffline
-	case "sleeping":
-		return DeviceStateSleeping
-	default:
-		return DeviceStateUnknown
+	value, _ := d.LookupStateValue(DefaultStateValues)
+	return value
+}
+
+// LookupStateValue maps the device state with the given values,
+// unknown states fall back to DeviceStateUnknown and report false
+func (d *DeviceDetail) LookupStateValue(values map[string]float64) (float64, bool) {
+	value, ok := values[d.State]
+	if !ok {
+		return DeviceStateUnknown, false
 	}
+
+	return value, true
 }
 
 type DeviceData struct {
@@ -103,15 +150,41 @@ type DeviceSensor struct {
 	UpdatedAt string `json:"updated_at"`
 }
 
+func (s DeviceSensor) TypeName() string {
+	return DeviceSensorType
+}
+
 func (s *DeviceSensor) ToUnix() int64 {
 	return ParseTimeToUnix(s.UpdatedAt)
 }
 
 func ParseTimeToUnix(timestr string) int64 {
-	t, err := time.Parse(time.RFC3339, timestr)
+	t, err := ParseTime(timestr)
 	if err != nil {
 		return 0
 	}
 
 	return t.Unix()
 }
+
+// timeLayouts are the timestamp formats seen in API responses, tried in order
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+}
+
+// ParseTime parses API timestamps, timestamps without a zone are taken as UTC
+func ParseTime(timestr string) (time.Time, error) {
+	var errs []error
+	for _, layout := range timeLayouts {
+		t, err := time.Parse(layout, timestr)
+		if err == nil {
+			return t, nil
+		}
+		errs = append(errs, err)
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported time format %q: %w", timestr, errors.Join(errs...))
+}
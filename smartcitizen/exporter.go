@@ -0,0 +1,127 @@
+package smartcitizen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/timgluz/smcprober/httpclient"
+	"github.com/timgluz/smcprober/metric"
+)
+
+const DefaultNamespace = "smartcitizen"
+
+// ExporterConfig is everything NewExporterFromConfig needs to run an exporter,
+// it uses the same keys as the smcexporter config file
+type ExporterConfig struct {
+	Namespace     string                              `json:"namespace"`
+	Smc           Config                              `json:"smartcitizen"`
+	SensorMapping map[string]metric.MetricMappingItem `json:"sensor_mapping"`
+}
+
+func (c *ExporterConfig) ApplyDefaults() {
+	if c.Namespace == "" {
+		c.Namespace = DefaultNamespace
+	}
+
+	c.Smc.ApplyDefaults()
+}
+
+func (c *ExporterConfig) Validate() error {
+	errs := []error{c.Smc.Validate()}
+	for sensorName, item := range c.SensorMapping {
+		if err := item.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sensor %q: %w", sensorName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewSensorMetricMapping validates the configured mapping items and collects them in a mapping
+func NewSensorMetricMapping(items map[string]metric.MetricMappingItem) (*metric.SensorMetricMapping, error) {
+	var errs []error
+	sensorMapping := metric.NewSensorMetricMapping()
+	for sensorName, item := range items {
+		if err := item.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sensor %q: %w", sensorName, err))
+			continue
+		}
+
+		sensorMapping.Add(sensorName, item)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return sensorMapping, nil
+}
+
+// NewCredentialProvider reads the credentials from the environment variables named in the config
+func NewCredentialProvider(config Config) UserCredentialProvider {
+	return NewUserCredentialEnvProvider(config.UsernameEnv, config.PasswordEnv, config.TokenEnv)
+}
+
+// NewAuthenticatedProvider creates a provider signed in with the credentials,
+// in public mode no credentials are needed and authentication is skipped
+func NewAuthenticatedProvider(ctx context.Context, config Config, credentials UserCredentialProvider,
+	registry metric.Registry, logger *slog.Logger,
+) (*HTTPProvider, error) {
+	provider := NewHTTPProvider(config, httpclient.NewDefaultHTTPClient(), registry, logger)
+	if config.PublicMode {
+		logger.Info("Public mode enabled, skipping authentication", "devices", config.PublicDeviceIDs)
+		return provider, nil
+	}
+
+	credential, err := credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve SmartCitizen credentials: %w", err)
+	}
+
+	if err := provider.Authenticate(ctx, credential); err != nil {
+		return nil, fmt.Errorf("failed to authenticate with SmartCitizen API: %w", err)
+	}
+
+	return provider, nil
+}
+
+// NewExporterFromConfig sets up an authenticated provider, a dedicated metric registry and
+// the converters of the sensor mapping; the returned handler serves the exporter metrics on /metrics.
+// The exporter doesn't update by itself, run it with exporter.Start(ctx, interval)
+func NewExporterFromConfig(ctx context.Context, config ExporterConfig, logger *slog.Logger) (*APIExporter, http.Handler, error) {
+	if logger == nil {
+		return nil, nil, fmt.Errorf("logger cannot be nil")
+	}
+
+	config.ApplyDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid exporter config: %w", err)
+	}
+
+	sensorMapping, err := NewSensorMetricMapping(config.SensorMapping)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a dedicated registry keeps embedding applications' default registry untouched
+	promRegistry := prometheus.NewRegistry()
+	registry := metric.NewNamespacedRegistryWithRegisterer(config.Namespace, promRegistry, logger)
+
+	credentials := NewCredentialProvider(config.Smc)
+	provider, err := NewAuthenticatedProvider(ctx, config.Smc, credentials, registry, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exporter := NewAPIExporterWithRegistry(config.Smc, provider, registry, sensorMapping, logger)
+	if !config.Smc.PublicMode {
+		exporter.SetCredentialProvider(credentials)
+	}
+
+	return exporter, promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{}), nil
+}
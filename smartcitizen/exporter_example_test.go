@@ -0,0 +1,65 @@
+package smartcitizen_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/timgluz/smcprober/metric"
+	"github.com/timgluz/smcprober/smartcitizen"
+)
+
+// ExampleNewExporterFromConfig embeds the exporter of a public device into an application's own server
+func ExampleNewExporterFromConfig() {
+	// stands in for the SmartCitizen API
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 42, "uuid": "0a1b2c3d", "name": "kitchen", "state": "has_published",
+			"data": {"sensors": [{"id": 55, "uuid": "sensor-1", "name": "Temperature", "unit": "ºC", "value": 21.5}]}}`))
+	}))
+	defer api.Close()
+
+	config := smartcitizen.ExporterConfig{
+		Namespace: "example",
+		Smc: smartcitizen.Config{
+			Endpoint:        api.URL,
+			PublicMode:      true,
+			PublicDeviceIDs: []int{42},
+		},
+		SensorMapping: map[string]metric.MetricMappingItem{
+			"Temperature": {Category: "environment", Metric: "temperature_celsius"},
+		},
+	}
+
+	ctx := context.Background()
+	exporter, handler, err := smartcitizen.NewExporterFromConfig(ctx, config, slog.New(slog.DiscardHandler))
+	if err != nil {
+		fmt.Println("failed to create the exporter:", err)
+		return
+	}
+
+	// applications usually run exporter.Start(ctx, interval) in the background instead
+	if err := exporter.TriggerUpdate(ctx); err != nil {
+		fmt.Println("failed to update the metrics:", err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "example_sensor_environment_temperature_celsius{") {
+			fmt.Println(scanner.Text())
+		}
+	}
+
+	// Output:
+	// example_sensor_environment_temperature_celsius{device="0a1b2c3d",id="55",name="Temperature",sensor="sensor-1"} 21.5
+}
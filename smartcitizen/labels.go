@@ -0,0 +1,138 @@
+package smartcitizen
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabelNames are already used by the converters and can't be overridden
+var reservedLabelNames = []string{"id", "uuid", "name", "description", "device", "sensor", "unit", "city", "country", "exposure", "owner_username", "kit_id", "mac_address"}
+
+// ValidateLabelNames checks that extra labels are valid Prometheus label names
+// and don't collide with the labels set by the converters
+func ValidateLabelNames(labels map[string]string) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(labels)) {
+		switch {
+		case !labelNamePattern.MatchString(name):
+			errs = append(errs, fmt.Errorf("invalid label name %q", name))
+		case strings.HasPrefix(name, "__"):
+			errs = append(errs, fmt.Errorf("label name %q is reserved for internal use", name))
+		case slices.Contains(reservedLabelNames, name):
+			errs = append(errs, fmt.Errorf("label name %q is already used by the exporter", name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DefaultSensorLabelNames are the labels of the sensor value gauges, in their declaration order
+var DefaultSensorLabelNames = []string{"id", "sensor", "name", "device"}
+
+// ValidateSensorLabels checks the renames of the sensor value labels: the keys must be default
+// sensor labels, an empty name drops the label, and the resulting labels must be valid, unique
+// and not collide with the extra labels; at least one label has to remain
+func ValidateSensorLabels(renames map[string]string, extra map[string]string) error {
+	var errs []error
+	for _, label := range slices.Sorted(maps.Keys(renames)) {
+		if !slices.Contains(DefaultSensorLabelNames, label) {
+			errs = append(errs, fmt.Errorf("unknown sensor label %q, expected one of: %s", label, strings.Join(DefaultSensorLabelNames, ", ")))
+		}
+	}
+
+	names := sensorLabelNames(renames)
+	if len(names) == 0 {
+		errs = append(errs, fmt.Errorf("sensor labels must not drop all labels"))
+	}
+
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		switch {
+		case !labelNamePattern.MatchString(name):
+			errs = append(errs, fmt.Errorf("invalid sensor label name %q", name))
+		case strings.HasPrefix(name, "__"):
+			errs = append(errs, fmt.Errorf("sensor label name %q is reserved for internal use", name))
+		case name == "unit":
+			errs = append(errs, fmt.Errorf("sensor label name %q is reserved for the unit label", name))
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("sensor label name %q is used twice", name))
+		case extra[name] != "":
+			errs = append(errs, fmt.Errorf("sensor label name %q collides with an extra label", name))
+		}
+		seen[name] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// sensorLabelNames applies the renames to the default sensor label names, dropping the emptied ones
+func sensorLabelNames(renames map[string]string) []string {
+	names := make([]string, 0, len(DefaultSensorLabelNames))
+	for _, label := range DefaultSensorLabelNames {
+		if name := sensorLabelName(renames, label); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// sensorLabels returns the labels of the sensor with the renames applied
+func sensorLabels(renames map[string]string, sensor DeviceSensor) prometheus.Labels {
+	values := map[string]string{
+		"id":     strconv.Itoa(sensor.ID),
+		"sensor": sensor.UUID,
+		"name":   sensor.Name,
+		"device": sensor.DeviceUUID,
+	}
+
+	labels := make(prometheus.Labels, len(values))
+	for label, value := range values {
+		if name := sensorLabelName(renames, label); name != "" {
+			labels[name] = value
+		}
+	}
+
+	return labels
+}
+
+func sensorLabelName(renames map[string]string, label string) string {
+	if name, ok := renames[label]; ok {
+		return name
+	}
+
+	return label
+}
+
+// extraLabels holds constant labels attached to every metric emitted by a converter
+type extraLabels struct {
+	labels map[string]string
+}
+
+// SetExtraLabels sets constant labels, e.g. tenant="acme", added to every emitted metric
+func (e *extraLabels) SetExtraLabels(labels map[string]string) {
+	e.labels = maps.Clone(labels)
+}
+
+// labelNames appends the extra label names in a stable order
+func (e *extraLabels) labelNames(names ...string) []string {
+	return append(names, slices.Sorted(maps.Keys(e.labels))...)
+}
+
+// withExtraLabels adds the extra label values to the given labels
+func (e *extraLabels) withExtraLabels(labels prometheus.Labels) prometheus.Labels {
+	for name, value := range e.labels {
+		labels[name] = value
+	}
+
+	return labels
+}
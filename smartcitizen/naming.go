@@ -0,0 +1,61 @@
+package smartcitizen
+
+import "strings"
+
+// NameStrategy builds the names of the exported metrics, the registry adds the namespace
+type NameStrategy interface {
+	// DeviceMetric names device level metrics, e.g. "info" or "location"
+	DeviceMetric(suffix string) string
+	// SensorMetric names sensor level metrics; category is empty for metrics
+	// not tied to a sensor mapping, e.g. "info" or "reading_timestamp_seconds"
+	SensorMetric(category, metric string) string
+}
+
+// DefaultNameStrategy reproduces the built-in names, e.g. device_info and sensor_environment_temperature
+type DefaultNameStrategy struct{}
+
+func (DefaultNameStrategy) DeviceMetric(suffix string) string {
+	return joinNameParts("device", suffix)
+}
+
+func (DefaultNameStrategy) SensorMetric(category, metric string) string {
+	return joinNameParts("sensor", category, metric)
+}
+
+func joinNameParts(parts ...string) string {
+	nonEmpty := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+
+	return strings.Join(nonEmpty, "_")
+}
+
+// naming is embedded by the converters, without a strategy they use DefaultNameStrategy;
+// the metric name a converter is created with is handed to the strategy, e.g. "info"
+type naming struct {
+	names NameStrategy
+}
+
+// SetNameStrategy overrides the metric names of the converter, nil restores the default names
+func (n *naming) SetNameStrategy(names NameStrategy) {
+	n.names = names
+}
+
+func (n *naming) strategy() NameStrategy {
+	if n.names == nil {
+		return DefaultNameStrategy{}
+	}
+
+	return n.names
+}
+
+func (n *naming) deviceMetric(suffix string) string {
+	return n.strategy().DeviceMetric(suffix)
+}
+
+func (n *naming) sensorMetric(category, metric string) string {
+	return n.strategy().SensorMetric(category, metric)
+}
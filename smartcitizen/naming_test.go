@@ -0,0 +1,113 @@
+package smartcitizen
+
+import "testing"
+
+func TestDefaultNameStrategy(t *testing.T) {
+	names := DefaultNameStrategy{}
+
+	deviceTests := []struct {
+		suffix string
+		want   string
+	}{
+		{suffix: "info", want: "device_info"},
+		{suffix: "state_has_published", want: "device_state_has_published"},
+		{suffix: "location", want: "device_location"},
+		{suffix: "aqi", want: "device_aqi"},
+		{suffix: "", want: "device"},
+	}
+
+	for _, tt := range deviceTests {
+		if got := names.DeviceMetric(tt.suffix); got != tt.want {
+			t.Errorf("DeviceMetric(%q): expected %q, got %q", tt.suffix, tt.want, got)
+		}
+	}
+
+	sensorTests := []struct {
+		category string
+		metric   string
+		want     string
+	}{
+		{category: "environment", metric: "temperature", want: "sensor_environment_temperature"},
+		{category: "environment", metric: "temperature_raw", want: "sensor_environment_temperature_raw"},
+		{category: "", metric: "info", want: "sensor_info"},
+		{category: "", metric: "reading_timestamp_seconds", want: "sensor_reading_timestamp_seconds"},
+		{category: "", metric: "", want: "sensor"},
+	}
+
+	for _, tt := range sensorTests {
+		if got := names.SensorMetric(tt.category, tt.metric); got != tt.want {
+			t.Errorf("SensorMetric(%q, %q): expected %q, got %q", tt.category, tt.metric, tt.want, got)
+		}
+	}
+}
+
+// prefixStrategy names every metric smc_<kind>_<metric>
+type prefixStrategy struct{}
+
+func (prefixStrategy) DeviceMetric(suffix string) string {
+	return joinNameParts("smc_device", suffix)
+}
+
+func (prefixStrategy) SensorMetric(category, metric string) string {
+	return joinNameParts("smc_sensor", category, metric)
+}
+
+func TestNamingFallsBackToDefaultStrategy(t *testing.T) {
+	var n naming
+	if got := n.deviceMetric("info"); got != "device_info" {
+		t.Errorf("expected the default name device_info, got %q", got)
+	}
+
+	n.SetNameStrategy(prefixStrategy{})
+	if got := n.sensorMetric("environment", "temperature"); got != "smc_sensor_environment_temperature" {
+		t.Errorf("expected the strategy name, got %q", got)
+	}
+
+	n.SetNameStrategy(nil)
+	if got := n.sensorMetric("", "info"); got != "sensor_info" {
+		t.Errorf("expected nil to restore the default name sensor_info, got %q", got)
+	}
+}
+
+func TestAPIExporterDefaultMetricNames(t *testing.T) {
+	exporter, registry := newTestExporter(t)
+
+	device := DeviceDetail{ID: 1, UUID: "device-1", Name: "Balcony", State: "has_published",
+		Data: DeviceData{
+			Location: DeviceLocation{Latitude: 41.39, Longitude: 2.17, City: "Barcelona"},
+			Sensors:  []DeviceSensor{{ID: 55, UUID: "sensor-1", Name: "Temperature", Value: 21.5}},
+		}}
+	if err := exporter.ConvertDevice(device); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"device_info", "device_state_has_published", "device_location", "device_elevation_meters", "sensor_state", "sensor_info"} {
+		if _, exists := registry.GetCollectorByName(name); !exists {
+			t.Errorf("expected %s to be registered", name)
+		}
+	}
+}
+
+func TestConverterMetricNameIsHandedToStrategy(t *testing.T) {
+	device := DeviceDetail{ID: 1, UUID: "device-1", Name: "Balcony"}
+
+	converter := NewDeviceInfoConverter("details")
+	registry := newTestRegistry()
+	if err := converter.Convert(registry, device); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, exists := registry.GetCollectorByName("device_details"); !exists {
+		t.Error("expected the default strategy to name the metric device_details")
+	}
+
+	converter.SetNameStrategy(prefixStrategy{})
+	registry = newTestRegistry()
+	if err := converter.Convert(registry, device); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, exists := registry.GetCollectorByName("smc_device_details"); !exists {
+		t.Error("expected the strategy to name the metric smc_device_details")
+	}
+}
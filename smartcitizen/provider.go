@@ -10,7 +10,9 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/timgluz/smcprober/httpclient"
 	"github.com/timgluz/smcprober/metric"
 )
@@ -21,6 +23,15 @@ type OauthSession struct {
 	ExpiresIn    int64  `json:"expires_in"`
 }
 
+// TokenExpiryUnknown is reported when the session lifetime is not known, e.g. for API tokens
+const TokenExpiryUnknown = -1
+
+var (
+	ErrNoSession     = fmt.Errorf("no active session, please authenticate first")
+	ErrPrivateDevice = fmt.Errorf("device is not public, authenticate to access it")
+	ErrUnauthorized  = fmt.Errorf("session was rejected, it may have expired")
+)
+
 type Provider interface {
 	Authenticate(ctx context.Context, credential UserCredential) error
 	HasSession() bool
@@ -29,6 +40,8 @@ type Provider interface {
 	Ping(ctx context.Context) error
 	GetMe(ctx context.Context) (User, error)
 	GetDevice(ctx context.Context, deviceID int) (*DeviceDetail, error)
+	// GetPublicDevice fetches a world-readable device without authentication
+	GetPublicDevice(ctx context.Context, deviceID int) (*DeviceDetail, error)
 }
 
 type HTTPProvider struct {
@@ -36,6 +49,9 @@ type HTTPProvider struct {
 	session  *OauthSession
 	registry metric.Registry
 
+	authenticatedAt time.Time
+	tokenExpiry     prometheus.Gauge
+
 	client *http.Client
 	logger *slog.Logger
 }
@@ -61,23 +77,81 @@ func NewHTTPProvider(config Config, client *http.Client, registry metric.Registr
 
 	// Wrap the client's transport with instrumentation
 	if transport, ok := client.Transport.(*http.Transport); ok {
-		client.Transport = httpclient.NewInstrumentedTransport(transport, histogram)
+		instrumented := httpclient.NewInstrumentedTransport(transport, histogram)
+		instrumented.SetLogger(logger)
+		if config.TraceConnections {
+			instrumented.SetConnectionReuseCounter(registry.GetOrCreateCounterVec(
+				"api_connection_reused_total",
+				"Total API requests by whether they reused a pooled connection",
+				[]string{"reused"},
+			))
+		}
+		client.Transport = instrumented
 	} else {
 		logger.Warn("HTTP transport is not *http.Transport; metrics instrumentation not applied",
 			"transport_type", fmt.Sprintf("%T", client.Transport))
 	}
 
+	// Pace outside of the instrumentation, so waiting for a token isn't measured as latency
+	if config.RequestsPerSecond > 0 {
+		client.Transport = httpclient.NewRateLimitTransport(client.Transport,
+			config.RequestsPerSecond,
+			config.RequestsBurst,
+		)
+	}
+
+	// Retry outside of the instrumentation, so every attempt is measured;
+	// without retries the transport only counts rate limited requests
+	retryTransport := httpclient.NewRetryTransport(client.Transport,
+		config.MaxRetries,
+		config.RetryBackoffDuration(),
+	)
+	retryTransport.SetRateLimitedCounter(registry.GetOrCreateCounter(
+		"api_rate_limited_total",
+		"Total API requests rejected with 429 Too Many Requests",
+	))
+	client.Transport = retryTransport
+
+	tokenExpiry := registry.GetOrCreateGauge(
+		"api_token_expiry_seconds",
+		"Remaining lifetime of the API access token in seconds, -1 if unknown",
+	)
+	tokenExpiry.Set(TokenExpiryUnknown)
+
 	return &HTTPProvider{
-		config:   config,
-		client:   client,
-		registry: registry,
-		logger:   logger,
+		config:      config,
+		client:      client,
+		registry:    registry,
+		logger:      logger,
+		tokenExpiry: tokenExpiry,
+	}
+}
+
+// drainAndClose discards the unread rest of the body before closing it, so the
+// connection goes back to the keep-alive pool also on error responses
+func (p *HTTPProvider) drainAndClose(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if closeErr := resp.Body.Close(); closeErr != nil {
+		p.logger.Warn("Failed to close response body", "error", closeErr)
 	}
 }
 
+// withTimeout derives a context limited by the per-method timeout, if one is configured;
+// callers must always call the returned cancel function
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
 func (p *HTTPProvider) Ping(ctx context.Context) error {
 	p.logger.Info("Pinging the SmartCitizen API endpoint")
 
+	ctx, cancel := withTimeout(ctx, p.config.PingTimeoutDuration())
+	defer cancel()
+
 	pingEndpoint, err := url.JoinPath(p.config.Endpoint, p.config.APIVersion)
 	if err != nil {
 		return err
@@ -93,13 +167,7 @@ func (p *HTTPProvider) Ping(ctx context.Context) error {
 		return err
 	}
 
-	defer func() {
-		// Drain the response body to allow connection reuse
-		_, _ = io.Copy(io.Discard, resp.Body)
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			p.logger.Warn("Failed to close response body", "error", closeErr)
-		}
-	}()
+	defer p.drainAndClose(resp)
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("ping failed with status code: %d", resp.StatusCode)
@@ -122,6 +190,7 @@ func (p *HTTPProvider) Authenticate(ctx context.Context, credential UserCredenti
 		p.session = &OauthSession{
 			AccessToken: credential.Token,
 		}
+		p.authenticatedAt = time.Now()
 		p.logger.Info("Using provided token for authentication")
 		// Validate the token by calling GetMe
 		if _, err := p.GetMe(ctx); err != nil {
@@ -138,7 +207,9 @@ func (p *HTTPProvider) Authenticate(ctx context.Context, credential UserCredenti
 	}
 
 	p.session = session
-	p.logger.Info("User authenticated successfully")
+	p.authenticatedAt = time.Now()
+	p.recordTokenExpiry()
+	p.logger.Info("User authenticated successfully", "expiresAt", p.SessionExpiresAt())
 	return nil
 }
 
@@ -165,11 +236,7 @@ func (p *HTTPProvider) fetchOauthSession(ctx context.Context, credential UserCre
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			p.logger.Warn("Failed to close response body", "error", closeErr)
-		}
-	}()
+	defer p.drainAndClose(resp)
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("authentication failed with status code: %d", resp.StatusCode)
@@ -188,15 +255,46 @@ func (p *HTTPProvider) fetchOauthSession(ctx context.Context, credential UserCre
 	return &session, nil
 }
 
+// HasSession reports whether requests can be authenticated, a session without a token can't
 func (p *HTTPProvider) HasSession() bool {
-	return p.session != nil
+	return p.session != nil && p.session.AccessToken != ""
+}
+
+// SessionExpiresAt returns when the access token expires,
+// or the zero time if there is no session or its lifetime is unknown
+func (p *HTTPProvider) SessionExpiresAt() time.Time {
+	if p.session == nil || p.session.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+
+	return p.authenticatedAt.Add(time.Duration(p.session.ExpiresIn) * time.Second)
+}
+
+func (p *HTTPProvider) recordTokenExpiry() {
+	if p.tokenExpiry == nil {
+		return
+	}
+
+	expiresAt := p.SessionExpiresAt()
+	if expiresAt.IsZero() {
+		p.tokenExpiry.Set(TokenExpiryUnknown)
+		return
+	}
+
+	p.tokenExpiry.Set(max(time.Until(expiresAt).Seconds(), 0))
 }
 
 func (p *HTTPProvider) GetMe(ctx context.Context) (User, error) {
 	if !p.HasSession() {
-		return User{}, fmt.Errorf("no active session, please authenticate first")
+		return User{}, ErrNoSession
 	}
 
+	// GetMe is called on every update cycle, keep the remaining lifetime fresh
+	p.recordTokenExpiry()
+
+	ctx, cancel := withTimeout(ctx, p.config.FetchTimeoutDuration())
+	defer cancel()
+
 	meEndpoint, err := url.JoinPath(p.config.Endpoint, p.config.APIVersion, "/me")
 	if err != nil {
 		return User{}, err
@@ -214,11 +312,11 @@ func (p *HTTPProvider) GetMe(ctx context.Context) (User, error) {
 		return User{}, err
 	}
 
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			p.logger.Warn("Failed to close response body", "error", closeErr)
-		}
-	}()
+	defer p.drainAndClose(resp)
+	if resp.StatusCode == http.StatusUnauthorized {
+		return User{}, fmt.Errorf("failed to get user info: %w", ErrUnauthorized)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return User{}, fmt.Errorf("failed to get user info with status code: %d", resp.StatusCode)
 	}
@@ -236,11 +334,29 @@ func (p *HTTPProvider) GetMe(ctx context.Context) (User, error) {
 	return user, nil
 }
 
+// GetDevice fetches the device with the session credentials,
+// in public mode it falls back to an anonymous request when there is no session
 func (p *HTTPProvider) GetDevice(ctx context.Context, deviceID int) (*DeviceDetail, error) {
 	if !p.HasSession() {
-		return nil, fmt.Errorf("no active session, please authenticate first")
+		if p.config.PublicMode {
+			return p.fetchDevice(ctx, deviceID, nil)
+		}
+
+		return nil, ErrNoSession
 	}
 
+	return p.fetchDevice(ctx, deviceID, p.session)
+}
+
+func (p *HTTPProvider) GetPublicDevice(ctx context.Context, deviceID int) (*DeviceDetail, error) {
+	return p.fetchDevice(ctx, deviceID, nil)
+}
+
+// fetchDevice requests the device detail, anonymously if the session is nil
+func (p *HTTPProvider) fetchDevice(ctx context.Context, deviceID int, session *OauthSession) (*DeviceDetail, error) {
+	ctx, cancel := withTimeout(ctx, p.config.FetchTimeoutDuration())
+	defer cancel()
+
 	deviceEndpoint, err := url.JoinPath(p.config.Endpoint,
 		p.config.APIVersion,
 		"/devices",
@@ -255,18 +371,26 @@ func (p *HTTPProvider) GetDevice(ctx context.Context, deviceID int) (*DeviceDeta
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+p.session.AccessToken)
+	if session != nil {
+		req.Header.Set("Authorization", "Bearer "+session.AccessToken)
+	}
 
+	// Accept-Encoding is left to the transport, setting it would disable the transparent gzip decoding
 	resp, err := p.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			p.logger.Warn("Failed to close response body", "error", closeErr)
-		}
-	}()
+	defer p.drainAndClose(resp)
+	p.logger.Debug("Fetched device", "deviceID", deviceID, "gzip", resp.Uncompressed)
+	if session == nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		return nil, fmt.Errorf("device %d: %w", deviceID, ErrPrivateDevice)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("device %d: %w", deviceID, ErrUnauthorized)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("failed to get device info with status code: %d", resp.StatusCode)
 	}
@@ -281,5 +405,9 @@ func (p *HTTPProvider) GetDevice(ctx context.Context, deviceID int) (*DeviceDeta
 		return nil, err
 	}
 
+	if err := device.Validate(); err != nil {
+		return nil, fmt.Errorf("device %d: %w", deviceID, err)
+	}
+
 	return &device, nil
 }
@@ -0,0 +1,170 @@
+package smartcitizen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/timgluz/smcprober/httpclient"
+	"github.com/timgluz/smcprober/metric"
+)
+
+func newTestProvider(t *testing.T, handler http.HandlerFunc) *HTTPProvider {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config := Config{Endpoint: server.URL, PublicMode: true, PublicDeviceIDs: []int{1}}
+	config.ApplyDefaults()
+
+	registry := metric.NewNamespacedRegistryWithRegisterer("test", nil, slog.New(slog.DiscardHandler))
+	return NewHTTPProvider(config, server.Client(), registry, slog.New(slog.DiscardHandler))
+}
+
+func TestGetDeviceRejectsEmptyPayloads(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "empty object", body: `{}`},
+		{name: "missing uuid", body: `{"id": 42, "name": "kitchen"}`},
+		{name: "missing id", body: `{"uuid": "0a1b2c3d", "name": "kitchen"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tt.body))
+			})
+
+			device, err := provider.GetDevice(context.Background(), 42)
+			if !errors.Is(err, ErrInvalidDeviceDetail) {
+				t.Fatalf("expected ErrInvalidDeviceDetail, got %v", err)
+			}
+
+			if device != nil {
+				t.Errorf("expected no device, got %+v", device)
+			}
+		})
+	}
+}
+
+func TestGetDeviceAcceptsValidPayload(t *testing.T) {
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v0/devices/42" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		_, _ = w.Write([]byte(`{"id": 42, "uuid": "0a1b2c3d", "name": "kitchen"}`))
+	})
+
+	device, err := provider.GetDevice(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if device.ID != 42 || device.UUID != "0a1b2c3d" {
+		t.Errorf("unexpected device %+v", device)
+	}
+}
+
+func TestHasSessionRequiresToken(t *testing.T) {
+	provider := &HTTPProvider{}
+	if provider.HasSession() {
+		t.Error("expected no session without a login")
+	}
+
+	provider.session = &OauthSession{}
+	if provider.HasSession() {
+		t.Error("expected a session without a token not to count")
+	}
+
+	provider.session = &OauthSession{AccessToken: "token"}
+	if !provider.HasSession() {
+		t.Error("expected a session with a token")
+	}
+}
+
+func TestGetDeviceReadingsAuthorization(t *testing.T) {
+	var authorization []string
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`[{"sensor_id": 55, "rollup": "1h", "readings": [["2025-01-02T12:00:00Z", 21.5]]}]`))
+	})
+
+	// public mode works without a session, an empty token must not be sent
+	provider.session = &OauthSession{}
+	if _, err := provider.GetDeviceReadings(context.Background(), 1, "1h"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	provider.session = &OauthSession{AccessToken: "token"}
+	readings, err := provider.GetDeviceReadings(context.Background(), 1, "1h")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if authorization[0] != "" || authorization[1] != "Bearer token" {
+		t.Errorf("expected the token only with a session, got %q", authorization)
+	}
+
+	if samples := readings[55].Samples; len(samples) != 1 || samples[0].Value != 21.5 {
+		t.Errorf("unexpected readings %+v", readings)
+	}
+}
+
+func TestGetDeviceDecodesGzipResponse(t *testing.T) {
+	fixture := `{"id": 42, "uuid": "0a1b2c3d", "name": "kitchen", "data": {"sensors": [` +
+		strings.Repeat(`{"id": 55, "uuid": "sensor-1", "name": "Temperature", "value": 21.5},`, 50) +
+		`{"id": 56, "uuid": "sensor-2", "name": "Humidity", "value": 40}]}}`
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write([]byte(fixture)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the transport asks for gzip as long as the provider doesn't set Accept-Encoding itself
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("expected the request to accept gzip, got %q", r.Header.Get("Accept-Encoding"))
+			_, _ = w.Write([]byte(fixture))
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(compressed.Bytes())
+	}))
+	t.Cleanup(server.Close)
+
+	if compressed.Len() >= len(fixture) {
+		t.Fatalf("expected the fixture to compress, got %d of %d bytes", compressed.Len(), len(fixture))
+	}
+
+	config := Config{Endpoint: server.URL, PublicMode: true, PublicDeviceIDs: []int{42}}
+	config.ApplyDefaults()
+
+	logger := slog.New(slog.DiscardHandler)
+	registry := metric.NewNamespacedRegistryWithRegisterer("test", nil, logger)
+	provider := NewHTTPProvider(config, httpclient.NewDefaultHTTPClient(), registry, logger)
+
+	device, err := provider.GetDevice(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if device.UUID != "0a1b2c3d" || len(device.Data.Sensors) != 51 || device.Data.Sensors[50].Name != "Humidity" {
+		t.Errorf("unexpected device %+v", device)
+	}
+}
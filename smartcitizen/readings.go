@@ -0,0 +1,162 @@
+package smartcitizen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// rollupPattern matches the time buckets accepted by the API, e.g. 15m, 1h or 1d
+var rollupPattern = regexp.MustCompile(`^[0-9]+(ms|s|m|h|d|w|y)$`)
+
+var (
+	ErrInvalidRollup = fmt.Errorf("invalid readings rollup")
+)
+
+// Reading holds the values of a sensor aggregated into rollup sized time buckets
+type Reading struct {
+	SensorID int    `json:"sensor_id"`
+	Rollup   string `json:"rollup"`
+
+	Samples []ReadingSample `json:"samples"`
+}
+
+// ReadingSample is a single time bucket, buckets without data are marked as missing
+type ReadingSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Missing   bool      `json:"missing,omitempty"`
+}
+
+// UnmarshalJSON decodes the [timestamp, value] pairs of the API, where null values mark missing data
+func (s *ReadingSample) UnmarshalJSON(data []byte) error {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+
+	if len(pair) != 2 {
+		return fmt.Errorf("expected [timestamp, value] reading, got %d elements", len(pair))
+	}
+
+	var timestamp string
+	if err := json.Unmarshal(pair[0], &timestamp); err != nil {
+		return err
+	}
+
+	parsed, err := ParseTime(timestamp)
+	if err != nil {
+		return err
+	}
+	s.Timestamp = parsed
+
+	var value *float64
+	if err := json.Unmarshal(pair[1], &value); err != nil {
+		return err
+	}
+
+	s.Missing = value == nil
+	if value != nil {
+		s.Value = *value
+	}
+
+	return nil
+}
+
+// deviceReadingsResponse is the readings of a single sensor as returned by the API
+type deviceReadingsResponse struct {
+	SensorID int             `json:"sensor_id"`
+	Rollup   string          `json:"rollup"`
+	Readings []ReadingSample `json:"readings"`
+}
+
+// GetDeviceReadings fetches the recent readings of all device sensors in a single request,
+// grouped into rollup sized buckets, e.g. "1h"; the result is keyed by sensor ID
+func (p *HTTPProvider) GetDeviceReadings(ctx context.Context, deviceID int, rollup string) (map[int]Reading, error) {
+	if !rollupPattern.MatchString(rollup) {
+		return nil, fmt.Errorf("%w: %q, expected a duration like 15m, 1h or 1d", ErrInvalidRollup, rollup)
+	}
+
+	if !p.HasSession() && !p.config.PublicMode {
+		return nil, ErrNoSession
+	}
+
+	ctx, cancel := withTimeout(ctx, p.config.FetchTimeoutDuration())
+	defer cancel()
+
+	readingsEndpoint, err := url.JoinPath(p.config.Endpoint,
+		p.config.APIVersion,
+		"/devices",
+		strconv.Itoa(deviceID),
+		"/readings",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, readingsEndpoint+"?"+url.Values{"rollup": {rollup}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.HasSession() {
+		req.Header.Set("Authorization", "Bearer "+p.session.AccessToken)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer p.drainAndClose(resp)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get device readings with status code: %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := decodeDeviceReadings(content)
+	if err != nil {
+		return nil, fmt.Errorf("device %d: failed to decode readings: %w", deviceID, err)
+	}
+
+	readings := make(map[int]Reading, len(responses))
+	for _, response := range responses {
+		readings[response.SensorID] = Reading{
+			SensorID: response.SensorID,
+			Rollup:   response.Rollup,
+			Samples:  response.Readings,
+		}
+	}
+
+	return readings, nil
+}
+
+// decodeDeviceReadings accepts both a list of sensor readings and the readings of a single sensor
+func decodeDeviceReadings(content []byte) ([]deviceReadingsResponse, error) {
+	content = bytes.TrimSpace(content)
+	if bytes.HasPrefix(content, []byte("[")) {
+		var responses []deviceReadingsResponse
+		if err := json.Unmarshal(content, &responses); err != nil {
+			return nil, err
+		}
+		return responses, nil
+	}
+
+	var response deviceReadingsResponse
+	if err := json.Unmarshal(content, &response); err != nil {
+		return nil, err
+	}
+
+	return []deviceReadingsResponse{response}, nil
+}
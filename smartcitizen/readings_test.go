@@ -0,0 +1,104 @@
+package smartcitizen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetDeviceReadings(t *testing.T) {
+	hour := func(h int) time.Time {
+		return time.Date(2025, 1, 2, h, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		want    map[int]Reading
+		wantErr bool
+	}{
+		{
+			name: "hourly buckets of all sensors",
+			body: `[
+				{"sensor_id": 55, "rollup": "1h", "readings": [["2025-01-02T12:00:00Z", 21.5], ["2025-01-02T13:00:00Z", 22]]},
+				{"sensor_id": 56, "rollup": "1h", "readings": [["2025-01-02T12:00:00Z", 40]]}
+			]`,
+			want: map[int]Reading{
+				55: {SensorID: 55, Rollup: "1h", Samples: []ReadingSample{{Timestamp: hour(12), Value: 21.5}, {Timestamp: hour(13), Value: 22}}},
+				56: {SensorID: 56, Rollup: "1h", Samples: []ReadingSample{{Timestamp: hour(12), Value: 40}}},
+			},
+		},
+		{
+			name: "null marks a bucket without data",
+			body: `[{"sensor_id": 55, "rollup": "1h", "readings": [["2025-01-02T12:00:00Z", null], ["2025-01-02T13:00:00Z", 0]]}]`,
+			want: map[int]Reading{
+				55: {SensorID: 55, Rollup: "1h", Samples: []ReadingSample{{Timestamp: hour(12), Missing: true}, {Timestamp: hour(13), Value: 0}}},
+			},
+		},
+		{
+			name: "single sensor object",
+			body: `{"sensor_id": 55, "rollup": "1h", "readings": [["2025-01-02 12:00:00 UTC", 21.5]]}`,
+			want: map[int]Reading{
+				55: {SensorID: 55, Rollup: "1h", Samples: []ReadingSample{{Timestamp: hour(12), Value: 21.5}}},
+			},
+		},
+		{
+			name: "no readings",
+			body: `[]`,
+			want: map[int]Reading{},
+		},
+		{name: "reading without value", body: `[{"sensor_id": 55, "readings": [["2025-01-02T12:00:00Z"]]}]`, wantErr: true},
+		{name: "invalid timestamp", body: `[{"sensor_id": 55, "readings": [["yesterday", 1]]}]`, wantErr: true},
+		{name: "invalid value", body: `[{"sensor_id": 55, "readings": [["2025-01-02T12:00:00Z", "high"]]}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rollup string
+			provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				rollup = r.URL.Query().Get("rollup")
+				_, _ = w.Write([]byte(tt.body))
+			})
+
+			readings, err := provider.GetDeviceReadings(context.Background(), 1, "1h")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", readings)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if rollup != "1h" {
+				t.Errorf("expected the rollup in the query, got %q", rollup)
+			}
+
+			if !reflect.DeepEqual(readings, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, readings)
+			}
+		})
+	}
+}
+
+func TestGetDeviceReadingsRejectsInvalidRollup(t *testing.T) {
+	requests := 0
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	})
+
+	for _, rollup := range []string{"", "1", "hour", "1x", "-1h"} {
+		if _, err := provider.GetDeviceReadings(context.Background(), 1, rollup); !errors.Is(err, ErrInvalidRollup) {
+			t.Errorf("rollup %q: expected ErrInvalidRollup, got %v", rollup, err)
+		}
+	}
+
+	if requests != 0 {
+		t.Errorf("expected no request with an invalid rollup, got %d", requests)
+	}
+}
@@ -0,0 +1,100 @@
+package smartcitizen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SearchPageSize is the number of devices requested per page of search results
+	SearchPageSize = 100
+	// MaxSearchPages stops the pagination, in case the API keeps returning full pages
+	MaxSearchPages = 100
+)
+
+var (
+	ErrNoSearchTags = fmt.Errorf("at least one tag is required to search devices")
+)
+
+// SearchDevices returns the devices tagged with the given user or system tags, e.g. "school",
+// following the pages of the search results; no matches is an empty result, not an error.
+// Without a session only public devices are found
+func (p *HTTPProvider) SearchDevices(ctx context.Context, tags []string) ([]UserDevice, error) {
+	if len(tags) == 0 {
+		return nil, ErrNoSearchTags
+	}
+
+	devices := make([]UserDevice, 0)
+	for page := 1; page <= MaxSearchPages; page++ {
+		pageDevices, err := p.fetchSearchPage(ctx, tags, page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search devices, page %d: %w", page, err)
+		}
+
+		devices = append(devices, pageDevices...)
+		if len(pageDevices) < SearchPageSize {
+			return devices, nil
+		}
+	}
+
+	p.logger.Warn("Device search has more results than pages fetched, results are truncated",
+		"tags", tags, "devices", len(devices))
+	return devices, nil
+}
+
+func (p *HTTPProvider) fetchSearchPage(ctx context.Context, tags []string, page int) ([]UserDevice, error) {
+	ctx, cancel := withTimeout(ctx, p.config.FetchTimeoutDuration())
+	defer cancel()
+
+	searchEndpoint, err := url.JoinPath(p.config.Endpoint, p.config.APIVersion, "/devices")
+	if err != nil {
+		return nil, err
+	}
+
+	// the API separates multiple tags with a pipe
+	query := url.Values{}
+	query.Set("with_tags", strings.Join(tags, "|"))
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(SearchPageSize))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchEndpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.HasSession() {
+		req.Header.Set("Authorization", "Bearer "+p.session.AccessToken)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer p.drainAndClose(resp)
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthorized
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to search devices with status code: %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []UserDevice
+	if err := json.Unmarshal(content, &devices); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
@@ -0,0 +1,128 @@
+package smartcitizen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// newPagedSearchProvider serves total devices in pages of the requested size and records the requested pages
+func newPagedSearchProvider(t *testing.T, total int) (*HTTPProvider, *[]int) {
+	t.Helper()
+
+	var pages []int
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if got := query.Get("with_tags"); got != "school|outdoor" {
+			t.Errorf("expected the tags to be joined with a pipe, got %q", got)
+		}
+
+		page, _ := strconv.Atoi(query.Get("page"))
+		perPage, _ := strconv.Atoi(query.Get("per_page"))
+		pages = append(pages, page)
+
+		devices := make([]UserDevice, 0, perPage)
+		for id := (page-1)*perPage + 1; id <= min(page*perPage, total); id++ {
+			devices = append(devices, UserDevice{ID: id, Name: "Device " + strconv.Itoa(id)})
+		}
+
+		if err := json.NewEncoder(w).Encode(devices); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return provider, &pages
+}
+
+func TestSearchDevicesPagination(t *testing.T) {
+	tests := []struct {
+		name      string
+		total     int
+		wantPages int
+	}{
+		{name: "no matches", total: 0, wantPages: 1},
+		{name: "single page", total: 42, wantPages: 1},
+		{name: "last page is partial", total: 2*SearchPageSize + 1, wantPages: 3},
+		// a full last page is only known to be the last one by the empty page after it
+		{name: "last page is full", total: 2 * SearchPageSize, wantPages: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, pages := newPagedSearchProvider(t, tt.total)
+
+			devices, err := provider.SearchDevices(context.Background(), []string{"school", "outdoor"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if devices == nil || len(devices) != tt.total {
+				t.Fatalf("expected %d devices, got %d (nil=%v)", tt.total, len(devices), devices == nil)
+			}
+
+			for i, device := range devices {
+				if device.ID != i+1 {
+					t.Fatalf("expected the devices in page order, got ID %d at %d", device.ID, i)
+				}
+			}
+
+			if len(*pages) != tt.wantPages {
+				t.Errorf("expected %d pages, got %v", tt.wantPages, *pages)
+			}
+		})
+	}
+}
+
+func TestSearchDevicesStopsAtPageLimit(t *testing.T) {
+	// the API keeps returning full pages
+	provider, pages := newPagedSearchProvider(t, (MaxSearchPages+5)*SearchPageSize)
+
+	devices, err := provider.SearchDevices(context.Background(), []string{"school", "outdoor"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*pages) != MaxSearchPages || (*pages)[len(*pages)-1] != MaxSearchPages {
+		t.Errorf("expected the pagination to stop after %d pages, got %d", MaxSearchPages, len(*pages))
+	}
+
+	if len(devices) != MaxSearchPages*SearchPageSize {
+		t.Errorf("expected the devices of the fetched pages, got %d", len(devices))
+	}
+}
+
+func TestSearchDevicesFailedPage(t *testing.T) {
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		devices := make([]UserDevice, SearchPageSize)
+		_ = json.NewEncoder(w).Encode(devices)
+	})
+
+	devices, err := provider.SearchDevices(context.Background(), []string{"school"})
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+
+	if devices != nil {
+		t.Errorf("expected no partial result, got %d devices", len(devices))
+	}
+}
+
+func TestSearchDevicesRequiresTags(t *testing.T) {
+	provider, pages := newPagedSearchProvider(t, 1)
+
+	if _, err := provider.SearchDevices(context.Background(), nil); !errors.Is(err, ErrNoSearchTags) {
+		t.Errorf("expected ErrNoSearchTags, got %v", err)
+	}
+
+	if len(*pages) != 0 {
+		t.Errorf("expected no request without tags, got %v", *pages)
+	}
+}
@@ -0,0 +1,61 @@
+package smartcitizen
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+// SensorFilter decides which sensors are exported based on their names.
+// Patterns match the sensor name exactly or as a glob, e.g. "Sensirion SEN5X - PN*".
+type SensorFilter struct {
+	include []string
+	exclude []string
+}
+
+// NewSensorFilter creates a filter, an empty include list allows all sensors
+func NewSensorFilter(include, exclude []string) *SensorFilter {
+	return &SensorFilter{
+		include: include,
+		exclude: exclude,
+	}
+}
+
+// Allows reports whether the sensor should be exported, exclusions win over inclusions
+func (f *SensorFilter) Allows(sensorName string) bool {
+	if f == nil {
+		return true
+	}
+
+	if matchAny(f.exclude, sensorName) {
+		return false
+	}
+
+	return len(f.include) == 0 || matchAny(f.include, sensorName)
+}
+
+// ValidateSensorPatterns checks that all glob patterns are well-formed
+func ValidateSensorPatterns(patterns []string) error {
+	var errs []error
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid sensor pattern %q: %w", pattern, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if pattern == name {
+			return true
+		}
+
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,176 @@
+package smartcitizen
+
+import (
+	"errors"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timgluz/smcprober/clock"
+	"github.com/timgluz/smcprober/metric"
+)
+
+// sensorWindow keeps running aggregates of a sensor within the current window
+type sensorWindow struct {
+	start time.Time
+	min   float64
+	max   float64
+	sum   float64
+	count int
+
+	// labels of the series, seen marks the windows converted since the last Prune
+	labels prometheus.Labels
+	seen   bool
+}
+
+func (w *sensorWindow) observe(value float64) {
+	if w.count == 0 || value < w.min {
+		w.min = value
+	}
+
+	if w.count == 0 || value > w.max {
+		w.max = value
+	}
+
+	w.sum += value
+	w.count++
+}
+
+// DeviceSensorStatsConverter emits min, max and avg of sensor values across scrape cycles.
+//
+// It uses tumbling windows: when a window of a sensor is over, its aggregates are reset
+// and the new window starts with the current value. Only running aggregates are kept,
+// so memory is bounded by the number of sensors, not by the number of samples.
+// Prune drops the windows of sensors which are gone, e.g. of removed devices.
+type DeviceSensorStatsConverter struct {
+	extraLabels
+	naming
+
+	metricName    string
+	window        time.Duration
+	sensorMapping *metric.SensorMetricMapping
+
+	// labelRenames renames or drops the default sensor labels, like the value gauges
+	labelRenames map[string]string
+
+	mu      sync.Mutex
+	windows map[string]*sensorWindow
+	clock   clock.Clock
+}
+
+// NewDeviceSensorStatsConverter emits <metricName>_min, _max and _avg, e.g. sensor_value_min for "value";
+// it aggregates the values as the sensor mapping checks and converts them, a nil mapping only
+// rejects NaN and infinite values
+func NewDeviceSensorStatsConverter(metricName string, window time.Duration, sensorMapping *metric.SensorMetricMapping) *DeviceSensorStatsConverter {
+	if sensorMapping == nil {
+		sensorMapping = metric.NewSensorMetricMapping()
+	}
+
+	return &DeviceSensorStatsConverter{
+		metricName:    metricName,
+		window:        window,
+		sensorMapping: sensorMapping,
+		windows:       make(map[string]*sensorWindow),
+		clock:         clock.Real(),
+	}
+}
+
+// SetSensorLabels renames the default sensor labels, see DeviceSensorConverter.SetSensorLabels
+func (c *DeviceSensorStatsConverter) SetSensorLabels(renames map[string]string) {
+	c.labelRenames = maps.Clone(renames)
+}
+
+// SetClock replaces the clock deciding when a window is over
+func (c *DeviceSensorStatsConverter) SetClock(clk clock.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clock = clk
+}
+
+func (c *DeviceSensorStatsConverter) Name() string {
+	return "sensor_stats"
+}
+
+func (c *DeviceSensorStatsConverter) Match(name string) bool {
+	return name == DeviceSensorType
+}
+
+func (c *DeviceSensorStatsConverter) Convert(registry metric.Registry, data any) error {
+	sensor, ok := data.(DeviceSensor)
+	if !ok {
+		return ErrInvalidDataType
+	}
+
+	// invalid values, e.g. sentinels, are reported by the sensor converter and kept out of the stats
+	sensorMetric, _ := c.sensorMapping.Get(sensor.Name)
+	value, err := sensorMetric.CheckValue(sensor.Value)
+	if err != nil {
+		return nil
+	}
+
+	labels := c.withExtraLabels(sensorLabels(c.labelRenames, sensor))
+
+	// sensor UUIDs identify the sensor model, so key by device too
+	stats := c.observe(sensor.DeviceUUID+"/"+sensor.UUID, labels, sensorMetric.ConvertValue(value))
+
+	minVec, maxVec, avgVec := c.gaugeVecs(registry)
+	return errors.Join(
+		metric.SetGauge(minVec, labels, stats.min),
+		metric.SetGauge(maxVec, labels, stats.max),
+		metric.SetGauge(avgVec, labels, stats.sum/float64(stats.count)),
+	)
+}
+
+// Prune drops the windows of the sensors not converted since the previous call and deletes
+// their series, the exporter calls it after every update cycle; it returns the number of dropped windows
+func (c *DeviceSensorStatsConverter) Prune(registry metric.Registry) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pruned := 0
+	for key, window := range c.windows {
+		if window.seen {
+			window.seen = false
+			continue
+		}
+
+		minVec, maxVec, avgVec := c.gaugeVecs(registry)
+		minVec.Delete(window.labels)
+		maxVec.Delete(window.labels)
+		avgVec.Delete(window.labels)
+
+		delete(c.windows, key)
+		pruned++
+	}
+
+	return pruned
+}
+
+func (c *DeviceSensorStatsConverter) gaugeVecs(registry metric.Registry) (minVec, maxVec, avgVec *prometheus.GaugeVec) {
+	labelNames := c.labelNames(sensorLabelNames(c.labelRenames)...)
+
+	minVec = registry.GetOrCreateGaugeVec(c.sensorMetric("", c.metricName+"_min"), "Minimum sensor value in the current window", labelNames)
+	maxVec = registry.GetOrCreateGaugeVec(c.sensorMetric("", c.metricName+"_max"), "Maximum sensor value in the current window", labelNames)
+	avgVec = registry.GetOrCreateGaugeVec(c.sensorMetric("", c.metricName+"_avg"), "Average sensor value in the current window", labelNames)
+	return minVec, maxVec, avgVec
+}
+
+// observe adds the value to the window of the sensor and returns a snapshot of it
+func (c *DeviceSensorStatsConverter) observe(key string, labels prometheus.Labels, value float64) sensorWindow {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	window, exists := c.windows[key]
+	if !exists || now.Sub(window.start) >= c.window {
+		window = &sensorWindow{start: now}
+		c.windows[key] = window
+	}
+
+	window.labels = labels
+	window.seen = true
+	window.observe(value)
+	return *window
+}
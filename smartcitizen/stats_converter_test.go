@@ -0,0 +1,197 @@
+package smartcitizen
+
+import (
+	"log/slog"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/timgluz/smcprober/clock"
+	"github.com/timgluz/smcprober/metric"
+)
+
+func newTestStatsConverter(t *testing.T, sensorMapping *metric.SensorMetricMapping) (*DeviceSensorStatsConverter, *clock.FakeClock, *metric.NamespacedRegistry) {
+	t.Helper()
+
+	fakeClock := clock.NewFakeClock(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+	converter := NewDeviceSensorStatsConverter("value", time.Hour, sensorMapping)
+	converter.SetClock(fakeClock)
+
+	registry := metric.NewNamespacedRegistryWithRegisterer("test", nil, slog.New(slog.DiscardHandler))
+	return converter, fakeClock, registry
+}
+
+// gaugeValue reads the value of the gauge vector with the labels, e.g. of "sensor_value_avg"
+func gaugeValue(t *testing.T, registry *metric.NamespacedRegistry, name string, labels prometheus.Labels) float64 {
+	t.Helper()
+
+	collector, exists := registry.GetCollectorByName(name)
+	if !exists {
+		t.Fatalf("expected %s to be registered", name)
+	}
+
+	gauge, err := collector.(*prometheus.GaugeVec).GetMetricWith(labels)
+	if err != nil {
+		t.Fatalf("unexpected labels %v: %v", labels, err)
+	}
+
+	return testutil.ToFloat64(gauge)
+}
+
+func convertSensors(t *testing.T, converter *DeviceSensorStatsConverter, registry metric.Registry, sensors ...DeviceSensor) {
+	t.Helper()
+
+	for _, sensor := range sensors {
+		if err := converter.Convert(registry, sensor); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestDeviceSensorStatsConverterKeysWindowsByDevice(t *testing.T) {
+	converter, _, registry := newTestStatsConverter(t, nil)
+
+	// both devices carry the same sensor model
+	convertSensors(t, converter, registry,
+		DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-1", Value: 10},
+		DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-2", Value: 30},
+		DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-1", Value: 20},
+	)
+
+	labels := prometheus.Labels{"id": "55", "sensor": "sensor-1", "name": "Temperature", "device": "device-1"}
+	if got := gaugeValue(t, registry, "sensor_value_max", labels); got != 20 {
+		t.Errorf("expected device-1 max 20, got %v", got)
+	}
+
+	if got := gaugeValue(t, registry, "sensor_value_avg", labels); got != 15 {
+		t.Errorf("expected device-1 avg 15, got %v", got)
+	}
+
+	labels["device"] = "device-2"
+	if got := gaugeValue(t, registry, "sensor_value_min", labels); got != 30 {
+		t.Errorf("expected device-2 min 30, got %v", got)
+	}
+}
+
+func TestDeviceSensorStatsConverterSkipsInvalidValues(t *testing.T) {
+	sensorMapping := metric.NewSensorMetricMapping()
+	sensorMapping.Add("Temperature", metric.MetricMappingItem{Sentinels: []float64{-9999}})
+
+	converter, _, registry := newTestStatsConverter(t, sensorMapping)
+	sensor := DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-1", Value: 12}
+
+	convertSensors(t, converter, registry, sensor)
+	for _, value := range []float64{-9999, math.NaN(), math.Inf(1)} {
+		sensor.Value = value
+		convertSensors(t, converter, registry, sensor)
+	}
+
+	labels := prometheus.Labels{"id": "55", "sensor": "sensor-1", "name": "Temperature", "device": "device-1"}
+	if got := gaugeValue(t, registry, "sensor_value_min", labels); got != 12 {
+		t.Errorf("expected invalid values to be skipped, got min %v", got)
+	}
+
+	if got := gaugeValue(t, registry, "sensor_value_avg", labels); got != 12 {
+		t.Errorf("expected invalid values to be skipped, got avg %v", got)
+	}
+}
+
+func TestDeviceSensorStatsConverterConvertsUnits(t *testing.T) {
+	sensorMapping := metric.NewSensorMetricMapping()
+	sensorMapping.Add("Barometric Pressure", metric.MetricMappingItem{Scale: 0.01, Unit: "hPa"})
+
+	converter, _, registry := newTestStatsConverter(t, sensorMapping)
+	convertSensors(t, converter, registry,
+		DeviceSensor{ID: 58, UUID: "sensor-2", Name: "Barometric Pressure", DeviceUUID: "device-1", Value: 101300},
+	)
+
+	labels := prometheus.Labels{"id": "58", "sensor": "sensor-2", "name": "Barometric Pressure", "device": "device-1"}
+	if got := gaugeValue(t, registry, "sensor_value_max", labels); math.Abs(got-1013) > 1e-9 {
+		t.Errorf("expected the converted value 1013, got %v", got)
+	}
+}
+
+func TestDeviceSensorStatsConverterRenamesLabels(t *testing.T) {
+	converter, _, registry := newTestStatsConverter(t, nil)
+	converter.SetSensorLabels(map[string]string{"device": "device_uuid", "id": ""})
+
+	convertSensors(t, converter, registry,
+		DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-1", Value: 10},
+	)
+
+	labels := prometheus.Labels{"sensor": "sensor-1", "name": "Temperature", "device_uuid": "device-1"}
+	if got := gaugeValue(t, registry, "sensor_value_max", labels); got != 10 {
+		t.Errorf("expected 10 with the renamed labels, got %v", got)
+	}
+}
+
+func TestDeviceSensorStatsConverterWindowRollover(t *testing.T) {
+	converter, fakeClock, registry := newTestStatsConverter(t, nil)
+	sensor := DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-1", Value: 10}
+
+	convertSensors(t, converter, registry, sensor)
+	fakeClock.Advance(30 * time.Minute)
+	sensor.Value = 20
+	convertSensors(t, converter, registry, sensor)
+
+	labels := prometheus.Labels{"id": "55", "sensor": "sensor-1", "name": "Temperature", "device": "device-1"}
+	if got := gaugeValue(t, registry, "sensor_value_min", labels); got != 10 {
+		t.Errorf("expected min 10 within the window, got %v", got)
+	}
+
+	fakeClock.Advance(30 * time.Minute)
+	sensor.Value = 30
+	convertSensors(t, converter, registry, sensor)
+
+	if got := gaugeValue(t, registry, "sensor_value_min", labels); got != 30 {
+		t.Errorf("expected the new window to start with 30, got %v", got)
+	}
+}
+
+func TestDeviceSensorStatsConverterPrune(t *testing.T) {
+	converter, _, registry := newTestStatsConverter(t, nil)
+
+	kept := DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-1", Value: 10}
+	removed := DeviceSensor{ID: 55, UUID: "sensor-1", Name: "Temperature", DeviceUUID: "device-2", Value: 30}
+
+	convertSensors(t, converter, registry, kept, removed)
+	if pruned := converter.Prune(registry); pruned != 0 {
+		t.Fatalf("expected the windows converted in the cycle to be kept, pruned %d", pruned)
+	}
+
+	// device-2 is gone in the next cycle
+	convertSensors(t, converter, registry, kept)
+	if pruned := converter.Prune(registry); pruned != 1 {
+		t.Fatalf("expected the window of device-2 to be pruned, pruned %d", pruned)
+	}
+
+	for _, name := range []string{"sensor_value_min", "sensor_value_max", "sensor_value_avg"} {
+		collector, _ := registry.GetCollectorByName(name)
+		if got := testutil.CollectAndCount(collector); got != 1 {
+			t.Errorf("expected only the series of device-1 in %s, got %d series", name, got)
+		}
+	}
+
+	// a returning sensor starts a new window instead of continuing the old aggregates
+	removed.Value = 50
+	convertSensors(t, converter, registry, kept, removed)
+	if got := gaugeValue(t, registry, "sensor_value_min", sensorLabels(nil, removed)); got != 50 {
+		t.Errorf("expected a new window for device-2, got min %v", got)
+	}
+
+	if pruned := converter.Prune(registry); pruned != 0 {
+		t.Fatalf("expected both windows to be kept, pruned %d", pruned)
+	}
+
+	// nothing converted in the cycle, everything is pruned
+	if pruned := converter.Prune(registry); pruned != 2 {
+		t.Errorf("expected both windows to be pruned, pruned %d", pruned)
+	}
+
+	collector, _ := registry.GetCollectorByName("sensor_value_avg")
+	if got := testutil.CollectAndCount(collector); got != 0 {
+		t.Errorf("expected no series left, got %d", got)
+	}
+}